@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit keeps an append-only log of the policy decisions of autopilot,
+// one JSON record per line. The records can be chained by their hashes so that
+// a modified, removed or reordered record is detected.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Decision is the outcome of a policy evaluation on an object
+type Decision string
+
+const (
+	// DecisionExecuted is an action that was executed
+	DecisionExecuted Decision = "executed"
+	// DecisionSucceeded is an executed action whose verification succeeded
+	DecisionSucceeded Decision = "succeeded"
+	// DecisionFailed is an action that failed to run or to take effect
+	DecisionFailed Decision = "failed"
+	// DecisionSkipped is an action that was not executed, the reason tells why
+	DecisionSkipped Decision = "skipped"
+	// DecisionRolledBack is an executed action undone after its verification failed
+	DecisionRolledBack Decision = "rolled-back"
+	// DecisionDeferred is an action queued until the policy schedule opens
+	DecisionDeferred Decision = "deferred"
+)
+
+// Reasons of the skipped and deferred actions
+const (
+	ReasonCooldown     = "cooldown"
+	ReasonVerifying    = "verifying"
+	ReasonDryRun       = "dry-run"
+	ReasonObserve      = "observe"
+	ReasonConflict     = "conflict"
+	ReasonWindow       = "window"
+	ReasonConcurrency  = "concurrency"
+	ReasonVerification = "verification"
+)
+
+// Record is a policy decision on an object
+type Record struct {
+	Time     time.Time `json:"time"`
+	Policy   string    `json:"policy"`
+	Object   string    `json:"object"`
+	Action   string    `json:"action"`
+	Decision Decision  `json:"decision"`
+	Reason   string    `json:"reason,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Inputs   *Inputs   `json:"inputs,omitempty"`
+	// TraceID is the trace of the policy evaluation, if traced
+	TraceID string `json:"trace_id,omitempty"`
+	// PrevHash is the hash of the previous record of a hash chained log
+	PrevHash string `json:"prev_hash,omitempty"`
+	// Hash is the hash of the record, including PrevHash, of a hash chained log
+	Hash string `json:"hash,omitempty"`
+}
+
+// Inputs are the inputs of the policy evaluation that led to the decision
+type Inputs struct {
+	// PolicyVersion is the resource version of the policy
+	PolicyVersion string `json:"policy_version,omitempty"`
+	// Spec is the policy spec as evaluated
+	Spec json.RawMessage `json:"spec,omitempty"`
+	// Evaluation is the evaluation tree of the policy conditions on the object
+	Evaluation string `json:"evaluation,omitempty"`
+	// Metrics are the metrics returned by the providers for the object
+	Metrics []Metric `json:"metrics,omitempty"`
+}
+
+// Metric is a metric returned for a policy condition
+type Metric struct {
+	Condition string            `json:"condition"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     string            `json:"value"`
+}
+
+// digest returns the hash of the record without its own hash
+func (r *Record) digest() (string, error) {
+	tmp := *r
+	tmp.Hash = ""
+
+	data, err := json.Marshal(&tmp)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testRecord(policy, object string, at time.Time) *Record {
+	return &Record{
+		Time:     at,
+		Policy:   policy,
+		Object:   object,
+		Action:   "openstorage.io.action.volume/resize",
+		Decision: DecisionExecuted,
+		Inputs: &Inputs{
+			PolicyVersion: "42",
+			Spec:          json.RawMessage(`{"conditions":[{"key":"volume_usage > <80>","operator":"Gt"}]}`),
+			Evaluation:    "allOf => met\n  volume_usage Gt 80 => met",
+			Metrics: []Metric{{
+				Condition: "volume_usage",
+				Labels:    map[string]string{"volumename": object, "pvc": "data"},
+				Value:     "NaN",
+			}},
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	return dir
+}
+
+func readAll(t *testing.T, dir string, q Query) []*Record {
+	records := make([]*Record, 0)
+	require.NoError(t, Read(dir, q, func(r *Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	return records
+}
+
+func TestQuery(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(dir, Options{})
+	require.NoError(t, err)
+
+	start := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, l.Append(testRecord("prod-db", "pv-1", start)))
+	require.NoError(t, l.Append(testRecord("prod-web", "pv-2", start.Add(time.Hour))))
+	require.NoError(t, l.Append(testRecord("test-db", "pv-1", start.Add(2*time.Hour))))
+	require.NoError(t, l.Close())
+
+	require.Len(t, readAll(t, dir, Query{}), 3)
+	require.Len(t, readAll(t, dir, Query{Policy: "prod-*"}), 2)
+	require.Len(t, readAll(t, dir, Query{Object: "pv-1"}), 2)
+	require.Len(t, readAll(t, dir, Query{Since: start.Add(30 * time.Minute)}), 2)
+	require.Len(t, readAll(t, dir, Query{Until: start.Add(time.Hour)}), 2)
+
+	records := readAll(t, dir, Query{Policy: "prod-*", Object: "pv-1"})
+	require.Len(t, records, 1)
+	require.Equal(t, "prod-db", records[0].Policy)
+	require.Equal(t, "NaN", records[0].Inputs.Metrics[0].Value)
+	require.Empty(t, records[0].Hash, "log without hash chain")
+}
+
+func TestRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	line, err := json.Marshal(testRecord("prod-db", "pv-1", time.Now().UTC()))
+	require.NoError(t, err)
+
+	// two records per file
+	l, err := Open(dir, Options{MaxSize: int64(2*len(line) + 10), MaxFiles: 2})
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+	}
+	require.NoError(t, l.Close())
+
+	names, err := files(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "audit.log.2"),
+		filepath.Join(dir, "audit.log.1"),
+		filepath.Join(dir, "audit.log"),
+	}, names)
+
+	require.Len(t, readAll(t, dir, Query{}), 5, "oldest file removed")
+}
+
+func TestHashChain(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	line, err := json.Marshal(testRecord("prod-db", "pv-1", time.Now().UTC()))
+	require.NoError(t, err)
+
+	opts := Options{MaxSize: int64(3 * len(line)), MaxFiles: 1, HashChain: true}
+	l, err := Open(dir, opts)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+	}
+	require.NoError(t, l.Close())
+
+	// the chain continues when the log is opened again, across the rotation
+	l, err = Open(dir, opts)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Append(testRecord("prod-db", fmt.Sprintf("pv-%d", i+1), time.Now())))
+	}
+	require.NoError(t, l.Close())
+
+	count, err := Verify(dir)
+	require.NoError(t, err)
+	require.True(t, count > 2, "records checked")
+
+	current := filepath.Join(dir, FileName)
+	data, err := ioutil.ReadFile(current)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	require.True(t, len(lines) > 2)
+
+	// modified record
+	modified := strings.Replace(string(data), `"object":"pv-5"`, `"object":"pv-9"`, 1)
+	require.NotEqual(t, string(data), modified)
+	require.NoError(t, ioutil.WriteFile(current, []byte(modified), 0600))
+	_, err = Verify(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "modified")
+
+	// removed record
+	require.NoError(t, ioutil.WriteFile(current, []byte(strings.Join(lines[1:], "")), 0600))
+	_, err = Verify(dir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "removed")
+}
+
+func TestVerifyUnchained(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+	require.NoError(t, l.Close())
+
+	_, err = Verify(dir)
+	require.Error(t, err)
+}
+
+func TestOpenIncompleteRecord(t *testing.T) {
+	for _, tail := range []string{`{"time":"2019-`, "{\"time\":\"2019-\n", "\x00\x00\x00"} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		opts := Options{HashChain: true}
+		l, err := Open(dir, opts)
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+		}
+		require.NoError(t, l.Close())
+
+		// a crash or a full disk in the middle of a record
+		f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_WRONLY|os.O_APPEND, 0600)
+		require.NoError(t, err)
+		_, err = f.WriteString(tail)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		l, err = Open(dir, opts)
+		require.NoError(t, err, "Expected the log with %q to open", tail)
+		require.NoError(t, l.Append(testRecord("prod-db", "pv-2", time.Now())))
+		require.NoError(t, l.Close())
+
+		require.Len(t, readAll(t, dir, Query{}), 3)
+		count, err := Verify(dir)
+		require.NoError(t, err)
+		require.Equal(t, 3, count)
+	}
+}
+
+func TestSyncAndClose(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(dir, Options{SyncInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+	require.NoError(t, l.Sync())
+	require.NoError(t, l.Sync(), "Expected a flush without new records to succeed")
+
+	// let the background flush run concurrently with the appends
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Append(testRecord("prod-db", "pv-1", time.Now())))
+		time.Sleep(time.Millisecond)
+	}
+
+	require.NoError(t, l.Close())
+	require.NoError(t, l.Close(), "Expected a closed log to close again")
+	require.Error(t, l.Append(testRecord("prod-db", "pv-1", time.Now())), "Expected a closed log to reject records")
+	require.NoError(t, l.Sync())
+
+	require.Len(t, readAll(t, dir, Query{}), 11)
+}
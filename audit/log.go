@@ -0,0 +1,448 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FileName is the name of the current file of the log, the rotated files
+	// are suffixed with .1 for the newest up to .MaxFiles for the oldest
+	FileName = "audit.log"
+
+	// DefaultMaxSize is the size of the current file of the log that triggers a rotation
+	DefaultMaxSize = 100 * 1024 * 1024
+	// DefaultMaxFiles is the number of rotated files kept
+	DefaultMaxFiles = 5
+	// DefaultSyncInterval is how often the appended records are flushed to disk
+	DefaultSyncInterval = time.Second
+
+	// maxLineSize is the largest record read back
+	maxLineSize = 4 * 1024 * 1024
+)
+
+// Options configure the log
+type Options struct {
+	// MaxSize is the size of the current file that triggers a rotation. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept, older ones are removed
+	MaxFiles int
+	// HashChain chains every record to the previous one by its hash
+	HashChain bool
+	// SyncInterval is how often the appended records are flushed to disk in the
+	// background, so an append doesn't wait for the disk. The records appended
+	// since the last flush can be lost if the node crashes. Defaults to
+	// DefaultSyncInterval.
+	SyncInterval time.Duration
+}
+
+// Log is an append-only audit log in a directory
+type Log struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	lastHash string
+	// dirty is set when records were appended since the last flush
+	dirty bool
+	// syncErr is the error of the last background flush, returned by the next append
+	syncErr error
+
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens the log in the directory, creating it if needed. The hash chain
+// continues from the last record of the log.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+
+	if opts.MaxFiles < 0 {
+		opts.MaxFiles = 0
+	}
+
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("audit: %v", err)
+	}
+
+	l := &Log{
+		dir:  dir,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := repair(filepath.Join(dir, FileName)); err != nil {
+		return nil, err
+	}
+
+	if opts.HashChain {
+		last, err := lastRecord(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if last != nil {
+			l.lastHash = last.Hash
+		}
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	go l.syncLoop()
+	return l, nil
+}
+
+// Append writes the record to the log. The time of the record is set if it is
+// zero, and its hashes if the log is hash chained.
+func (l *Log) Append(r *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return fmt.Errorf("audit: log %s is closed", l.dir)
+	}
+
+	if err := l.syncErr; err != nil {
+		l.syncErr = nil
+		return fmt.Errorf("audit: failed to flush the log: %v", err)
+	}
+
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+
+	r.PrevHash, r.Hash = "", ""
+	if l.opts.HashChain {
+		r.PrevHash = l.lastHash
+		hash, err := r.digest()
+		if err != nil {
+			return fmt.Errorf("audit: %v", err)
+		}
+		r.Hash = hash
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(line)
+	l.dirty = true
+	if err != nil {
+		// drop the partial record, such as on a full disk, so the log stays readable
+		if n > 0 {
+			if terr := l.f.Truncate(l.size); terr != nil {
+				l.size += int64(n)
+			}
+		}
+		return fmt.Errorf("audit: %v", err)
+	}
+	l.size += int64(n)
+
+	l.lastHash = r.Hash
+	return nil
+}
+
+// Sync flushes the records appended so far to disk. The file is flushed
+// without holding the lock of the log, so appends don't wait for the disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	f, dirty := l.f, l.dirty
+	l.dirty = false
+	l.mu.Unlock()
+
+	if f == nil || !dirty {
+		return nil
+	}
+
+	if err := f.Sync(); err != nil {
+		l.mu.Lock()
+		// a rotation flushes and closes the file it replaces
+		if f == l.f {
+			l.dirty = true
+			l.mu.Unlock()
+			return fmt.Errorf("audit: %v", err)
+		}
+		l.mu.Unlock()
+	}
+
+	return nil
+}
+
+// syncLoop flushes the log every sync interval until the log is closed
+func (l *Log) syncLoop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Sync(); err != nil {
+				l.mu.Lock()
+				l.syncErr = err
+				l.mu.Unlock()
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// Close flushes and closes the log
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	l.closed = true
+	l.mu.Unlock()
+
+	close(l.stop)
+	<-l.done
+
+	if f == nil {
+		return nil
+	}
+
+	err := f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, FileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file to .1, shifting the rotated files and
+// removing the oldest one, and opens a new current file
+func (l *Log) rotate() error {
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	l.dirty = false
+
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	l.f = nil
+
+	current := filepath.Join(l.dir, FileName)
+	if l.opts.MaxFiles == 0 {
+		if err := os.Remove(current); err != nil {
+			return fmt.Errorf("audit: %v", err)
+		}
+		return l.open()
+	}
+
+	if err := os.Remove(rotatedName(l.dir, l.opts.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	for i := l.opts.MaxFiles - 1; i > 0; i-- {
+		if err := os.Rename(rotatedName(l.dir, i), rotatedName(l.dir, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("audit: %v", err)
+		}
+	}
+
+	if err := os.Rename(current, rotatedName(l.dir, 1)); err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	return l.open()
+}
+
+func rotatedName(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%d", FileName, i))
+}
+
+// files returns the existing files of the log in the directory, oldest first
+func files(dir string) ([]string, error) {
+	rotated := make([]string, 0)
+	for i := 1; ; i++ {
+		name := rotatedName(dir, i)
+		if _, err := os.Stat(name); err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, fmt.Errorf("audit: %v", err)
+		}
+		rotated = append(rotated, name)
+	}
+
+	rval := make([]string, 0, len(rotated)+1)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		rval = append(rval, rotated[i])
+	}
+
+	current := filepath.Join(dir, FileName)
+	if _, err := os.Stat(current); err == nil {
+		rval = append(rval, current)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("audit: %v", err)
+	}
+
+	return rval, nil
+}
+
+// scan calls fn with every record of the file and its line number
+func scan(name string, fn func(r *Record, line int) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return fmt.Errorf("audit: %s:%d: %v", name, line, err)
+		}
+
+		if err := fn(r, line); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("audit: %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// repair truncates an incomplete last record of the current file of the log,
+// left by a crash or a full disk, so that the log can be read and appended to
+func repair(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	trimmed := bytes.TrimRight(data, "\n")
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	start := bytes.LastIndexByte(trimmed, '\n') + 1
+	last := trimmed[start:]
+	if len(trimmed) < len(data) && json.Unmarshal(last, &Record{}) == nil {
+		return nil
+	}
+
+	logrus.Warnf("audit: dropping the incomplete last record of %s: %q", name, truncate(last, 64))
+	if err := os.Truncate(name, int64(start)); err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+
+	return nil
+}
+
+func truncate(data []byte, size int) []byte {
+	if len(data) > size {
+		return data[:size]
+	}
+	return data
+}
+
+// lastRecord returns the last record of the log in the directory, nil if the
+// log is empty
+func lastRecord(dir string) (*Record, error) {
+	names, err := files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(names) - 1; i >= 0; i-- {
+		var last *Record
+		err := scan(names[i], func(r *Record, _ int) error {
+			last = r
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if last != nil {
+			return last, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Query selects records of the log
+type Query struct {
+	// Policy is the name pattern of the policies, such as prod-*. All policies if empty.
+	Policy string
+	// Object is the object of the records. All objects if empty.
+	Object string
+	// Since and Until bound the time of the records, unbounded if zero
+	Since, Until time.Time
+}
+
+// Matches returns true if the record is selected by the query
+func (q *Query) Matches(r *Record) bool {
+	if len(q.Policy) > 0 {
+		if ok, _ := path.Match(q.Policy, r.Policy); !ok {
+			return false
+		}
+	}
+
+	if len(q.Object) > 0 && q.Object != r.Object {
+		return false
+	}
+
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+// Read calls fn with the records of the log in the directory that match the
+// query, oldest first
+func Read(dir string, q Query, fn func(r *Record) error) error {
+	names, err := files(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err := scan(name, func(r *Record, _ int) error {
+			if !q.Matches(r) {
+				return nil
+			}
+
+			return fn(r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify checks the hash chain of the log in the directory and returns the
+// number of records checked. The chain starts at the oldest record kept, the
+// records removed by the rotation are not checked.
+func Verify(dir string) (int, error) {
+	names, err := files(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	prev := ""
+	for _, name := range names {
+		err := scan(name, func(r *Record, line int) error {
+			if len(r.Hash) == 0 {
+				return fmt.Errorf("audit: %s:%d: record is not hash chained", name, line)
+			}
+
+			hash, err := r.digest()
+			if err != nil {
+				return fmt.Errorf("audit: %s:%d: %v", name, line, err)
+			}
+
+			if hash != r.Hash {
+				return fmt.Errorf("audit: %s:%d: record was modified", name, line)
+			}
+
+			if count > 0 && r.PrevHash != prev {
+				return fmt.Errorf("audit: %s:%d: previous record was removed or reordered", name, line)
+			}
+
+			prev = r.Hash
+			count++
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libopenstorage/autopilot/audit"
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/urfave/cli"
+)
+
+// auditDirName is the directory of the audit log in the data directory
+const auditDirName = "audit"
+
+func auditDir(c *cli.Context) string {
+	return filepath.Join(c.GlobalString("data-dir"), auditDirName)
+}
+
+// openAuditLog opens the audit log in the data directory
+func openAuditLog(c *cli.Context) (*audit.Log, error) {
+	return audit.Open(auditDir(c), audit.Options{
+		MaxSize:   int64(c.GlobalInt("audit-max-size")) * 1024 * 1024,
+		MaxFiles:  c.GlobalInt("audit-max-files"),
+		HashChain: c.GlobalBool("audit-hash-chain"),
+	})
+}
+
+// auditDecision records the decision on the action of the matched policy in
+// the audit log, along with the inputs of the policy evaluation. An action
+// skipped on every poll cycle for the same reason is recorded once, until the
+// reason changes, another decision is made or the policy no longer matches the
+// object.
+func (c *crdController) auditDecision(match *policyMatch, decision audit.Decision, reason, msg string) {
+	if c.audit == nil {
+		return
+	}
+
+	if !c.isAuditChange(match, decision, reason) {
+		return
+	}
+
+	r := &audit.Record{
+		Policy:   match.policy.Name,
+		Object:   match.object,
+		Action:   match.policy.Spec.Action.Name,
+		Decision: decision,
+		Reason:   reason,
+		Message:  msg,
+		Inputs:   auditInputs(match),
+		TraceID:  match.span.TraceID(),
+	}
+
+	if err := c.audit.Append(r); err != nil {
+		log.StoragePolicyLog(match.policy).Errorf("failed to write the audit log: %v", err)
+	}
+}
+
+// isAuditChange returns false if the decision is a skip for the same reason as
+// the last skip recorded for the policy and object
+func (c *crdController) isAuditChange(match *policyMatch, decision audit.Decision, reason string) bool {
+	key := pendingKey(match.policy, match.object)
+
+	c.auditLock.Lock()
+	defer c.auditLock.Unlock()
+
+	if decision != audit.DecisionSkipped {
+		delete(c.lastSkip, key)
+		return true
+	}
+
+	if last, ok := c.lastSkip[key]; ok && last == reason {
+		return false
+	}
+
+	c.lastSkip[key] = reason
+	return true
+}
+
+// expireAuditSkips forgets the last skips of the policies that no longer
+// match their object, so that a skip is recorded again once they match
+func (c *crdController) expireAuditSkips(matches []*policyMatch) {
+	matched := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		matched[pendingKey(match.policy, match.object)] = true
+	}
+
+	c.auditLock.Lock()
+	defer c.auditLock.Unlock()
+
+	for key := range c.lastSkip {
+		if !matched[key] {
+			delete(c.lastSkip, key)
+		}
+	}
+}
+
+// auditInputs returns the inputs of the evaluation of the matched policy
+func auditInputs(match *policyMatch) *audit.Inputs {
+	inputs := &audit.Inputs{
+		PolicyVersion: match.policy.ResourceVersion,
+		Evaluation:    match.evaluation,
+	}
+
+	if spec, err := json.Marshal(&match.policy.Spec); err == nil {
+		inputs.Spec = spec
+	}
+
+	conditions := match.policy.Spec.ConditionList()
+	for _, vec := range match.vectors {
+		m := audit.Metric{Labels: metricLabels(vec.Metric)}
+		if vec.Condition < len(conditions) {
+			m.Condition = conditions[vec.Condition].Key
+		}
+
+		value := vec.Value
+		if len(value) == 0 && len(vec.Values) > 0 {
+			value = vec.Values[len(vec.Values)-1]
+		}
+
+		if len(value) == 2 {
+			m.Value = fmt.Sprint(value[1])
+		}
+
+		inputs.Metrics = append(inputs.Metrics, m)
+	}
+
+	return inputs
+}
+
+// metricLabels returns the labels of the metric that are set
+func metricLabels(metric metrics.Metric) map[string]string {
+	data, err := json.Marshal(&metric)
+	if err != nil {
+		return nil
+	}
+
+	all := make(map[string]string)
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for k, v := range all {
+		if len(v) > 0 {
+			labels[k] = v
+		}
+	}
+
+	return labels
+}
+
+// auditAction prints the records of the audit log selected by the flags, or
+// verifies its hash chain
+func auditAction(c *cli.Context) error {
+	dir := auditDir(c)
+
+	if c.Bool("verify") {
+		count, err := audit.Verify(dir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s: %d record(s) verified\n", dir, count)
+		return nil
+	}
+
+	q := audit.Query{
+		Policy: c.String("policy"),
+		Object: c.String("object"),
+	}
+
+	var err error
+	if q.Since, err = parseAuditTime(c.String("since")); err != nil {
+		return err
+	}
+
+	if q.Until, err = parseAuditTime(c.String("until")); err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		return audit.Read(dir, q, func(r *audit.Record) error {
+			return enc.Encode(r)
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPOLICY\tOBJECT\tACTION\tDECISION\tREASON\tMESSAGE")
+	err = audit.Read(dir, q, func(r *audit.Record) error {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Format(time.RFC3339), r.Policy, r.Object, r.Action, r.Decision, r.Reason,
+			strings.Replace(r.Message, "\n", " ", -1))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// parseAuditTime parses a time of the audit query, either an RFC3339 time or a
+// duration before now such as 24h
+func parseAuditTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected an RFC3339 time or a duration", s)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/libopenstorage/autopilot/audit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditSkipsOnReasonChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, _ := newTestController()
+	c.audit, err = audit.Open(dir, audit.Options{})
+	require.NoError(t, err)
+
+	match := &policyMatch{policy: newPolicy("resize", "", 0), object: "vol-1"}
+	other := &policyMatch{policy: newPolicy("resize", "", 0), object: "vol-2"}
+
+	decisions := []struct {
+		match    *policyMatch
+		decision audit.Decision
+		reason   string
+	}{
+		{match, audit.DecisionSkipped, audit.ReasonCooldown},
+		{match, audit.DecisionSkipped, audit.ReasonCooldown},
+		{other, audit.DecisionSkipped, audit.ReasonCooldown},
+		{match, audit.DecisionSkipped, audit.ReasonConcurrency},
+		{match, audit.DecisionSkipped, audit.ReasonConcurrency},
+		{match, audit.DecisionExecuted, ""},
+		{match, audit.DecisionSkipped, audit.ReasonConcurrency},
+	}
+	for _, d := range decisions {
+		c.auditDecision(d.match, d.decision, d.reason, "")
+	}
+
+	// vol-2 no longer matches, its skip is recorded again once it does
+	c.expireAuditSkips([]*policyMatch{match})
+	c.auditDecision(match, audit.DecisionSkipped, audit.ReasonConcurrency, "")
+	c.auditDecision(other, audit.DecisionSkipped, audit.ReasonCooldown, "")
+	require.NoError(t, c.audit.Close())
+
+	recorded := make([]string, 0)
+	require.NoError(t, audit.Read(dir, audit.Query{}, func(r *audit.Record) error {
+		recorded = append(recorded, r.Object+" "+string(r.Decision)+" "+r.Reason)
+		return nil
+	}))
+	require.Equal(t, []string{
+		"vol-1 skipped cooldown",
+		"vol-2 skipped cooldown",
+		"vol-1 skipped concurrency",
+		"vol-1 executed ",
+		"vol-1 skipped concurrency",
+		"vol-2 skipped cooldown",
+	}, recorded)
+}
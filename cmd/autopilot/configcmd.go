@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/urfave/cli"
+)
+
+// configValidateAction reports every problem of a configuration file, including
+// the unknown settings that autopilot ignores when it runs
+func configValidateAction(c *cli.Context) error {
+	f := c.GlobalString("config")
+	if c.NArg() > 0 {
+		f = c.Args().Get(0)
+	}
+
+	cfg, err := config.ReadFileStrict(f)
+	problems, ok := err.(config.Problems)
+	if err != nil && !ok {
+		return err
+	}
+
+	if cfg != nil {
+		if err := validateConfig(cfg); err != nil {
+			problems = append(problems, err.(config.Problems)...)
+			problems.Sort()
+		}
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("%s: valid\n", f)
+		return nil
+	}
+
+	for _, problem := range problems {
+		// the line is printed as the location of the problem
+		line := problem.Line
+		problem.Line = 0
+		if line > 0 {
+			fmt.Printf("%s:%d: %s\n", f, line, problem.Error())
+		} else {
+			fmt.Printf("%s: %s\n", f, problem.Error())
+		}
+	}
+
+	return fmt.Errorf("%s: %d problem(s) found", f, len(problems))
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configFromResource converts the spec of an AutopilotConfig to a configuration
+func configFromResource(res *autopilot.AutopilotConfig) (*config.Config, error) {
+	spec := res.Spec
+	cfg := &config.Config{
+		PollRate:        spec.PollRate,
+		DryRun:          spec.DryRun,
+		StorageEndpoint: spec.StorageEndpoint,
+		StorageTLS:      spec.StorageTLS,
+	}
+
+	if len(spec.DefaultCooldown) > 0 {
+		cooldown, err := time.ParseDuration(spec.DefaultCooldown)
+		if err != nil {
+			return nil, fmt.Errorf("invalid defaultCooldown %q: %v", spec.DefaultCooldown, err)
+		}
+		cfg.CooldownPeriod = int(cooldown.Seconds())
+	}
+
+	if spec.Concurrency != nil {
+		cfg.Concurrency = config.ConcurrencyLimits{
+			MaxActions:          spec.Concurrency.MaxActions,
+			MaxActionsPerPolicy: spec.Concurrency.MaxActionsPerPolicy,
+		}
+	}
+
+	for _, prov := range spec.Providers {
+		mp := config.MetricsProvider{
+			Name:             prov.Name,
+			Type:             prov.Type,
+			Params:           prov.Params,
+			Timeout:          prov.Timeout,
+			Retries:          prov.Retries,
+			RetryBackoff:     prov.RetryBackoff,
+			FailureThreshold: prov.FailureThreshold,
+			ResetTimeout:     prov.ResetTimeout,
+		}
+
+		if prov.SecretRef != nil {
+			mp.SecretRef = &config.SecretRef{
+				Name:      prov.SecretRef.Name,
+				Namespace: prov.SecretRef.Namespace,
+			}
+		}
+
+		cfg.Providers = append(cfg.Providers, mp)
+	}
+
+	for _, notifier := range spec.Notifiers {
+		cfg.Notifiers = append(cfg.Notifiers, config.Notifier{
+			Name:        notifier.Name,
+			Type:        notifier.Type,
+			Params:      notifier.Params,
+			Policies:    notifier.Policies,
+			Events:      notifier.Events,
+			Severity:    notifier.Severity,
+			DedupWindow: notifier.DedupWindow,
+		})
+	}
+
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// handleConfigResource records the changes of the AutopilotConfig for the
+// poll loop. Only the changes of the spec ask for a reconfiguration, so the
+// status updates of autopilot don't.
+func (c *crdController) handleConfigResource(res *autopilot.AutopilotConfig, deleted bool) {
+	if res.Name != autopilot.AutopilotConfigName {
+		logrus.Warnf("ignoring AutopilotConfig %s, only %s is used", res.Name, autopilot.AutopilotConfigName)
+		return
+	}
+
+	c.resourceLock.Lock()
+	defer c.resourceLock.Unlock()
+
+	last := c.configResource
+	if deleted {
+		c.configResource = nil
+		logrus.Infof("AutopilotConfig %s deleted", res.Name)
+	} else {
+		c.configResource = res
+		if last != nil && reflect.DeepEqual(last.Spec, res.Spec) {
+			return
+		}
+		logrus.Infof("AutopilotConfig %s changed", res.Name)
+	}
+
+	select {
+	case c.configResourceChanged <- struct{}{}:
+	default:
+	}
+}
+
+// latestConfigResource returns the last seen AutopilotConfig, nil if it doesn't exist
+func (c *crdController) latestConfigResource() *autopilot.AutopilotConfig {
+	c.resourceLock.Lock()
+	defer c.resourceLock.Unlock()
+	return c.configResource
+}
+
+// reloadConfigResource swaps in the settings of the AutopilotConfig, or the
+// configuration file when it was deleted. It returns the providers to use from
+// now on. The caller must hold the controller lock.
+func (c *crdController) reloadConfigResource(f string, dryRun bool, provs map[string]metrics.Provider) (map[string]metrics.Provider, error) {
+	res := c.latestConfigResource()
+	if res == nil {
+		if !c.usingConfigResource {
+			return provs, nil
+		}
+
+		c.usingConfigResource = false
+		return c.reloadConfig(f, dryRun, provs)
+	}
+
+	source := fmt.Sprintf("AutopilotConfig %s", res.Name)
+	c.usingConfigResource = true
+	c.configStatusChanged = true
+
+	cfg, err := configFromResource(res)
+	if err != nil {
+		c.configError = err.Error()
+		c.recordConfigEvent(res, v1.EventTypeWarning, autopilot.StoragePolicyConfigInvalid,
+			fmt.Sprintf("invalid %s, keeping the previous configuration: %v", source, err))
+		return provs, err
+	}
+
+	if dryRun {
+		cfg.DryRun = true
+	}
+
+	next, err := c.applyConfig(cfg, source, res, provs)
+	if err != nil {
+		c.configError = err.Error()
+		return next, err
+	}
+
+	c.configError = ""
+	return next, nil
+}
+
+// syncConfigStatus publishes the health of the providers in the status of the
+// AutopilotConfig. Failed updates are retried on the next call. The caller
+// must hold the controller lock.
+func (c *crdController) syncConfigStatus() {
+	res := c.latestConfigResource()
+	if res == nil || !c.configStatusChanged {
+		return
+	}
+
+	providers := make([]autopilot.ProviderStatus, 0, len(c.providerHealth))
+	for name, healthy := range c.providerHealth {
+		providers = append(providers, autopilot.ProviderStatus{
+			Name:               name,
+			Healthy:            healthy,
+			LastTransitionTime: meta.NewTime(c.providerTransitions[name]),
+		})
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name < providers[j].Name
+	})
+
+	updated := res.DeepCopy()
+	updated.Status.Error = c.configError
+	updated.Status.Providers = providers
+	if err := sdk.Update(updated); err != nil {
+		logrus.Errorf("failed to update AutopilotConfig %s status: %v", res.Name, err)
+		return
+	}
+
+	c.resourceLock.Lock()
+	if c.configResource == res {
+		c.configResource = updated
+	}
+	c.resourceLock.Unlock()
+
+	c.configStatusChanged = false
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libopenstorage/autopilot/audit"
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+// policyMatch is a policy whose conditions are met on an object in a poll cycle
+type policyMatch struct {
+	policy *autopilot.StoragePolicy
+	object string
+	// evaluation is the evaluation tree of the policy conditions on the object
+	evaluation string
+	// vectors are the vectors returned by the providers for the object
+	vectors []metrics.Vector
+	// span is the span of the policy evaluation
+	span *trace.Span
+}
+
+// resolveConflicts picks a single policy for every object and action class
+// among the policies that matched in a poll cycle. Required policies win over
+// preferred ones, and between policies of the same enforcement the one with the
+// higher weight wins. Policies in observe mode never conflict with others.
+func (c *crdController) resolveConflicts(matches []*policyMatch) []*policyMatch {
+	resolved := make([]*policyMatch, 0, len(matches))
+	groups := make(map[string][]*policyMatch)
+	keys := make([]string, 0)
+
+	for _, match := range matches {
+		if match.policy.Spec.Mode == autopilot.PolicyModeObserve {
+			resolved = append(resolved, match)
+			continue
+		}
+
+		key := match.object + "/" + actionClass(match.policy)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], match)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			resolved = append(resolved, group[0])
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			return outranks(group[i].policy, group[j].policy)
+		})
+
+		winner := group[0]
+		skipped := make([]string, 0, len(group)-1)
+		for _, loser := range group[1:] {
+			skipped = append(skipped, loser.policy.Name)
+			log.StoragePolicyLog(loser.policy).Infof("skipping action %s on object %s in favor of policy %s",
+				loser.policy.Spec.Action.Name, loser.object, winner.policy.Name)
+			msg := fmt.Sprintf("action: %s on object: %s skipped in favor of policy: %s (enforcement: %s, weight: %d)",
+				loser.policy.Spec.Action.Name, loser.object, winner.policy.Name,
+				enforcementOf(winner.policy), winner.policy.Spec.Weight)
+			c.recorder.Event(loser.policy,
+				v1.EventTypeNormal,
+				string(autopilot.StoragePolicyActionSkipped),
+				msg)
+			c.auditDecision(loser, audit.DecisionSkipped, audit.ReasonConflict, msg)
+		}
+
+		c.recorder.Event(winner.policy,
+			v1.EventTypeNormal,
+			string(autopilot.StoragePolicyConflictResolved),
+			fmt.Sprintf("policy selected for object: %s over conflicting policies: %s",
+				winner.object, strings.Join(skipped, ", ")))
+
+		resolved = append(resolved, winner)
+	}
+
+	return resolved
+}
+
+// actionClass returns the conflict class of the policy action. Actions of the
+// same class running on the same object conflict with each other.
+func actionClass(policy *autopilot.StoragePolicy) string {
+	actionObjectType, _ := parseObjectTypeFromActionName(policy.Spec.Action.Name)
+	if len(actionObjectType) == 0 {
+		return policy.Spec.Action.Name
+	}
+
+	return actionObjectType
+}
+
+// outranks returns true if policy a takes precedence over policy b
+func outranks(a, b *autopilot.StoragePolicy) bool {
+	if enforcementOf(a) != enforcementOf(b) {
+		return enforcementOf(a) == autopilot.EnforcementRequired
+	}
+
+	if a.Spec.Weight != b.Spec.Weight {
+		return a.Spec.Weight > b.Spec.Weight
+	}
+
+	// break the tie in a deterministic way
+	return a.Name < b.Name
+}
+
+// enforcementOf returns the enforcement type of the policy, policies without an
+// enforcement type are required
+func enforcementOf(policy *autopilot.StoragePolicy) autopilot.EnforcementType {
+	if policy.Spec.Enforcement == autopilot.EnforcementPreferred {
+		return autopilot.EnforcementPreferred
+	}
+
+	return autopilot.EnforcementRequired
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubernetes/client-go/tools/record"
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	resizeAction = "openstorage.io.action.volume/resize"
+	moveAction   = "openstorage.io.action.volume/move"
+	expandAction = "openstorage.io.action.storagepool/expand"
+)
+
+// newTestController returns a controller with the state used by the poll
+// loop and a recorder that keeps the events
+func newTestController(policies ...*autopilot.StoragePolicy) (*crdController, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(100)
+	c := &crdController{
+		storagePolicies: make(map[string]*autopilot.StoragePolicy),
+		recorder:        recorder,
+		pendingActions:  make(map[string]*pendingAction),
+		schedules:       make(map[string]*parsedSchedule),
+		invalidModes:    make(map[string]string),
+		matchedObjects:  make(map[string]map[string]string),
+		statusChanged:   make(map[string]bool),
+		forecasts:       make(map[string]*metrics.Forecast),
+		lastSkip:        make(map[string]string),
+	}
+
+	for _, policy := range policies {
+		c.storagePolicies[policy.Name] = policy
+	}
+
+	return c, recorder
+}
+
+// events drains the events recorded so far
+func events(recorder *record.FakeRecorder) []string {
+	recorded := make([]string, 0)
+	for {
+		select {
+		case event := <-recorder.Events:
+			recorded = append(recorded, event)
+		default:
+			return recorded
+		}
+	}
+}
+
+func newPolicy(name string, enforcement autopilot.EnforcementType, weight int64) *autopilot.StoragePolicy {
+	return &autopilot.StoragePolicy{
+		ObjectMeta: meta.ObjectMeta{Name: name},
+		Spec: autopilot.StoragePolicySpec{
+			Enforcement: enforcement,
+			Weight:      weight,
+			Action:      autopilot.PolicyAction{Name: resizeAction},
+		},
+	}
+}
+
+func TestEnforcementOf(t *testing.T) {
+	tests := []struct {
+		enforcement autopilot.EnforcementType
+		expected    autopilot.EnforcementType
+	}{
+		{enforcement: "", expected: autopilot.EnforcementRequired},
+		{enforcement: autopilot.EnforcementRequired, expected: autopilot.EnforcementRequired},
+		{enforcement: autopilot.EnforcementPreferred, expected: autopilot.EnforcementPreferred},
+		{enforcement: "unknown", expected: autopilot.EnforcementRequired},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, enforcementOf(newPolicy("p", test.enforcement, 0)),
+			"Unexpected enforcement of %q", test.enforcement)
+	}
+}
+
+func TestHasValidMode(t *testing.T) {
+	tests := []struct {
+		mode     autopilot.PolicyMode
+		expected bool
+	}{
+		{mode: "", expected: true},
+		{mode: autopilot.PolicyModeEnforce, expected: true},
+		{mode: autopilot.PolicyModeObserve, expected: true},
+		{mode: "Observe", expected: false},
+		{mode: "observed", expected: false},
+	}
+
+	for _, test := range tests {
+		policy := newPolicy("p", "", 0)
+		policy.Spec.Mode = test.mode
+		c, recorder := newTestController(policy)
+
+		// the policy is checked on every poll cycle
+		for cycle := 0; cycle < 2; cycle++ {
+			require.Equal(t, test.expected, c.hasValidMode(policy), "Unexpected validity of mode %q", test.mode)
+		}
+
+		expected := []string{}
+		if !test.expected {
+			expected = []string{string(autopilot.StoragePolicyInvalid)}
+		}
+		require.Equal(t, expected, reasons(events(recorder)), "Expected mode %q to be reported once", test.mode)
+	}
+
+	policy := newPolicy("p", "", 0)
+	policy.Spec.Mode = "observed"
+	c, recorder := newTestController(policy)
+	require.False(t, c.hasValidMode(policy))
+
+	// a new version of the policy is checked again
+	updated := policy.DeepCopy()
+	updated.ResourceVersion = "2"
+	require.False(t, c.hasValidMode(updated))
+	require.Len(t, events(recorder), 2, "Expected the new version to be reported")
+
+	updated = updated.DeepCopy()
+	updated.Spec.Mode = autopilot.PolicyModeObserve
+	require.True(t, c.hasValidMode(updated))
+	require.Empty(t, c.invalidModes, "Expected the fixed policy to be forgotten")
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     *autopilot.StoragePolicy
+		expected bool
+	}{
+		{
+			name:     "required over preferred",
+			a:        newPolicy("a", autopilot.EnforcementRequired, 0),
+			b:        newPolicy("b", autopilot.EnforcementPreferred, 100),
+			expected: true,
+		},
+		{
+			name:     "default enforcement is required",
+			a:        newPolicy("a", "", 0),
+			b:        newPolicy("b", autopilot.EnforcementPreferred, 100),
+			expected: true,
+		},
+		{
+			name:     "preferred under required",
+			a:        newPolicy("a", autopilot.EnforcementPreferred, 100),
+			b:        newPolicy("b", autopilot.EnforcementRequired, 0),
+			expected: false,
+		},
+		{
+			name:     "higher weight",
+			a:        newPolicy("a", autopilot.EnforcementPreferred, 10),
+			b:        newPolicy("b", autopilot.EnforcementPreferred, 5),
+			expected: true,
+		},
+		{
+			name:     "lower weight",
+			a:        newPolicy("a", autopilot.EnforcementRequired, 5),
+			b:        newPolicy("b", autopilot.EnforcementRequired, 10),
+			expected: false,
+		},
+		{
+			name:     "tie broken by name",
+			a:        newPolicy("a", autopilot.EnforcementRequired, 5),
+			b:        newPolicy("b", autopilot.EnforcementRequired, 5),
+			expected: true,
+		},
+		{
+			name:     "tie broken by name, reversed",
+			a:        newPolicy("b", autopilot.EnforcementRequired, 5),
+			b:        newPolicy("a", autopilot.EnforcementRequired, 5),
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, outranks(test.a, test.b), test.name)
+	}
+}
+
+func TestActionClass(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected string
+	}{
+		{action: resizeAction, expected: "openstorage.io.action.volume"},
+		{action: moveAction, expected: "openstorage.io.action.volume"},
+		{action: expandAction, expected: "openstorage.io.action.storagepool"},
+		{action: "custom-action", expected: "custom-action"},
+	}
+
+	for _, test := range tests {
+		policy := newPolicy("p", "", 0)
+		policy.Spec.Action.Name = test.action
+		require.Equal(t, test.expected, actionClass(policy), "Unexpected class of %s", test.action)
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	observed := newPolicy("observed", autopilot.EnforcementRequired, 100)
+	observed.Spec.Mode = autopilot.PolicyModeObserve
+	move := newPolicy("move", autopilot.EnforcementPreferred, 100)
+	move.Spec.Action.Name = moveAction
+	expand := newPolicy("expand", autopilot.EnforcementPreferred, 0)
+	expand.Spec.Action.Name = expandAction
+
+	tests := []struct {
+		name     string
+		matches  []*policyMatch
+		expected []string
+		skipped  int
+	}{
+		{
+			name: "single policy",
+			matches: []*policyMatch{
+				{policy: newPolicy("only", "", 0), object: "vol-1"},
+			},
+			expected: []string{"only/vol-1"},
+		},
+		{
+			name: "required wins over a heavier preferred",
+			matches: []*policyMatch{
+				{policy: newPolicy("preferred", autopilot.EnforcementPreferred, 100), object: "vol-1"},
+				{policy: newPolicy("required", autopilot.EnforcementRequired, 1), object: "vol-1"},
+			},
+			expected: []string{"required/vol-1"},
+			skipped:  1,
+		},
+		{
+			name: "heaviest of the same enforcement wins",
+			matches: []*policyMatch{
+				{policy: newPolicy("light", "", 1), object: "vol-1"},
+				{policy: newPolicy("heavy", "", 10), object: "vol-1"},
+				{policy: newPolicy("medium", "", 5), object: "vol-1"},
+			},
+			expected: []string{"heavy/vol-1"},
+			skipped:  2,
+		},
+		{
+			name: "different objects don't conflict",
+			matches: []*policyMatch{
+				{policy: newPolicy("light", "", 1), object: "vol-1"},
+				{policy: newPolicy("heavy", "", 10), object: "vol-2"},
+			},
+			expected: []string{"light/vol-1", "heavy/vol-2"},
+		},
+		{
+			name: "actions of the same class conflict",
+			matches: []*policyMatch{
+				{policy: move, object: "vol-1"},
+				{policy: newPolicy("resize", "", 10), object: "vol-1"},
+			},
+			expected: []string{"resize/vol-1"},
+			skipped:  1,
+		},
+		{
+			name: "different action classes don't conflict",
+			matches: []*policyMatch{
+				{policy: newPolicy("resize", "", 10), object: "vol-1"},
+				{policy: expand, object: "vol-1"},
+			},
+			expected: []string{"resize/vol-1", "expand/vol-1"},
+		},
+		{
+			name: "observed policies never conflict",
+			matches: []*policyMatch{
+				{policy: observed, object: "vol-1"},
+				{policy: newPolicy("enforced", "", 1), object: "vol-1"},
+			},
+			expected: []string{"observed/vol-1", "enforced/vol-1"},
+		},
+	}
+
+	for _, test := range tests {
+		c, recorder := newTestController()
+
+		resolved := c.resolveConflicts(test.matches)
+		actual := make([]string, 0, len(resolved))
+		for _, match := range resolved {
+			actual = append(actual, match.policy.Name+"/"+match.object)
+		}
+		require.Equal(t, test.expected, actual, test.name)
+
+		skipped := 0
+		recorded := events(recorder)
+		for _, event := range recorded {
+			if strings.Fields(event)[1] == string(autopilot.StoragePolicyActionSkipped) {
+				skipped++
+			}
+		}
+		require.Equal(t, test.skipped, skipped, "%s: unexpected skip events %v", test.name, recorded)
+	}
+}
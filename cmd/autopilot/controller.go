@@ -18,20 +18,26 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sync"
 	"time"
 
 	"github.com/kubernetes/client-go/tools/record"
+	"github.com/libopenstorage/autopilot/audit"
 	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/metrics"
 	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot"
 	autopilotv1 "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
 	"github.com/libopenstorage/autopilot/pkg/probation"
 	"github.com/libopenstorage/stork/pkg/controller"
 	"github.com/sirupsen/logrus"
 
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -44,23 +50,80 @@ type crdController struct {
 	storagePolicies map[string]*autopilotv1.StoragePolicy
 	spLock          sync.Mutex
 	recorder        record.EventRecorder
-	cfg             *config.Config
+	k8sClient       kubernetes.Interface
+
+	// recorder that sends the policy events to the notifiers, same as recorder
+	notifications *notifyingRecorder
+
+	// audit log of the policy decisions, nil if disabled
+	audit *audit.Log
+	// reason of the last skip recorded in the audit log for every policy and
+	// object, guarded by auditLock since decisions are recorded while actions
+	// are verified without the controller lock
+	lastSkip  map[string]string
+	auditLock sync.Mutex
+
+	// configuration, swapped when the configuration file is reloaded
+	cfg     *config.Config
+	cfgLock sync.RWMutex
+
+	// metrics providers in use, replaced when the configuration is reloaded, guarded by spLock
+	providers map[string]metrics.Provider
+
+	// last known health of the metrics providers and the time it changed, guarded by spLock
+	providerHealth      map[string]bool
+	providerTransitions map[string]time.Time
+
+	// last seen AutopilotConfig, guarded by resourceLock since it is handled
+	// without the controller lock. The poll loop is notified of its changes.
+	configResource        *autopilotv1.AutopilotConfig
+	configResourceChanged chan struct{}
+	resourceLock          sync.Mutex
+
+	// AutopilotConfig settings in use and their status, guarded by spLock
+	usingConfigResource bool
+	configError         string
+	configStatusChanged bool
+
+	// actions deferred by the policy schedules, guarded by spLock
+	pendingActions map[string]*pendingAction
+
+	// parsed schedule of every policy version, guarded by spLock
+	schedules map[string]*parsedSchedule
+
+	// version of the policies skipped for an unknown mode, guarded by spLock
+	invalidModes map[string]string
+
+	// evaluation trees of the objects matched by each policy, guarded by spLock
+	matchedObjects map[string]map[string]string
+
+	// policies whose status needs to be published, guarded by spLock
+	statusChanged map[string]bool
+
+	// forecasts of the objects matched in the current poll cycle, guarded by spLock
+	forecasts map[string]*metrics.Forecast
 
 	// probation
 	probation          probation.Probation
 	objectsInProbation map[string]interface{}
+	objectsVerifying   map[string]string
 	probationLock      sync.Mutex
 }
 
 // Handle updates for StoragePolicy objects
 func (c *crdController) Handle(ctx context.Context, event sdk.Event) error {
 	switch o := event.Object.(type) {
+	case *autopilotv1.AutopilotConfig:
+		c.handleConfigResource(o, event.Deleted)
 	case *autopilotv1.StoragePolicy:
 		c.spLock.Lock()
 		defer c.spLock.Unlock()
 
 		if event.Deleted {
 			delete(c.storagePolicies, o.Name)
+			delete(c.schedules, o.Name)
+			delete(c.invalidModes, o.Name)
+			log.SetStoragePolicyTraceID(o, "")
 			logrus.Infof("policy %s/%s/%s deleted", o.APIVersion, o.Kind, o.Name)
 		} else {
 			if tmp, ok := c.storagePolicies[o.Name]; !ok {
@@ -75,29 +138,51 @@ func (c *crdController) Handle(ctx context.Context, event sdk.Event) error {
 	return nil
 }
 
-func newController(recorder record.EventRecorder, cfg *config.Config) *crdController {
+func newController(recorder record.EventRecorder, cfg *config.Config, k8sClient kubernetes.Interface) *crdController {
+	notifications := &notifyingRecorder{EventRecorder: recorder}
 	c := &crdController{
-		storagePolicies:    make(map[string]*autopilotv1.StoragePolicy),
-		recorder:           recorder,
-		cfg:                cfg,
-		objectsInProbation: make(map[string]interface{}),
+		storagePolicies:       make(map[string]*autopilotv1.StoragePolicy),
+		recorder:              notifications,
+		notifications:         notifications,
+		cfg:                   cfg,
+		k8sClient:             k8sClient,
+		providerHealth:        make(map[string]bool),
+		providerTransitions:   make(map[string]time.Time),
+		configResourceChanged: make(chan struct{}, 1),
+		pendingActions:        make(map[string]*pendingAction),
+		schedules:             make(map[string]*parsedSchedule),
+		invalidModes:          make(map[string]string),
+		matchedObjects:        make(map[string]map[string]string),
+		statusChanged:         make(map[string]bool),
+		forecasts:             make(map[string]*metrics.Forecast),
+		objectsInProbation:    make(map[string]interface{}),
+		objectsVerifying:      make(map[string]string),
+		lastSkip:              make(map[string]string),
 	}
 
-	cooldownPeriod := cfg.CooldownPeriod
-	if cooldownPeriod == 0 {
-		cooldownPeriod = defaultCooldownPeriod
-	}
+	logrus.Infof("Autopilot using cool down period of: %v", cooldownPeriod(cfg))
 
-	logrus.Infof("Autopilot using cool down period of: %d seconds", cooldownPeriod)
+	if cfg.DryRun {
+		logrus.Infof("Autopilot running in dry-run mode, no policy actions will be executed")
+	}
 
 	c.probation = probation.NewProbationManager(
 		"policy-action-cooldown",
-		time.Duration(cooldownPeriod)*time.Second,
+		cooldownPeriod(cfg),
 		c.objectCoolDownEvent)
 
 	return c
 }
 
+// cooldownPeriod returns the time an object stays in cool down after a policy action
+func cooldownPeriod(cfg *config.Config) time.Duration {
+	if cfg.CooldownPeriod == 0 {
+		return defaultCooldownPeriod * time.Second
+	}
+
+	return time.Duration(cfg.CooldownPeriod) * time.Second
+}
+
 func (c *crdController) start() error {
 	if err := controller.Init(); err != nil {
 		return err
@@ -115,6 +200,18 @@ func (c *crdController) start() error {
 		return err
 	}
 
+	if err := controller.Register(
+		&schema.GroupVersionKind{
+			Group:   autopilot.GroupName,
+			Version: autopilot.Version,
+			Kind:    reflect.TypeOf(autopilotv1.AutopilotConfig{}).Name(),
+		},
+		"",
+		resyncPeriod,
+		c); err != nil {
+		return err
+	}
+
 	if err := c.probation.Start(); err != nil {
 		return err
 	}
@@ -130,11 +227,80 @@ func (c *crdController) unlock() {
 	c.spLock.Unlock()
 }
 
+// config returns the current configuration
+func (c *crdController) config() *config.Config {
+	c.cfgLock.RLock()
+	defer c.cfgLock.RUnlock()
+	return c.cfg
+}
+
+func (c *crdController) setConfig(cfg *config.Config) {
+	c.cfgLock.Lock()
+	defer c.cfgLock.Unlock()
+	c.cfg = cfg
+}
+
+// pollRate returns the poll rate of the current configuration
+func (c *crdController) pollRate() time.Duration {
+	// the configuration has been validated
+	rate, _ := time.ParseDuration(c.config().PollRate)
+	return rate
+}
+
+// isDryRun returns true if the actions for the given policy should only be
+// reported and not executed
+func (c *crdController) isDryRun(policy *autopilotv1.StoragePolicy) bool {
+	return c.config().DryRun || policy.Spec.Mode == autopilotv1.PolicyModeObserve
+}
+
+// hasValidMode returns false if the mode of the policy is unknown, the policy
+// is then skipped rather than enforced. The unknown mode is reported once per
+// policy version. The caller must hold the controller lock.
+func (c *crdController) hasValidMode(policy *autopilotv1.StoragePolicy) bool {
+	switch policy.Spec.Mode {
+	case "", autopilotv1.PolicyModeEnforce, autopilotv1.PolicyModeObserve:
+		delete(c.invalidModes, policy.Name)
+		return true
+	}
+
+	if version, ok := c.invalidModes[policy.Name]; ok && version == policy.ResourceVersion {
+		return false
+	}
+	c.invalidModes[policy.Name] = policy.ResourceVersion
+
+	msg := fmt.Sprintf("policy skipped, unknown mode %q, expected %s or %s",
+		policy.Spec.Mode, autopilotv1.PolicyModeEnforce, autopilotv1.PolicyModeObserve)
+	log.StoragePolicyLog(policy).Warnln(msg)
+	c.recorder.Event(policy,
+		api_v1.EventTypeWarning,
+		string(autopilotv1.StoragePolicyInvalid),
+		msg)
+	return false
+}
+
+// recordDryRunAction reports the action that would have been executed on the object
+func (c *crdController) recordDryRunAction(match *policyMatch) {
+	policy, object := match.policy, match.object
+	log.StoragePolicyLog(policy).Infof("dry-run: skipping action %s on object %s", policy.Spec.Action.Name, object)
+	msg := fmt.Sprintf("dry-run: action: %s would have been triggered on object: %s",
+		policy.Spec.Action.Name, object)
+	c.recorder.Event(policy,
+		api_v1.EventTypeNormal,
+		string(autopilotv1.StoragePolicyActionDryRun),
+		msg)
+
+	reason := audit.ReasonDryRun
+	if policy.Spec.Mode == autopilotv1.PolicyModeObserve {
+		reason = audit.ReasonObserve
+	}
+	c.auditDecision(match, audit.DecisionSkipped, reason, msg)
+}
+
 func (c *crdController) objectCoolDownEvent(
 	objectID string,
 	objectData interface{},
 ) error {
-	logrus.Infof("taking object: %s out of policy action cool down")
+	logrus.Infof("taking object: %s out of policy action cool down", objectID)
 	c.probationLock.Lock()
 	defer c.probationLock.Unlock()
 
@@ -19,22 +19,37 @@ const (
 )
 
 func crdInstallAction(c *cli.Context) error {
-
-	resource := k8s.CustomResource{
-		Name:    autopilotv1.StoragePolicyResourceName,
-		Plural:  autopilotv1.StoragePolicyResourcePlural,
-		Group:   autopilot.GroupName,
-		Version: autopilot.Version,
-		Scope:   apiextensionsv1beta1.NamespaceScoped,
-		Kind:    reflect.TypeOf(autopilotv1.StoragePolicy{}).Name(),
+	resources := []k8s.CustomResource{
+		{
+			Name:    autopilotv1.StoragePolicyResourceName,
+			Plural:  autopilotv1.StoragePolicyResourcePlural,
+			Group:   autopilot.GroupName,
+			Version: autopilot.Version,
+			Scope:   apiextensionsv1beta1.NamespaceScoped,
+			Kind:    reflect.TypeOf(autopilotv1.StoragePolicy{}).Name(),
+		},
+		{
+			Name:    autopilotv1.AutopilotConfigResourceName,
+			Plural:  autopilotv1.AutopilotConfigResourcePlural,
+			Group:   autopilot.GroupName,
+			Version: autopilot.Version,
+			Scope:   apiextensionsv1beta1.ClusterScoped,
+			Kind:    reflect.TypeOf(autopilotv1.AutopilotConfig{}).Name(),
+		},
 	}
 
-	err := k8s.Instance().CreateCRD(resource)
-	if err != nil && !errors.IsAlreadyExists(err) {
-		return err
-	}
+	for _, resource := range resources {
+		err := k8s.Instance().CreateCRD(resource)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
 
-	log.Debugf("%s crd installed successfully", resource.Name)
+		log.Debugf("%s crd installed successfully", resource.Name)
+
+		if err := k8s.Instance().ValidateCRD(resource, validateCRDTimeout, validateCRDInterval); err != nil {
+			return err
+		}
+	}
 
-	return k8s.Instance().ValidateCRD(resource, validateCRDTimeout, validateCRDInterval)
+	return nil
 }
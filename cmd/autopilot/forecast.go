@@ -0,0 +1,82 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const gib = 1 << 30
+
+// objectForecast returns the forecast that reaches its limit first among the
+// vectors of an object, or nil if none of them carry a forecast
+func objectForecast(vecs []metrics.Vector) *metrics.Forecast {
+	var soonest *metrics.Forecast
+	for _, vec := range vecs {
+		if vec.Forecast == nil {
+			continue
+		}
+
+		if soonest == nil || vec.Forecast.TimeToLimit() < soonest.TimeToLimit() {
+			soonest = vec.Forecast
+		}
+	}
+
+	return soonest
+}
+
+// forecastSize returns the size the volume needs to stay below the forecast
+// limit until the horizon of the resize action. The forecast key is expected
+// to be relative to the size of the volume, such as its usage percentage. The
+// current size is returned if the policy has no forecast for the volume.
+func (c *crdController) forecastSize(
+	policy *autopilot.StoragePolicy,
+	volumeID string,
+	current resource.Quantity,
+	horizon string,
+) (resource.Quantity, error) {
+	d, err := time.ParseDuration(horizon)
+	if err != nil || d <= 0 {
+		return current, fmt.Errorf("invalid %s param %q", autopilot.PolicyActionVolumeResizeParamHorizon, horizon)
+	}
+
+	forecast := c.forecasts[pendingKey(policy, volumeID)]
+	if forecast == nil {
+		log.StoragePolicyLog(policy).Debugf("no forecast for volume %s, using the default resize", volumeID)
+		return current, nil
+	}
+
+	projected := forecast.ValueAt(d)
+	if projected <= forecast.Limit {
+		return current, nil
+	}
+
+	needed := float64(current.Value()) * projected / forecast.Limit
+	size := resource.NewQuantity(int64(math.Ceil(needed/gib))*gib, resource.BinarySI)
+
+	log.StoragePolicyLog(policy).Infof("volume %s is projected at %.2f of %.2f in %v, sizing it to %s",
+		volumeID, projected, forecast.Limit, d, size.String())
+
+	return *size, nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/pkg/client/clientset/versioned"
+	"github.com/sirupsen/logrus"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// defaultLivenessPollCycles is the number of poll rates without a completed
+	// poll cycle after which autopilot is not live
+	defaultLivenessPollCycles = 10
+
+	syncCheckInterval = 2 * time.Second
+
+	// readyPollCycles is the number of poll rates within which a metrics
+	// provider must have answered a query for autopilot to be ready
+	readyPollCycles = 3
+)
+
+// health is the state reported by the /healthz and /readyz endpoints. It is
+// updated by the poll loop and read without the controller lock, so the
+// endpoints answer while the poll loop is wedged.
+type health struct {
+	mu sync.Mutex
+
+	crdsValidated bool
+	synced        bool
+	// providers that answered a query recently at the end of the last poll cycle
+	reachable int
+
+	lastPoll      time.Time
+	pollRate      time.Duration
+	livenessLimit int
+}
+
+func newHealth(pollRate time.Duration, livenessLimit int) *health {
+	if livenessLimit <= 0 {
+		livenessLimit = defaultLivenessPollCycles
+	}
+
+	return &health{
+		// the first poll cycle is given the same time as the later ones
+		lastPoll:      time.Now(),
+		pollRate:      pollRate,
+		livenessLimit: livenessLimit,
+	}
+}
+
+func (h *health) setCRDsValidated() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.crdsValidated = true
+}
+
+func (h *health) setSynced() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.synced = true
+}
+
+func (h *health) setPollRate(pollRate time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pollRate = pollRate
+}
+
+// pollCompleted records the end of a poll cycle and the number of providers
+// that answered a query recently
+func (h *health) pollCompleted(reachable int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPoll = time.Now()
+	h.reachable = reachable
+}
+
+// live returns an error if no poll cycle completed within the liveness limit
+func (h *health) live() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	limit := time.Duration(h.livenessLimit) * h.pollRate
+	if since := time.Since(h.lastPoll); since > limit {
+		return fmt.Errorf("no poll cycle completed for %v, the limit is %v", since.Round(time.Second), limit)
+	}
+
+	return nil
+}
+
+// ready returns the reasons autopilot is not ready, none if it is
+func (h *health) ready() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reasons := make([]string, 0)
+	if !h.crdsValidated {
+		reasons = append(reasons, "the crds are not validated")
+	}
+
+	if !h.synced {
+		reasons = append(reasons, "the storage policies are not synced")
+	}
+
+	if h.reachable == 0 {
+		reasons = append(reasons, "no metrics provider answered a query recently")
+	}
+
+	return reasons
+}
+
+func (h *health) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := h.live(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *health) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	if reasons := h.ready(); len(reasons) > 0 {
+		http.Error(w, strings.Join(reasons, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// reachableProviders returns the number of providers that answered a query
+// within the last few poll cycles. A closed circuit breaker doesn't make a
+// provider reachable, it is closed before the first query. Without storage
+// policies no query runs, the providers whose breaker is closed are counted
+// then. The caller must hold the controller lock.
+func (c *crdController) reachableProviders() int {
+	recent := time.Now().Add(-readyPollCycles * c.pollRate())
+	reachable := 0
+	for _, prov := range c.providers {
+		reporter, ok := prov.(metrics.HealthReporter)
+		if !ok {
+			continue
+		}
+
+		if len(c.storagePolicies) == 0 {
+			if reporter.Healthy() {
+				reachable++
+			}
+			continue
+		}
+
+		if reporter.LastSuccess().After(recent) {
+			reachable++
+		}
+	}
+
+	return reachable
+}
+
+// waitForSync waits in the background until the controller has received all
+// the storage policies of the cluster, then marks autopilot as synced
+func (c *crdController) waitForSync(client versioned.Interface, h *health) {
+	go func() {
+		wait.PollInfinite(syncCheckInterval, func() (bool, error) {
+			policies, err := client.AutopilotV1alpha1().StoragePolicies().List(meta.ListOptions{})
+			if err != nil {
+				logrus.Warnf("failed to list the storage policies: %v", err)
+				return false, nil
+			}
+
+			c.lock()
+			defer c.unlock()
+			for _, policy := range policies.Items {
+				if _, ok := c.storagePolicies[policy.Name]; !ok {
+					return false, nil
+				}
+			}
+
+			logrus.Infof("synced %d storage policies", len(policies.Items))
+			h.setSynced()
+			return true, nil
+		})
+	}()
+}
@@ -24,11 +24,11 @@ import (
 	"time"
 
 	"github.com/kubernetes/kubernetes/pkg/api/legacyscheme"
+	"github.com/libopenstorage/autopilot/audit"
 	"github.com/libopenstorage/autopilot/config"
-	"github.com/libopenstorage/autopilot/metrics"
 	_ "github.com/libopenstorage/autopilot/metrics/providers"
-	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
-	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/client/clientset/versioned"
+	"github.com/libopenstorage/autopilot/pkg/trace"
 	"github.com/libopenstorage/autopilot/pkg/version"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -86,6 +86,50 @@ func main() {
 			Usage:  "set the kubernetes master url",
 			EnvVar: "KUBERNETES_MASTER_URL",
 		},
+		cli.StringFlag{
+			Name:   "http-listen",
+			Usage:  "set the address of the autopilot /metrics, /healthz and /readyz endpoints",
+			EnvVar: "HTTP_LISTEN",
+			Value:  ":9628",
+		},
+		cli.IntFlag{
+			Name:   "liveness-poll-cycles",
+			Usage:  "set the number of poll rates without a completed poll cycle after which /healthz fails",
+			EnvVar: "LIVENESS_POLL_CYCLES",
+			Value:  defaultLivenessPollCycles,
+		},
+		cli.IntFlag{
+			Name:   "audit-max-size",
+			Usage:  "set the size in megabytes of the audit log in the data directory that triggers a rotation",
+			EnvVar: "AUDIT_MAX_SIZE",
+			Value:  audit.DefaultMaxSize / (1024 * 1024),
+		},
+		cli.IntFlag{
+			Name:   "audit-max-files",
+			Usage:  "set the number of rotated audit log files kept",
+			EnvVar: "AUDIT_MAX_FILES",
+			Value:  audit.DefaultMaxFiles,
+		},
+		cli.BoolFlag{
+			Name:   "audit-hash-chain",
+			Usage:  "chain every audit log record to the previous one by its hash, so that changes to the log are detected",
+			EnvVar: "AUDIT_HASH_CHAIN",
+		},
+		cli.StringFlag{
+			Name:   "otlp-endpoint",
+			Usage:  "set the OTLP/HTTP endpoint of the OpenTelemetry collector the traces are exported to, such as http://otel-collector:4318. Tracing is disabled if empty",
+			EnvVar: "OTEL_EXPORTER_OTLP_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "otlp-headers",
+			Usage:  "set the headers of the trace exports as comma separated key=value pairs",
+			EnvVar: "OTEL_EXPORTER_OTLP_HEADERS",
+		},
+		cli.BoolFlag{
+			Name:   "dry-run",
+			Usage:  "evaluate the policies without running any of the policy actions",
+			EnvVar: "DRY_RUN",
+		},
 	}
 
 	app.Before = setupLog
@@ -99,15 +143,37 @@ func main() {
 			return err
 		}
 
+		if c.GlobalBool("dry-run") {
+			cfg.DryRun = true
+		}
+
+		if err := validateConfig(cfg); err != nil {
+			return err
+		}
+
+		if err := resolveSecrets(cfg); err != nil {
+			return err
+		}
+
+		headers, err := trace.ParseHeaders(c.GlobalString("otlp-headers"))
+		if err != nil {
+			return err
+		}
+
+		if err := trace.Init(c.GlobalString("otlp-endpoint"), headers, eventComponentName, app.Version); err != nil {
+			return err
+		}
+		defer trace.Shutdown()
+
 		signal.Notify(shutdown, syscall.SIGTERM)
 		signal.Notify(shutdown, syscall.SIGINT)
 
-		config, err := rest.InClusterConfig()
+		restConfig, err := rest.InClusterConfig()
 		if err != nil {
 			logrus.Fatalf("Error getting cluster config: %v", err)
 		}
 
-		k8sClient, err := clientset.NewForConfig(config)
+		k8sClient, err := clientset.NewForConfig(restConfig)
 		if err != nil {
 			logrus.Fatalf("Error getting client, %v", err)
 		}
@@ -116,106 +182,127 @@ func main() {
 		eventBroadcaster.StartRecordingToSink(&v1.EventSinkImpl{Interface: v1.New(k8sClient.CoreV1().RESTClient()).Events("")})
 		recorder := eventBroadcaster.NewRecorder(legacyscheme.Scheme, api_v1.EventSource{Component: eventComponentName})
 
-		// install our CRD
-		if err := crdInstallAction(c); err != nil {
+		autopilotClient, err := versioned.NewForConfig(restConfig)
+		if err != nil {
+			logrus.Fatalf("Error getting autopilot client, %v", err)
+		}
+
+		controller := newController(recorder, cfg, k8sClient)
+		auditLog, err := openAuditLog(c)
+		if err != nil {
 			return err
 		}
+		defer auditLog.Close()
+		controller.audit = auditLog
 
-		controller := newController(recorder, cfg)
+		dispatcher, err := newDispatcher(cfg)
+		if err != nil {
+			return err
+		}
+		controller.notifications.setDispatcher(dispatcher)
+		pollRate := controller.pollRate()
+		h := newHealth(pollRate, c.GlobalInt("liveness-poll-cycles"))
+		controller.registerMetrics()
+		serveHTTP(c.GlobalString("http-listen"), h)
 
-		// start the controller
-		if err := controller.start(); err != nil {
+		// install our CRD
+		if err := crdInstallAction(c); err != nil {
 			return err
 		}
+		h.setCRDsValidated()
 
-		pollRate, err := time.ParseDuration(cfg.PollRate)
-		if err != nil {
+		// start the controller
+		if err := controller.start(); err != nil {
 			return err
 		}
+		controller.waitForSync(autopilotClient, h)
 
 		logrus.Infof("starting the metrics poller (%s)", cfg.PollRate)
 
 		ticker := sparks.NewTicker(pollRate)
 
-		provs := make(map[string]metrics.Provider)
+		provs, err := newProviders(cfg)
+		if err != nil {
+			return err
+		}
+		controller.lock()
+		controller.providers = provs
+		controller.unlock()
 
-		for _, prov := range cfg.Providers {
-			inst, err := metrics.NewProvider(prov.Type, prov.Params)
-			if err != nil {
-				return err
-			}
+		trig := newTriggers()
+		trig.watch(provs)
 
-			provs[prov.Name] = inst
-		}
+		stopWatch := make(chan struct{})
+		defer close(stopWatch)
+		configChanged := config.Watch(c.GlobalString("config"), configWatchInterval, stopWatch)
 
 		for {
 			select {
 			case <-ticker.C():
 				controller.lock()
-
-				for name, prov := range provs {
-					for _, pol := range controller.storagePolicies {
-						vecs, err := prov.Query(pol)
-						if err != nil {
-							log.StoragePolicyLog(pol).Errorln(err)
-							continue
-						}
-
-						if len(vecs) == 0 {
-							log.StoragePolicyLog(pol).Debugf("no vectors matched")
-							break
-						}
-
-						log.StoragePolicyLog(pol).Debugf("has %d match(es) on provider %s", len(vecs), name)
-						objects, err := getObjectsForPolicy(pol)
-						if err != nil {
-							log.StoragePolicyLog(pol).Errorf(err.Error())
-							return err
-						}
-
-						for _, object := range objects {
-							if isConditionMetOnObject(object, vecs) {
-								// TODO improve this
-								conditionStr := ""
-								for i, cond := range pol.Spec.Conditions {
-									conditionStr = conditionStr + fmt.Sprintf("%d => %s %s %s\t", i+1, cond.Key, cond.Operator, cond.Values)
-								}
-								controller.recorder.Event(pol,
-									api_v1.EventTypeNormal,
-									string(autopilot.StoragePolicyConditonMet),
-									fmt.Sprintf("conditions: %s met on object: %s",
-										conditionStr, object))
-
-								if controller.isObjectInCoolDown(object) {
-									continue
-								}
-
-								if err := controller.executePolicyAction(pol, object); err != nil {
-									log.StoragePolicyLog(pol).Errorln(err)
-									controller.recorder.Event(pol,
-										api_v1.EventTypeWarning,
-										string(autopilot.StoragePolicyActionFailed),
-										err.Error())
-									return err
-								}
-
-								if err := controller.markObjectForCoolDown(object); err != nil {
-									log.StoragePolicyLog(pol).Errorln(err)
-									controller.recorder.Event(pol,
-										api_v1.EventTypeWarning,
-										string(autopilot.StoragePolicyActionFailed),
-										err.Error())
-									return err
-								}
-							} else {
-								log.StoragePolicyLog(pol).Debugf("condition not met for object: %v", object)
-							}
-						}
-					}
+				err := controller.evaluatePolicies(provs)
+				reachable := controller.reachableProviders()
+				controller.unlock()
+				if err != nil {
+					return err
 				}
+
+				h.pollCompleted(reachable)
+
+				ticker.Reset()
+
+			case <-trig.C:
+				logrus.Infof("evaluating the policies on provider trigger")
+				controller.lock()
+				err := controller.evaluatePolicies(provs)
+				reachable := controller.reachableProviders()
 				controller.unlock()
+				if err != nil {
+					return err
+				}
+
+				h.pollCompleted(reachable)
+
 				ticker.Reset()
 
+			case <-configChanged:
+				logrus.Infof("configuration file %s changed, reloading", c.GlobalString("config"))
+				controller.lock()
+				next, err := controller.reloadConfig(c.GlobalString("config"), c.GlobalBool("dry-run"), provs)
+				controller.providers = next
+				controller.unlock()
+				provs = next
+				trig.watch(provs)
+				if err != nil {
+					continue
+				}
+
+				if rate := controller.pollRate(); rate != pollRate {
+					logrus.Infof("restarting the metrics poller (%v)", rate)
+					pollRate = rate
+					ticker = sparks.NewTicker(pollRate)
+					h.setPollRate(pollRate)
+				}
+
+			case <-controller.configResourceChanged:
+				controller.lock()
+				next, err := controller.reloadConfigResource(c.GlobalString("config"), c.GlobalBool("dry-run"), provs)
+				controller.syncConfigStatus()
+				controller.providers = next
+				controller.unlock()
+				provs = next
+				trig.watch(provs)
+				if err != nil {
+					continue
+				}
+
+				if rate := controller.pollRate(); rate != pollRate {
+					logrus.Infof("restarting the metrics poller (%v)", rate)
+					pollRate = rate
+					ticker = sparks.NewTicker(pollRate)
+					h.setPollRate(pollRate)
+				}
+
 			case <-shutdown:
 				logrus.Infof("shutting down")
 				return nil
@@ -235,6 +322,49 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:  "config",
+			Usage: "Manage the auto-pilot configuration",
+			Subcommands: []cli.Command{
+				{
+					Name:      "validate",
+					Action:    configValidateAction,
+					Usage:     "Validate a configuration file and report every problem",
+					UsageText: "validate [file]",
+				},
+			},
+		},
+		{
+			Name:   "audit",
+			Usage:  "Query the audit log of the policy decisions in the data directory",
+			Action: auditAction,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "policy",
+					Usage: "select the records of the policies matching the name pattern",
+				},
+				cli.StringFlag{
+					Name:  "object",
+					Usage: "select the records of the object",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "select the records after an RFC3339 time or a duration ago such as 24h",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "select the records before an RFC3339 time or a duration ago such as 1h",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the records as JSON lines with their inputs",
+				},
+				cli.BoolFlag{
+					Name:  "verify",
+					Usage: "verify the hash chain of the audit log",
+				},
+			},
+		},
 		{
 			Name:  "policy",
 			Usage: "Manage auto-pilot policy objects",
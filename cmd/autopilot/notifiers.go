@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/notify"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// traceIDAnnotation is the event annotation of the trace ID of the policy evaluation
+const traceIDAnnotation = "autopilot.libopenstorage.org/trace-id"
+
+// newDispatcher creates the dispatcher of the notifiers of the configuration.
+// The dispatcher is not started.
+func newDispatcher(cfg *config.Config) (*notify.Dispatcher, error) {
+	d := notify.NewDispatcher()
+	for _, n := range cfg.Notifiers {
+		route := notify.Route{
+			Policies: n.Policies,
+			Reasons:  n.Events,
+		}
+
+		if len(n.Severity) > 0 {
+			severity, err := notify.ParseSeverity(n.Severity)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %s: %v", n.Name, err)
+			}
+			route.MinSeverity = severity
+		}
+
+		if len(n.DedupWindow) > 0 {
+			window, err := time.ParseDuration(n.DedupWindow)
+			if err != nil {
+				return nil, fmt.Errorf("notifier %s: invalid dedup window %q: %v", n.Name, n.DedupWindow, err)
+			}
+			route.DedupWindow = window
+		}
+
+		notifier, err := notify.NewNotifier(n.Type, n.Params)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %v", n.Name, err)
+		}
+
+		d.Add(n.Name, notifier, route)
+	}
+
+	return d, nil
+}
+
+// notifyingRecorder records the events, annotated with the trace ID of the
+// policies, and sends the notified events of the policies to the notifiers of
+// the configuration
+type notifyingRecorder struct {
+	record.EventRecorder
+
+	mu         sync.Mutex
+	dispatcher *notify.Dispatcher
+}
+
+// setDispatcher starts the dispatcher and swaps it in. The previous dispatcher
+// is closed in the background once its queued notifications are sent.
+func (r *notifyingRecorder) setDispatcher(d *notify.Dispatcher) {
+	d.Start()
+
+	r.mu.Lock()
+	prev := r.dispatcher
+	r.dispatcher = d
+	r.mu.Unlock()
+
+	if prev != nil {
+		go prev.Close()
+	}
+}
+
+// Event records the event and notifies it if it is a notified event of a policy
+func (r *notifyingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if policy, ok := object.(*autopilot.StoragePolicy); ok {
+		if traceID := log.StoragePolicyTraceID(policy); len(traceID) > 0 {
+			r.EventRecorder.AnnotatedEventf(object, map[string]string{traceIDAnnotation: traceID},
+				eventtype, reason, "%s", message)
+			r.notify(object, reason, message)
+			return
+		}
+	}
+
+	r.EventRecorder.Event(object, eventtype, reason, message)
+	r.notify(object, reason, message)
+}
+
+// AnnotatedEventf records the event with the given annotations and notifies it
+// if it is a notified event of a policy. A trace ID annotation is kept over the
+// trace ID of the current evaluation of the policy.
+func (r *notifyingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string,
+	eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	r.notify(object, reason, message)
+}
+
+// Eventf is like Event, but with a formatted message
+func (r *notifyingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *notifyingRecorder) notify(object runtime.Object, reason, message string) {
+	policy, ok := object.(*autopilot.StoragePolicy)
+	if !ok {
+		return
+	}
+
+	severity, ok := notify.Reasons[reason]
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.dispatcher == nil {
+		return
+	}
+
+	r.dispatcher.Notify(&notify.Notification{
+		Policy:    policy.Name,
+		Namespace: policy.Namespace,
+		Reason:    reason,
+		Severity:  severity,
+		Message:   message,
+		Time:      time.Now(),
+	})
+}
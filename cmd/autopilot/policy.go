@@ -17,35 +17,54 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/libopenstorage/autopilot/audit"
+	"github.com/libopenstorage/autopilot/config"
 	"github.com/libopenstorage/autopilot/metrics"
 	"github.com/portworx/sched-ops/k8s"
 	"github.com/sirupsen/logrus"
 
 	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
 	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/trace"
 	"github.com/urfave/cli"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
 )
 
 var policyActionNameRegex = regexp.MustCompile(`^(.+)/(.+)`)
 
+// policyTestAction evaluates a policy document against the configured
+// providers and prints the evaluation tree of every object returned by them.
+// No action is run.
 func policyTestAction(c *cli.Context) error {
-	/*cfg, err := config.ReadFile(c.GlobalString("config"))
+	cfg, err := config.ReadFile(c.GlobalString("config"))
 	if err != nil {
 		return err
 	}
 
+	if err := validateConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+
 	if c.NArg() < 1 {
 		return errors.New("missing policy document path")
 	}
 
-	path := c.Args().Get(0)
-
-	data, err := ioutil.ReadFile(path)
+	data, err := ioutil.ReadFile(c.Args().Get(0))
 	if err != nil {
 		return err
 	}
@@ -66,33 +85,265 @@ func policyTestAction(c *cli.Context) error {
 		return errors.New("invalid storage policy object")
 	}
 
-	for _, p := range cfg.Providers {
-		prov, err := metrics.NewProvider(p.Type, p.Params)
-		if err != nil {
-			return err
+	provs, err := newProviders(cfg)
+	if err != nil {
+		return err
+	}
+
+	vecs, err := queryPolicy(nil, provs, defaultProvider(cfg), policy)
+	if err != nil {
+		return err
+	}
+
+	results := metrics.NewResultSet(policy.Spec.Object.Type, len(policy.Spec.ConditionList()), vecs)
+	objects := results.Objects()
+	if len(objects) == 0 {
+		fmt.Println("no objects returned for the policy conditions")
+		return nil
+	}
+	sort.Strings(objects)
+
+	for _, object := range objects {
+		evaluation := results.Evaluate(&policy.Spec, object)
+		fmt.Printf("object: %s\n", object)
+		for _, line := range strings.Split(evaluation.String(), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+
+		if evaluation.Met {
+			fmt.Printf("action %s would run on object %s\n", policy.Spec.Action.Name, object)
+		}
+	}
+
+	return nil
+}
+
+// evaluatePolicies runs all the policies against the metrics providers and
+// executes the actions for the policies whose conditions are met
+func (c *crdController) evaluatePolicies(provs map[string]metrics.Provider) error {
+	cycle := trace.Start("poll.cycle", trace.Attr("policies", len(c.storagePolicies)))
+	defer cycle.End()
+
+	matches := make([]*policyMatch, 0)
+	evaluated := make(map[string]bool)
+	matched := make(map[string]map[string]string)
+	c.forecasts = make(map[string]*metrics.Forecast)
+
+	for _, pol := range c.storagePolicies {
+		if !c.hasValidMode(pol) {
+			continue
 		}
 
-		vecs, err := prov.Query(policy)
+		policyMatches, ok, err := c.evaluatePolicy(cycle, provs, pol, matched)
 		if err != nil {
+			cycle.RecordError(err)
 			return err
 		}
 
-		objects, err := getObjectsForPolicy(policy)
+		if ok {
+			evaluated[pol.Name] = true
+		}
+		matches = append(matches, policyMatches...)
+	}
+
+	c.checkProviderHealth(provs)
+
+	now := time.Now()
+	resolved := make(map[string]bool)
+	for _, match := range c.resolveConflicts(matches) {
+		resolved[pendingKey(match.policy, match.object)] = true
+
+		deferred, err := c.deferAction(match, now)
 		if err != nil {
-			return err
+			c.reportInvalidSchedule(match, err)
+			continue
 		}
 
-		for _, object := range objects {
-			if isConditionMetOnObject(object, vecs) {
-				// TODO offload this to a scheduled task
-				if err := executePolicyAction(policy, object); err != nil {
-					return err
-				}
-			}
+		if deferred {
+			continue
+		}
+
+		if err := c.runPolicyAction(match); err != nil {
+			log.StoragePolicyLog(match.policy).Errorf("failed to run action %s on object %s: %v",
+				match.policy.Spec.Action.Name, match.object, err)
+		}
+	}
+
+	c.expirePendingActions(resolved, evaluated)
+	c.expireAuditSkips(matches)
+	c.updateMatchedObjects(matched, evaluated)
+	c.syncPolicyStatus()
+	c.syncConfigStatus()
+
+	actionQueueDepth.Set(float64(len(c.pendingActions)))
+	lastSuccessfulPoll.SetToCurrentTime()
+
+	return nil
+}
+
+// evaluatePolicy evaluates the conditions of the policy on its objects and
+// returns the objects matched. It returns false if the policy could not be
+// evaluated. The evaluation is traced as a child of the poll cycle span.
+func (c *crdController) evaluatePolicy(
+	cycle *trace.Span,
+	provs map[string]metrics.Provider,
+	pol *autopilot.StoragePolicy,
+	matched map[string]map[string]string,
+) ([]*policyMatch, bool, error) {
+	span := cycle.Start("policy.evaluate", trace.Attr("policy.name", pol.Name))
+	defer span.End()
+	log.SetStoragePolicyTraceID(pol, span.TraceID())
+
+	start := time.Now()
+	vecs, err := queryPolicy(span, provs, c.defaultProvider(), pol)
+	if err == metrics.ErrProviderUnhealthy {
+		log.StoragePolicyLog(pol).Debugf("skipping policy with an unhealthy provider")
+		span.RecordError(err)
+		return nil, false, nil
+	}
+
+	if err != nil {
+		log.StoragePolicyLog(pol).Errorln(err)
+		span.RecordError(err)
+		return nil, false, nil
+	}
+
+	if len(vecs) == 0 && pol.Spec.Match == nil {
+		log.StoragePolicyLog(pol).Debugf("no vectors matched")
+		policyEvaluationDuration.WithLabelValues(pol.Name).Observe(time.Since(start).Seconds())
+		return nil, true, nil
+	}
 
-			logrus.Debugf("[debug] condition not met for policy: %s for object: %v", policy.Name, object)
+	log.StoragePolicyLog(pol).Debugf("has %d match(es)", len(vecs))
+	resolve := span.Start("objects.resolve",
+		trace.Attr("policy.name", pol.Name),
+		trace.Attr("object.type", string(pol.Spec.Object.Type)))
+	objects, err := getObjectsForPolicy(pol)
+	resolve.SetAttributes(trace.Attr("objects", len(objects)))
+	resolve.RecordError(err)
+	resolve.End()
+	if err != nil {
+		log.StoragePolicyLog(pol).Errorln(err)
+		span.RecordError(err)
+		return nil, true, err
+	}
+
+	matches := make([]*policyMatch, 0)
+	results := metrics.NewResultSet(pol.Spec.Object.Type, len(pol.Spec.ConditionList()), vecs)
+	for _, object := range objects {
+		evaluation := results.Evaluate(&pol.Spec, object)
+		if !evaluation.Met {
+			log.StoragePolicyLog(pol).Debugf("condition not met for object: %v", object)
+			continue
 		}
-	}*/
+
+		if matched[pol.Name] == nil {
+			matched[pol.Name] = make(map[string]string)
+		}
+		matched[pol.Name][object] = evaluation.String()
+
+		conditionsMet.WithLabelValues(pol.Name).Inc()
+		c.recorder.Event(pol,
+			v1.EventTypeNormal,
+			string(autopilot.StoragePolicyConditonMet),
+			fmt.Sprintf("conditions: %s met on object: %s",
+				evaluation.Compact(), object))
+
+		key := pendingKey(pol, object)
+		if forecast := objectForecast(results.Vectors(object)); forecast != nil {
+			c.forecasts[key] = forecast
+		}
+
+		matches = append(matches, &policyMatch{
+			policy:     pol,
+			object:     object,
+			evaluation: matched[pol.Name][object],
+			vectors:    results.Vectors(object),
+			span:       span,
+		})
+	}
+
+	span.SetAttributes(trace.Attr("objects", len(objects)), trace.Attr("matches", len(matches)))
+	policyEvaluationDuration.WithLabelValues(pol.Name).Observe(time.Since(start).Seconds())
+
+	return matches, true, nil
+}
+
+// runPolicyAction executes the action of the matched policy on the object
+// unless the object is in cool down or the policy is only observed. The outcome
+// of the action is verified in the background. A failed action puts the object
+// in cool down, so it is retried once the cool down expires.
+func (c *crdController) runPolicyAction(match *policyMatch) error {
+	pol, object := match.policy, match.object
+	if c.isObjectInCoolDown(object) {
+		c.auditDecision(match, audit.DecisionSkipped, audit.ReasonCooldown, "object in cool down")
+		return nil
+	}
+
+	if c.isObjectVerifying(object) {
+		c.auditDecision(match, audit.DecisionSkipped, audit.ReasonVerifying, "action on object being verified")
+		return nil
+	}
+
+	if c.isDryRun(pol) {
+		c.recordDryRunAction(match)
+		return nil
+	}
+
+	if c.isActionLimitReached(pol) {
+		log.StoragePolicyLog(pol).Infof("concurrency limit reached, action %s on object %s waits for the next poll",
+			pol.Spec.Action.Name, object)
+		c.auditDecision(match, audit.DecisionSkipped, audit.ReasonConcurrency, "concurrency limit reached")
+		return nil
+	}
+
+	span := match.span.Start("action.execute",
+		trace.Attr("policy.name", pol.Name),
+		trace.Attr("object.id", object),
+		trace.Attr("action.name", pol.Spec.Action.Name))
+	result, err := c.executePolicyAction(span, pol, object)
+	span.RecordError(err)
+	span.End()
+
+	if perr, ok := err.(*preflightError); ok {
+		// the action was rejected before it ran, hold off retrying it until the cool down expires
+		actionsFailed.WithLabelValues(pol.Spec.Action.Name).Inc()
+		log.StoragePolicyLog(pol).Warnln(perr)
+		c.recorder.Event(pol,
+			v1.EventTypeWarning,
+			string(perr.reason),
+			perr.Error())
+		c.auditDecision(match, audit.DecisionSkipped, string(perr.reason), perr.Error())
+		return c.markObjectForCoolDown(object)
+	}
+
+	if err != nil {
+		// a failed action, such as on a transient API error, must not stop the
+		// other policies, retry it once the cool down expires
+		actionsFailed.WithLabelValues(pol.Spec.Action.Name).Inc()
+		log.StoragePolicyLog(pol).Errorln(err)
+		c.recorder.Event(pol,
+			v1.EventTypeWarning,
+			string(autopilot.StoragePolicyActionFailed),
+			err.Error())
+		c.auditDecision(match, audit.DecisionFailed, "", err.Error())
+		return c.markObjectForCoolDown(object)
+	}
+
+	actionsTriggered.WithLabelValues(pol.Spec.Action.Name).Inc()
+	c.auditDecision(match, audit.DecisionExecuted, "", "")
+
+	if err := c.markObjectForCoolDown(object); err != nil {
+		log.StoragePolicyLog(pol).Errorln(err)
+		c.recorder.Event(pol,
+			v1.EventTypeWarning,
+			string(autopilot.StoragePolicyActionFailed),
+			err.Error())
+		return err
+	}
+
+	c.markObjectVerifying(pol, object)
+	go c.verifyAction(span, match, result)
 
 	return nil
 }
@@ -118,16 +369,16 @@ func (c *crdController) markObjectForCoolDown(object string) error {
 	return nil
 }
 
-func (c *crdController) executePolicyAction(policy *autopilot.StoragePolicy, object string) error {
+func (c *crdController) executePolicyAction(span *trace.Span, policy *autopilot.StoragePolicy, object string) (*actionResult, error) {
 	logrus.Infof("should execute action %s on object %s", policy.Spec.Action.Name, object)
 	actionObjectType, actionType := parseObjectTypeFromActionName(policy.Spec.Action.Name)
 
 	if len(actionObjectType) == 0 {
-		return fmt.Errorf("failed to get action object type for policy: %s", policy.Name)
+		return nil, fmt.Errorf("failed to get action object type for policy: %s", policy.Name)
 	}
 
 	if len(actionType) == 0 {
-		return fmt.Errorf("failed to get action type for policy: %s", policy.Name)
+		return nil, fmt.Errorf("failed to get action type for policy: %s", policy.Name)
 	}
 
 	log.StoragePolicyLog(policy).Infof("action type: %s, action object type: %s", actionType, actionObjectType)
@@ -135,23 +386,26 @@ func (c *crdController) executePolicyAction(policy *autopilot.StoragePolicy, obj
 	switch actionObjectType {
 	case autopilot.PolicyActionVolume:
 		log.StoragePolicyLog(policy).Debugf("running volume policy action")
-		return c.executeVolumeAction(policy, actionType, object)
+		return c.executeVolumeAction(span, policy, actionType, object)
 	default:
 		err := fmt.Errorf("unsupported policy action: %s", policy.Spec.Action.Name)
-		log.StoragePolicyLog(policy).Errorf(err.Error())
-		return err
+		log.StoragePolicyLog(policy).Errorln(err)
+		return nil, err
 	}
 }
 
-func (c *crdController) executeVolumeAction(policy *autopilot.StoragePolicy, actionType string, volumeID string) error {
+func (c *crdController) executeVolumeAction(span *trace.Span, policy *autopilot.StoragePolicy, actionType string, volumeID string) (*actionResult, error) {
+	var result *actionResult
+	var err error
+
 	switch actionType {
 	case autopilot.PolicyActionVolumeResize:
 		log.StoragePolicyLog(policy).Infof("Performing resize on vol: %s", volumeID)
-		if err := c.resizeVolume(policy, volumeID); err != nil {
-			return err
+		if result, err = c.resizeVolume(span, policy, volumeID); err != nil {
+			return nil, err
 		}
 	default:
-		return fmt.Errorf("unsupported action: %s on volume: %s", actionType, volumeID)
+		return nil, fmt.Errorf("unsupported action: %s on volume: %s", actionType, volumeID)
 	}
 
 	c.recorder.Event(policy,
@@ -159,43 +413,130 @@ func (c *crdController) executeVolumeAction(policy *autopilot.StoragePolicy, act
 		string(autopilot.StoragePolicyActionTriggered),
 		fmt.Sprintf("action: %s triggered successfully on volume: %s",
 			actionType, volumeID))
-	return nil
+	return result, nil
+}
+
+func (c *crdController) resizeVolume(span *trace.Span, policy *autopilot.StoragePolicy, volumeID string) (*actionResult, error) {
+	get := span.Start("pvc.get", trace.Attr("pv.name", volumeID))
+	pv, pvc, err := getVolumeClaim(volumeID)
+	get.RecordError(err)
+	get.End()
+	if err != nil {
+		return nil, err
+	}
+
+	pvcName := pvc.Name
+	pvcNamespace := pvc.Namespace
+
+	originalSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	storageSize := originalSize.DeepCopy()
+	// TODO resize by user given factor
+	extraAmount, _ := resource.ParseQuantity("2Gi")
+	storageSize.Add(extraAmount)
+
+	if horizon, ok := policy.Spec.Action.Params[autopilot.PolicyActionVolumeResizeParamHorizon]; ok {
+		size, err := c.forecastSize(policy, volumeID, originalSize, horizon)
+		if err != nil {
+			return nil, err
+		}
+
+		if size.Cmp(storageSize) > 0 {
+			storageSize = size
+		}
+	}
+
+	check := span.Start("resize.preflight", trace.Attr("pvc.name", pvcName), trace.Attr("pvc.namespace", pvcNamespace))
+	storageSize, err = c.checkResize(policy, pv, pvc, storageSize)
+	check.RecordError(err)
+	check.End()
+	if err != nil {
+		return nil, err
+	}
+
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = storageSize
+
+	update := span.Start("pvc.update",
+		trace.Attr("pvc.name", pvcName),
+		trace.Attr("pvc.namespace", pvcNamespace),
+		trace.Attr("pvc.size", storageSize.String()))
+	_, err = k8s.Instance().UpdatePersistentVolumeClaim(pvc)
+	update.RecordError(err)
+	update.End()
+	if err != nil {
+		return nil, err
+	}
+
+	log.StoragePolicyLog(policy).Infof("successfully resized PVC: [%s] %s from %s to %s for PV: %s",
+		pvcNamespace, pvcName, originalSize.String(), storageSize.String(), volumeID)
+
+	return &actionResult{
+		verify: func() (bool, error) {
+			return isPVCResized(pvcName, pvcNamespace, storageSize)
+		},
+		rollback: func() error {
+			return restorePVCSize(pvcName, pvcNamespace, originalSize)
+		},
+	}, nil
 }
 
-func (c *crdController) resizeVolume(policy *autopilot.StoragePolicy, volumeID string) error {
+// getVolumeClaim returns the persistent volume and its claim
+func getVolumeClaim(volumeID string) (*v1.PersistentVolume, *v1.PersistentVolumeClaim, error) {
 	pv, err := k8s.Instance().GetPersistentVolume(volumeID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	claimRef := pv.Spec.ClaimRef
 	if claimRef == nil {
-		return fmt.Errorf("failed to get PVC from PV as claim reference is nil")
+		return nil, nil, fmt.Errorf("failed to get PVC from PV as claim reference is nil")
 	}
 
-	pvcName := claimRef.Name
-	pvcNamespace := claimRef.Namespace
+	pvc, err := k8s.Instance().GetPersistentVolumeClaim(claimRef.Name, claimRef.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pv, pvc, nil
+}
+
+// isPVCResized returns true once the capacity of the PVC has reached the requested size
+func isPVCResized(pvcName, pvcNamespace string, size resource.Quantity) (bool, error) {
 	pvc, err := k8s.Instance().GetPersistentVolumeClaim(pvcName, pvcNamespace)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	storageSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]
-	// TODO resize by user given factor
-	extraAmount, _ := resource.ParseQuantity("2Gi")
-	storageSize.Add(extraAmount)
-	pvc.Spec.Resources.Requests[v1.ResourceStorage] = storageSize
+	for _, cond := range pvc.Status.Conditions {
+		if cond.Type == v1.PersistentVolumeClaimFileSystemResizePending && cond.Status == v1.ConditionTrue {
+			return false, nil
+		}
+	}
 
-	_, err = k8s.Instance().UpdatePersistentVolumeClaim(pvc)
+	capacity, ok := pvc.Status.Capacity[v1.ResourceStorage]
+	if !ok {
+		return false, nil
+	}
+
+	return capacity.Cmp(size) >= 0, nil
+}
+
+// restorePVCSize sets the requested size of the PVC back to the given size.
+// Kubernetes rejects shrinking the request of a PVC unless the
+// RecoverVolumeExpansionFailure feature gate is enabled, so the rollback of a
+// resize fails on other clusters.
+func restorePVCSize(pvcName, pvcNamespace string, size resource.Quantity) error {
+	pvc, err := k8s.Instance().GetPersistentVolumeClaim(pvcName, pvcNamespace)
 	if err != nil {
 		return err
 	}
 
-	log.StoragePolicyLog(policy).Infof("successfully resized PVC: [%s] %s by %v for PV: %s",
-		pvcNamespace, pvcName, extraAmount, volumeID)
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = size
+	if _, err = k8s.Instance().UpdatePersistentVolumeClaim(pvc); err != nil {
+		return fmt.Errorf("failed to shrink PVC %s/%s back to %s, this requires the "+
+			"RecoverVolumeExpansionFailure feature gate: %v", pvcNamespace, pvcName, size.String(), err)
+	}
 
 	return nil
-
 }
 
 func parseObjectTypeFromActionName(actionName string) (string, string) {
@@ -234,20 +575,8 @@ func getObjectsForPolicy(policy *autopilot.StoragePolicy) ([]string, error) {
 	return objects, nil
 }
 
-func isConditionMetOnObject(object string, vecs []metrics.Vector) bool {
-	if len(vecs) == 0 {
-		return false
-	}
-
-	found := 0
-	for _, vec := range vecs {
-		// TODO can't assume volume type here
-		if object == *vec.Metric.VolumeName {
-			found = found + 1
-			continue
-		}
-	}
-
-	// all vecs need to have the object
-	return found == len(vecs)
+// isConditionMetOnObject returns true if the conditions of the policy are met on the object
+func isConditionMetOnObject(policy *autopilot.StoragePolicy, object string, vecs []metrics.Vector) bool {
+	results := metrics.NewResultSet(policy.Spec.Object.Type, len(policy.Spec.ConditionList()), vecs)
+	return results.Evaluate(&policy.Spec, object).Met
 }
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/openstorage"
+	"github.com/portworx/sched-ops/k8s"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+	v1 "k8s.io/api/core/v1"
+	storage_api "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	pvcStorageClassKey         = "volume.beta.kubernetes.io/storage-class"
+	storageClassQuotaSuffix    = ".storageclass.storage.k8s.io/" + string(v1.ResourceRequestsStorage)
+	storageCapacityCallTimeout = 30 * time.Second
+)
+
+// preflightError is returned when a pre-flight check rejects an action
+type preflightError struct {
+	reason autopilot.StoragePolicyStatusType
+	msg    string
+}
+
+func (e *preflightError) Error() string {
+	return e.msg
+}
+
+// checkResize runs the pre-flight checks for growing the PVC to the target
+// size and returns the size the PVC can be resized to
+func (c *crdController) checkResize(
+	policy *autopilot.StoragePolicy,
+	pv *v1.PersistentVolume,
+	pvc *v1.PersistentVolumeClaim,
+	target resource.Quantity,
+) (resource.Quantity, error) {
+	current := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+
+	if maxSize, ok := policy.Spec.Action.Params[autopilot.PolicyActionVolumeResizeParamMaxSize]; ok {
+		max, err := resource.ParseQuantity(maxSize)
+		if err != nil {
+			return target, fmt.Errorf("invalid %s param %q: %v",
+				autopilot.PolicyActionVolumeResizeParamMaxSize, maxSize, err)
+		}
+
+		if current.Cmp(max) >= 0 {
+			return target, &preflightError{
+				reason: autopilot.StoragePolicyResizeMaxSizeReached,
+				msg: fmt.Sprintf("PVC: [%s] %s of size %s has reached the policy max size %s",
+					pvc.Namespace, pvc.Name, current.String(), max.String()),
+			}
+		}
+
+		if target.Cmp(max) > 0 {
+			log.StoragePolicyLog(policy).Infof("capping resize of PVC: [%s] %s to the policy max size %s",
+				pvc.Namespace, pvc.Name, max.String())
+			target = max
+		}
+	}
+
+	sc, err := getStorageClassForPVC(pvc)
+	if err != nil {
+		return target, err
+	}
+
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return target, &preflightError{
+			reason: autopilot.StoragePolicyResizeNotAllowed,
+			msg: fmt.Sprintf("storage class: %s of PVC: [%s] %s does not allow volume expansion",
+				sc.Name, pvc.Namespace, pvc.Name),
+		}
+	}
+
+	extra := target.DeepCopy()
+	extra.Sub(current)
+
+	if err := c.checkStorageQuota(pvc, sc.Name, extra); err != nil {
+		return target, err
+	}
+
+	if err := c.checkPoolCapacity(pv, pvc, extra); err != nil {
+		return target, err
+	}
+
+	return target, nil
+}
+
+// checkStorageQuota checks that the resource quotas in the PVC namespace have
+// room for the extra storage
+func (c *crdController) checkStorageQuota(pvc *v1.PersistentVolumeClaim, storageClass string, extra resource.Quantity) error {
+	quotas, err := c.k8sClient.CoreV1().ResourceQuotas(pvc.Namespace).List(meta.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	keys := []v1.ResourceName{
+		v1.ResourceRequestsStorage,
+		v1.ResourceName(storageClass + storageClassQuotaSuffix),
+	}
+
+	for _, quota := range quotas.Items {
+		for _, key := range keys {
+			hard, ok := quota.Status.Hard[key]
+			if !ok {
+				continue
+			}
+
+			used := quota.Status.Used[key]
+			requested := used.DeepCopy()
+			requested.Add(extra)
+			if requested.Cmp(hard) > 0 {
+				return &preflightError{
+					reason: autopilot.StoragePolicyResizeQuotaExceeded,
+					msg: fmt.Sprintf("growing PVC: [%s] %s by %s exceeds %s of resource quota: %s (used: %s, hard: %s)",
+						pvc.Namespace, pvc.Name, extra.String(), key, quota.Name,
+						used.String(), hard.String()),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPoolCapacity checks that the storage pools backing the volume have room
+// for the extra storage. The check is skipped when no storage endpoint is
+// configured or the volume is not an openstorage volume.
+func (c *crdController) checkPoolCapacity(pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim, extra resource.Quantity) error {
+	endpoint := c.config().StorageEndpoint
+	if len(endpoint) == 0 {
+		return nil
+	}
+
+	var volumeID string
+	switch {
+	case pv.Spec.PortworxVolume != nil:
+		volumeID = pv.Spec.PortworxVolume.VolumeID
+	case pv.Spec.CSI != nil:
+		volumeID = pv.Spec.CSI.VolumeHandle
+	default:
+		return nil
+	}
+
+	tlsConfig, err := openstorage.TLSConfig(sparks.ParseStringParams(c.config().StorageTLS))
+	if err != nil {
+		return err
+	}
+
+	conn, err := openstorage.Dial(endpoint, tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageCapacityCallTimeout)
+	defer cancel()
+
+	free, err := openstorage.FreePoolCapacity(ctx, conn, volumeID)
+	if err != nil {
+		return err
+	}
+
+	if extra.CmpInt64(int64(free)) > 0 {
+		return &preflightError{
+			reason: autopilot.StoragePolicyResizeInsufficientCapacity,
+			msg: fmt.Sprintf("storage pools of PVC: [%s] %s have %s free, %s is needed",
+				pvc.Namespace, pvc.Name, resource.NewQuantity(int64(free), resource.BinarySI).String(), extra.String()),
+		}
+	}
+
+	return nil
+}
+
+func getStorageClassForPVC(pvc *v1.PersistentVolumeClaim) (*storage_api.StorageClass, error) {
+	var scName string
+	if pvc.Spec.StorageClassName != nil && len(*pvc.Spec.StorageClassName) > 0 {
+		scName = *pvc.Spec.StorageClassName
+	} else {
+		scName = pvc.Annotations[pvcStorageClassKey]
+	}
+
+	if len(scName) == 0 {
+		return nil, fmt.Errorf("PVC: %s does not have a storage class", pvc.Name)
+	}
+
+	return k8s.Instance().GetStorageClass(scName)
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/sirupsen/logrus"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+	v1 "k8s.io/api/core/v1"
+)
+
+// newProviders creates the metrics providers of the configuration, each one
+// guarded by its configured timeouts, retries and circuit breaker
+func newProviders(cfg *config.Config) (map[string]metrics.Provider, error) {
+	provs := make(map[string]metrics.Provider)
+
+	for _, prov := range cfg.Providers {
+		inst, err := newProvider(prov)
+		if err != nil {
+			closeProviders(provs)
+			return nil, err
+		}
+
+		provs[prov.Name] = inst
+	}
+
+	return provs, nil
+}
+
+func newProvider(prov config.MetricsProvider) (metrics.Provider, error) {
+	params := sparks.ParseStringParams(prov.Params)
+	for key, value := range prov.SecretParams {
+		params[key] = value
+	}
+
+	inst, err := metrics.NewProviderWithParams(prov.Type, params)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := guardOptions(prov)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %v", prov.Name, err)
+	}
+
+	return metrics.Guard(prov.Name, inst, opts), nil
+}
+
+// closeProviders releases the resources of the providers that hold any, such
+// as the listeners of the providers that receive metrics
+func closeProviders(provs map[string]metrics.Provider) {
+	for name, prov := range provs {
+		closer, ok := prov.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if err := closer.Close(); err != nil {
+			logrus.Warnf("failed to close metrics provider %s: %v", name, err)
+		}
+	}
+}
+
+// triggers forwards the evaluations asked by the providers that push metrics
+// on a single channel, across the provider changes of configuration reloads
+type triggers struct {
+	C chan struct{}
+
+	watched map[string]metrics.Provider
+	stop    map[string]chan struct{}
+}
+
+func newTriggers() *triggers {
+	return &triggers{
+		C:       make(chan struct{}, 1),
+		watched: make(map[string]metrics.Provider),
+		stop:    make(map[string]chan struct{}),
+	}
+}
+
+// watch forwards the triggers of the given providers and stops forwarding the
+// triggers of the providers that were removed or replaced
+func (t *triggers) watch(provs map[string]metrics.Provider) {
+	for name, prov := range t.watched {
+		if provs[name] == prov {
+			continue
+		}
+
+		close(t.stop[name])
+		delete(t.watched, name)
+		delete(t.stop, name)
+	}
+
+	for name, prov := range provs {
+		if _, ok := t.watched[name]; ok {
+			continue
+		}
+
+		trigger, ok := prov.(metrics.Trigger)
+		if !ok || trigger.Triggered() == nil {
+			continue
+		}
+
+		stop := make(chan struct{})
+		t.watched[name] = prov
+		t.stop[name] = stop
+
+		go func(name string, ch <-chan struct{}) {
+			for {
+				select {
+				case _, ok := <-ch:
+					if !ok {
+						return
+					}
+
+					logrus.Debugf("metrics provider %s triggered an evaluation", name)
+					select {
+					case t.C <- struct{}{}:
+					default:
+					}
+
+				case <-stop:
+					return
+				}
+			}
+		}(name, trigger.Triggered())
+	}
+}
+
+func guardOptions(prov config.MetricsProvider) (metrics.GuardOptions, error) {
+	opts := metrics.GuardOptions{
+		Retries:          metrics.DefaultRetries,
+		FailureThreshold: prov.FailureThreshold,
+	}
+
+	if prov.Retries != nil {
+		opts.Retries = *prov.Retries
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		out   *time.Duration
+	}{
+		{"timeout", prov.Timeout, &opts.Timeout},
+		{"retry_backoff", prov.RetryBackoff, &opts.RetryBackoff},
+		{"reset_timeout", prov.ResetTimeout, &opts.ResetTimeout},
+	}
+
+	for _, d := range durations {
+		if len(d.value) == 0 {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q: %v", d.name, d.value, err)
+		}
+		*d.out = parsed
+	}
+
+	return opts, nil
+}
+
+// checkProviderHealth reports the providers whose health changed since the
+// last poll cycle on every policy. The caller must hold the controller lock.
+func (c *crdController) checkProviderHealth(provs map[string]metrics.Provider) {
+	for name, prov := range provs {
+		reporter, ok := prov.(metrics.HealthReporter)
+		if !ok {
+			continue
+		}
+
+		last, known := c.providerHealth[name]
+		if !known {
+			last = true
+		}
+
+		healthy := reporter.Healthy()
+		c.providerHealth[name] = healthy
+		if !known {
+			c.providerTransitions[name] = time.Now()
+			c.configStatusChanged = true
+		}
+
+		if healthy == last {
+			continue
+		}
+
+		c.providerTransitions[name] = time.Now()
+		c.configStatusChanged = true
+
+		eventType := v1.EventTypeNormal
+		reason := autopilot.StoragePolicyProviderHealthy
+		msg := fmt.Sprintf("metrics provider: %s is healthy again", name)
+		if !healthy {
+			eventType = v1.EventTypeWarning
+			reason = autopilot.StoragePolicyProviderUnhealthy
+			msg = fmt.Sprintf("metrics provider: %s is unhealthy and skipped until it recovers", name)
+		}
+
+		logrus.Infoln(msg)
+		for _, pol := range c.storagePolicies {
+			c.recorder.Event(pol, eventType, string(reason), msg)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/trace"
+)
+
+// defaultProvider returns the provider of the conditions that don't name one,
+// the first provider of the configuration
+func defaultProvider(cfg *config.Config) string {
+	if len(cfg.Providers) == 0 {
+		return ""
+	}
+
+	return cfg.Providers[0].Name
+}
+
+func (c *crdController) defaultProvider() string {
+	return defaultProvider(c.config())
+}
+
+// conditionProvider returns the name of the provider that evaluates the condition
+func conditionProvider(policy *autopilot.StoragePolicy, condition *autopilot.LabelSelectorRequirement, def string) string {
+	if len(condition.Provider) > 0 {
+		return condition.Provider
+	}
+
+	if len(policy.Spec.Provider) > 0 {
+		return policy.Spec.Provider
+	}
+
+	return def
+}
+
+// queryPolicy queries every condition of the policy on its provider and
+// returns the vectors of all the conditions, tagged with the index of their
+// condition in the policy ConditionList, so they can be joined on the object
+// identity. Every provider of the policy must answer for the policy to be
+// evaluated. The queries are traced as children of the span.
+func queryPolicy(span *trace.Span, provs map[string]metrics.Provider, def string, policy *autopilot.StoragePolicy) ([]metrics.Vector, error) {
+	conditions := policy.Spec.ConditionList()
+
+	// indices of the conditions of every provider, in the order the providers first appear
+	indices := make(map[string][]int)
+	order := make([]string, 0)
+	for i, condition := range conditions {
+		name := conditionProvider(policy, condition, def)
+		if _, ok := indices[name]; !ok {
+			order = append(order, name)
+		}
+		indices[name] = append(indices[name], i)
+	}
+
+	rval := make([]metrics.Vector, 0)
+	for _, name := range order {
+		prov, ok := provs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown metrics provider %q", name)
+		}
+
+		sub := policy.DeepCopy()
+		sub.Spec.Match = nil
+		sub.Spec.Conditions = make([]*autopilot.LabelSelectorRequirement, 0, len(indices[name]))
+		for _, i := range indices[name] {
+			sub.Spec.Conditions = append(sub.Spec.Conditions, conditions[i])
+		}
+
+		query := span.Start("provider.query",
+			trace.Attr("provider.name", name),
+			trace.Attr("policy.name", policy.Name),
+			trace.Attr("conditions", len(sub.Spec.Conditions)))
+		vecs, err := prov.Query(context.Background(), sub)
+		query.SetAttributes(trace.Attr("vectors", len(vecs)))
+		query.RecordError(err)
+		query.End()
+
+		if err == metrics.ErrProviderUnhealthy {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %v", name, err)
+		}
+
+		if len(vecs) == 0 && policy.Spec.Match == nil {
+			// all conditions have to be met, so the other providers are not queried
+			return nil, nil
+		}
+
+		for _, vec := range vecs {
+			vec.Condition = indices[name][vec.Condition]
+			rval = append(rval, vec)
+		}
+	}
+
+	return rval, nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/notify"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// configWatchInterval is how often the configuration file is checked for changes
+const configWatchInterval = 10 * time.Second
+
+// validateConfig checks the settings of the configuration that depend on the
+// providers built in autopilot
+func validateConfig(cfg *config.Config) error {
+	problems := make(config.Problems, 0)
+	for i, prov := range cfg.Providers {
+		if len(prov.Type) > 0 && !metrics.Registered(prov.Type) {
+			problems = append(problems,
+				cfg.Problem(fmt.Sprintf("providers[%d].type", i), "unknown provider type %q", prov.Type))
+		}
+	}
+
+	for i, n := range cfg.Notifiers {
+		path := fmt.Sprintf("notifiers[%d]", i)
+		if len(n.Type) > 0 && !notify.Registered(n.Type) {
+			problems = append(problems, cfg.Problem(path+".type", "unknown notifier type %q", n.Type))
+		}
+
+		if len(n.Severity) > 0 {
+			if _, err := notify.ParseSeverity(n.Severity); err != nil {
+				problems = append(problems, cfg.Problem(path+".severity", "unknown severity %q", n.Severity))
+			}
+		}
+
+		for j, event := range n.Events {
+			if _, ok := notify.Reasons[event]; !ok {
+				problems = append(problems,
+					cfg.Problem(fmt.Sprintf("%s.events[%d]", path, j), "event %q is not notified", event))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+// reloadConfig reads the configuration file and swaps it in along with its
+// providers. If the configuration is invalid, the last good one is kept and
+// the error is reported on the policies. The file is ignored while the
+// AutopilotConfig exists. It returns the providers to use from now on. The
+// caller must hold the controller lock.
+func (c *crdController) reloadConfig(f string, dryRun bool, provs map[string]metrics.Provider) (map[string]metrics.Provider, error) {
+	if c.usingConfigResource {
+		logrus.Infof("ignoring the configuration file %s, AutopilotConfig %s takes precedence",
+			f, autopilot.AutopilotConfigName)
+		return provs, nil
+	}
+
+	source := fmt.Sprintf("configuration %s", f)
+	cfg, err := config.ReadFile(f)
+	if err != nil {
+		c.recordConfigEvent(nil, v1.EventTypeWarning, autopilot.StoragePolicyConfigInvalid,
+			fmt.Sprintf("invalid %s, keeping the previous configuration: %v", source, err))
+		return provs, err
+	}
+
+	if dryRun {
+		cfg.DryRun = true
+	}
+
+	return c.applyConfig(cfg, source, nil, provs)
+}
+
+// applyConfig swaps in the configuration along with its providers, or keeps
+// the last good one if the providers can't be created. The outcome is reported
+// on the policies and on the object the configuration comes from, if any. It
+// returns the providers to use from now on. The caller must hold the
+// controller lock.
+func (c *crdController) applyConfig(
+	cfg *config.Config,
+	source string,
+	obj runtime.Object,
+	provs map[string]metrics.Provider,
+) (map[string]metrics.Provider, error) {
+	err := validateConfig(cfg)
+	if err == nil {
+		err = resolveSecrets(cfg)
+	}
+
+	if err != nil {
+		c.recordConfigEvent(obj, v1.EventTypeWarning, autopilot.StoragePolicyConfigInvalid,
+			fmt.Sprintf("invalid %s, keeping the previous configuration: %v", source, err))
+		return provs, err
+	}
+
+	dispatcher, err := newDispatcher(cfg)
+	if err != nil {
+		c.recordConfigEvent(obj, v1.EventTypeWarning, autopilot.StoragePolicyConfigInvalid,
+			fmt.Sprintf("failed to create the notifiers of %s, keeping the previous configuration: %v", source, err))
+		return provs, err
+	}
+
+	next, err := reloadProviders(provs, c.config(), cfg)
+	if err != nil {
+		c.recordConfigEvent(obj, v1.EventTypeWarning, autopilot.StoragePolicyConfigInvalid,
+			fmt.Sprintf("failed to create the providers of %s, keeping the previous configuration: %v", source, err))
+		return next, err
+	}
+
+	for name := range c.providerHealth {
+		if _, ok := next[name]; !ok {
+			delete(c.providerHealth, name)
+			delete(c.providerTransitions, name)
+			c.configStatusChanged = true
+		}
+	}
+
+	c.setConfig(cfg)
+	c.probation.SetTimeout(cooldownPeriod(cfg))
+	c.notifications.setDispatcher(dispatcher)
+
+	c.recordConfigEvent(obj, v1.EventTypeNormal, autopilot.StoragePolicyConfigReloaded,
+		fmt.Sprintf("%s applied", source))
+
+	return next, nil
+}
+
+// reloadProviders returns the providers of the next configuration. The
+// providers whose configuration didn't change are kept along with their health,
+// the others are closed and created again. If a provider can't be created, the
+// providers of the previous configuration are restored and returned with the
+// error.
+func reloadProviders(provs map[string]metrics.Provider, prev, next *config.Config) (map[string]metrics.Provider, error) {
+	prevConfigs := make(map[string]config.MetricsProvider)
+	for _, prov := range prev.Providers {
+		prevConfigs[prov.Name] = prov
+	}
+
+	kept := make(map[string]metrics.Provider)
+	for _, prov := range next.Providers {
+		old, ok := prevConfigs[prov.Name]
+		inst, running := provs[prov.Name]
+		if ok && running && reflect.DeepEqual(old, prov) {
+			kept[prov.Name] = inst
+		}
+	}
+
+	// close the replaced providers first, they may hold the listen address of their replacement
+	stale := make(map[string]metrics.Provider)
+	for name, inst := range provs {
+		if _, ok := kept[name]; !ok {
+			stale[name] = inst
+		}
+	}
+	closeProviders(stale)
+
+	created := make(map[string]metrics.Provider)
+	for _, prov := range next.Providers {
+		if _, ok := kept[prov.Name]; ok {
+			continue
+		}
+
+		inst, err := newProvider(prov)
+		if err != nil {
+			closeProviders(created)
+			return restoreProviders(kept, stale, prevConfigs), fmt.Errorf("provider %s: %v", prov.Name, err)
+		}
+
+		created[prov.Name] = inst
+	}
+
+	for name, inst := range created {
+		kept[name] = inst
+	}
+
+	return kept, nil
+}
+
+// restoreProviders creates the closed providers of the previous configuration
+// again and returns them along with the providers that were kept
+func restoreProviders(kept, stale map[string]metrics.Provider, prevConfigs map[string]config.MetricsProvider) map[string]metrics.Provider {
+	rval := make(map[string]metrics.Provider)
+	for name, inst := range kept {
+		rval[name] = inst
+	}
+
+	for name := range stale {
+		inst, err := newProvider(prevConfigs[name])
+		if err != nil {
+			logrus.Errorf("failed to restore metrics provider %s: %v", name, err)
+			continue
+		}
+
+		rval[name] = inst
+	}
+
+	return rval
+}
+
+// recordConfigEvent reports a configuration change on every policy and on the
+// object the configuration comes from, if any
+func (c *crdController) recordConfigEvent(obj runtime.Object, eventType string, reason autopilot.StoragePolicyStatusType, msg string) {
+	if eventType == v1.EventTypeWarning {
+		logrus.Errorln(msg)
+	} else {
+		logrus.Infoln(msg)
+	}
+
+	if obj != nil {
+		c.recorder.Event(obj, eventType, string(reason), msg)
+	}
+
+	for _, pol := range c.storagePolicies {
+		c.recorder.Event(pol, eventType, string(reason), msg)
+	}
+}
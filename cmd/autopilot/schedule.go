@@ -0,0 +1,163 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libopenstorage/autopilot/audit"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/window"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pendingAction is a policy action waiting for the policy schedule to allow it
+type pendingAction struct {
+	policy string
+	status autopilot.PendingAction
+}
+
+func pendingKey(policy *autopilot.StoragePolicy, object string) string {
+	return policy.Name + "/" + object
+}
+
+// parsedSchedule is the schedule of a policy version, parsed once
+type parsedSchedule struct {
+	resourceVersion string
+	schedule        *window.Schedule
+	err             error
+	// reported is set once an invalid schedule has been reported
+	reported bool
+}
+
+// policySchedule returns the parsed schedule of the policy, it is parsed again
+// only when the policy changes. The caller must hold the controller lock.
+func (c *crdController) policySchedule(policy *autopilot.StoragePolicy) *parsedSchedule {
+	parsed, ok := c.schedules[policy.Name]
+	if ok && parsed.resourceVersion == policy.ResourceVersion {
+		return parsed
+	}
+
+	parsed = &parsedSchedule{resourceVersion: policy.ResourceVersion}
+	parsed.schedule, parsed.err = window.Parse(policy.Spec.Schedule)
+	c.schedules[policy.Name] = parsed
+	return parsed
+}
+
+// reportInvalidSchedule records the invalid schedule of the matched policy,
+// once per policy version. The caller must hold the controller lock.
+func (c *crdController) reportInvalidSchedule(match *policyMatch, err error) {
+	parsed := c.policySchedule(match.policy)
+	if parsed.reported {
+		return
+	}
+	parsed.reported = true
+
+	log.StoragePolicyLog(match.policy).Errorln(err)
+	c.recorder.Event(match.policy,
+		v1.EventTypeWarning,
+		string(autopilot.StoragePolicyActionFailed),
+		err.Error())
+	c.auditDecision(match, audit.DecisionFailed, "", err.Error())
+}
+
+// deferAction queues the action of the matched policy if the policy schedule
+// does not allow it to run at the given time. It returns true if the action
+// was deferred. The caller must hold the controller lock.
+func (c *crdController) deferAction(match *policyMatch, now time.Time) (bool, error) {
+	key := pendingKey(match.policy, match.object)
+
+	parsed := c.policySchedule(match.policy)
+	if parsed.err != nil {
+		return false, parsed.err
+	}
+	schedule := parsed.schedule
+
+	if schedule.IsOpen(now) {
+		if _, ok := c.pendingActions[key]; ok {
+			log.StoragePolicyLog(match.policy).Infof("schedule open, running deferred action %s on object %s",
+				match.policy.Spec.Action.Name, match.object)
+			delete(c.pendingActions, key)
+			c.statusChanged[match.policy.Name] = true
+		}
+		return false, nil
+	}
+
+	if _, ok := c.pendingActions[key]; ok {
+		return true, nil
+	}
+
+	pending := &pendingAction{
+		policy: match.policy.Name,
+		status: autopilot.PendingAction{
+			Object:   match.object,
+			Action:   match.policy.Spec.Action.Name,
+			QueuedAt: meta.NewTime(now),
+		},
+	}
+
+	notBefore := "unknown"
+	if next, ok := schedule.NextOpen(now); ok {
+		t := meta.NewTime(next)
+		pending.status.NotBefore = &t
+		notBefore = next.Format(time.RFC3339)
+	}
+
+	c.pendingActions[key] = pending
+	c.statusChanged[match.policy.Name] = true
+
+	log.StoragePolicyLog(match.policy).Infof("deferring action %s on object %s until %s",
+		match.policy.Spec.Action.Name, match.object, notBefore)
+	msg := fmt.Sprintf("action: %s on object: %s deferred by policy schedule until: %s",
+		match.policy.Spec.Action.Name, match.object, notBefore)
+	c.recorder.Event(match.policy,
+		v1.EventTypeNormal,
+		string(autopilot.StoragePolicyActionDeferred),
+		msg)
+	c.auditDecision(match, audit.DecisionDeferred, audit.ReasonWindow, msg)
+
+	return true, nil
+}
+
+// expirePendingActions drops the deferred actions of the evaluated policies
+// whose conditions are no longer met. The caller must hold the controller lock.
+func (c *crdController) expirePendingActions(matched, evaluated map[string]bool) {
+	for key, pending := range c.pendingActions {
+		policy, exists := c.storagePolicies[pending.policy]
+		if exists && (matched[key] || !evaluated[pending.policy]) {
+			continue
+		}
+
+		delete(c.pendingActions, key)
+		c.statusChanged[pending.policy] = true
+
+		if !exists {
+			continue
+		}
+
+		log.StoragePolicyLog(policy).Infof("conditions cleared, dropping deferred action %s on object %s",
+			pending.status.Action, pending.status.Object)
+		c.recorder.Event(policy,
+			v1.EventTypeNormal,
+			string(autopilot.StoragePolicyActionExpired),
+			fmt.Sprintf("action: %s on object: %s expired since the conditions are no longer met",
+				pending.status.Action, pending.status.Object))
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 2019-06-05 is a Wednesday
+var wednesdayNoon = time.Date(2019, time.June, 5, 12, 0, 0, 0, time.UTC)
+
+func newScheduledPolicy(name string) *autopilot.StoragePolicy {
+	policy := newPolicy(name, "", 0)
+	policy.Spec.Schedule = &autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{{Days: []string{"Sat"}, Start: "22:00", End: "06:00"}},
+	}
+	return policy
+}
+
+func reasons(recorded []string) []string {
+	rs := make([]string, 0, len(recorded))
+	for _, event := range recorded {
+		rs = append(rs, strings.Fields(event)[1])
+	}
+	return rs
+}
+
+func TestDeferAction(t *testing.T) {
+	saturdayNight := time.Date(2019, time.June, 8, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   *autopilot.StoragePolicy
+		now      time.Time
+		pending  bool
+		deferred bool
+		queued   bool
+		changed  bool
+		reasons  []string
+	}{
+		{
+			name:     "no schedule",
+			policy:   newPolicy("unscheduled", "", 0),
+			now:      wednesdayNoon,
+			deferred: false,
+			reasons:  []string{},
+		},
+		{
+			name:     "schedule open",
+			policy:   newScheduledPolicy("scheduled"),
+			now:      saturdayNight,
+			deferred: false,
+			reasons:  []string{},
+		},
+		{
+			name:     "schedule closed",
+			policy:   newScheduledPolicy("scheduled"),
+			now:      wednesdayNoon,
+			deferred: true,
+			queued:   true,
+			changed:  true,
+			reasons:  []string{string(autopilot.StoragePolicyActionDeferred)},
+		},
+		{
+			name:     "schedule closed, already pending",
+			policy:   newScheduledPolicy("scheduled"),
+			now:      wednesdayNoon,
+			pending:  true,
+			deferred: true,
+			queued:   true,
+			reasons:  []string{},
+		},
+		{
+			name:     "schedule open, pending runs",
+			policy:   newScheduledPolicy("scheduled"),
+			now:      saturdayNight,
+			pending:  true,
+			deferred: false,
+			changed:  true,
+			reasons:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		c, recorder := newTestController(test.policy)
+		match := &policyMatch{policy: test.policy, object: "vol-1"}
+		key := pendingKey(test.policy, "vol-1")
+		if test.pending {
+			c.pendingActions[key] = &pendingAction{
+				policy: test.policy.Name,
+				status: autopilot.PendingAction{Object: "vol-1", Action: resizeAction, QueuedAt: meta.NewTime(wednesdayNoon)},
+			}
+		}
+
+		deferred, err := c.deferAction(match, test.now)
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.deferred, deferred, test.name)
+
+		pending, queued := c.pendingActions[key]
+		require.Equal(t, test.queued, queued, test.name)
+		require.Equal(t, test.changed, c.statusChanged[test.policy.Name], test.name)
+		require.Equal(t, test.reasons, reasons(events(recorder)), test.name)
+
+		if queued && !test.pending {
+			require.Equal(t, resizeAction, pending.status.Action, test.name)
+			require.NotNil(t, pending.status.NotBefore, test.name)
+			require.True(t, pending.status.NotBefore.Time.Equal(saturdayNight),
+				"%s: expected the action to wait for saturday night, got %v", test.name, pending.status.NotBefore)
+		}
+	}
+
+	c, _ := newTestController()
+	invalid := newPolicy("invalid", "", 0)
+	invalid.Spec.Schedule = &autopilot.PolicySchedule{TimeZone: "Mars/Olympus_Mons"}
+	_, err := c.deferAction(&policyMatch{policy: invalid, object: "vol-1"}, wednesdayNoon)
+	require.Error(t, err, "Expected an invalid schedule to fail")
+}
+
+func TestInvalidScheduleReportedOnce(t *testing.T) {
+	invalid := newPolicy("invalid", "", 0)
+	invalid.ResourceVersion = "1"
+	invalid.Spec.Schedule = &autopilot.PolicySchedule{TimeZone: "Mars/Olympus_Mons"}
+	c, recorder := newTestController(invalid)
+
+	// every poll cycle matches the objects of the policy again
+	for cycle := 0; cycle < 3; cycle++ {
+		for _, object := range []string{"vol-1", "vol-2"} {
+			match := &policyMatch{policy: invalid, object: object}
+			_, err := c.deferAction(match, wednesdayNoon)
+			require.Error(t, err, "Expected an invalid schedule to fail")
+			c.reportInvalidSchedule(match, err)
+		}
+	}
+	require.Equal(t, []string{string(autopilot.StoragePolicyActionFailed)}, reasons(events(recorder)),
+		"Expected the invalid schedule to be reported once")
+
+	// a new version of the policy is validated again
+	updated := invalid.DeepCopy()
+	updated.ResourceVersion = "2"
+	match := &policyMatch{policy: updated, object: "vol-1"}
+	_, err := c.deferAction(match, wednesdayNoon)
+	require.Error(t, err)
+	c.reportInvalidSchedule(match, err)
+	require.Equal(t, []string{string(autopilot.StoragePolicyActionFailed)}, reasons(events(recorder)))
+
+	updated = updated.DeepCopy()
+	updated.ResourceVersion = "3"
+	updated.Spec.Schedule.TimeZone = "UTC"
+	updated.Spec.Schedule.Allowed = []autopilot.TimeWindow{{Days: []string{"Wed"}, Start: "11:00", End: "13:00"}}
+	deferred, err := c.deferAction(&policyMatch{policy: updated, object: "vol-1"}, wednesdayNoon)
+	require.NoError(t, err, "Expected the fixed schedule to be used")
+	require.False(t, deferred)
+}
+
+func TestExpirePendingActions(t *testing.T) {
+	tests := []struct {
+		name      string
+		policies  []*autopilot.StoragePolicy
+		matched   map[string]bool
+		evaluated map[string]bool
+		kept      bool
+		changed   bool
+		reasons   []string
+	}{
+		{
+			name:      "conditions still met",
+			policies:  []*autopilot.StoragePolicy{newScheduledPolicy("scheduled")},
+			matched:   map[string]bool{"scheduled/vol-1": true},
+			evaluated: map[string]bool{"scheduled": true},
+			kept:      true,
+			reasons:   []string{},
+		},
+		{
+			name:      "policy not evaluated",
+			policies:  []*autopilot.StoragePolicy{newScheduledPolicy("scheduled")},
+			matched:   map[string]bool{},
+			evaluated: map[string]bool{},
+			kept:      true,
+			reasons:   []string{},
+		},
+		{
+			name:      "conditions cleared",
+			policies:  []*autopilot.StoragePolicy{newScheduledPolicy("scheduled")},
+			matched:   map[string]bool{},
+			evaluated: map[string]bool{"scheduled": true},
+			changed:   true,
+			reasons:   []string{string(autopilot.StoragePolicyActionExpired)},
+		},
+		{
+			name:      "policy deleted",
+			matched:   map[string]bool{"scheduled/vol-1": true},
+			evaluated: map[string]bool{"scheduled": true},
+			changed:   true,
+			reasons:   []string{},
+		},
+	}
+
+	for _, test := range tests {
+		c, recorder := newTestController(test.policies...)
+		c.pendingActions["scheduled/vol-1"] = &pendingAction{
+			policy: "scheduled",
+			status: autopilot.PendingAction{Object: "vol-1", Action: resizeAction, QueuedAt: meta.NewTime(wednesdayNoon)},
+		}
+
+		c.expirePendingActions(test.matched, test.evaluated)
+
+		_, kept := c.pendingActions["scheduled/vol-1"]
+		require.Equal(t, test.kept, kept, test.name)
+		require.Equal(t, test.changed, c.statusChanged["scheduled"], test.name)
+		require.Equal(t, test.reasons, reasons(events(recorder)), test.name)
+	}
+}
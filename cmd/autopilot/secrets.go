@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/libopenstorage/autopilot/config"
+	"github.com/portworx/sched-ops/k8s"
+)
+
+const (
+	// podNamespaceEnv is the environment variable with the namespace autopilot runs in
+	podNamespaceEnv  = "POD_NAMESPACE"
+	defaultNamespace = "kube-system"
+)
+
+// resolveSecrets reads the secrets referenced by the providers into their params
+func resolveSecrets(cfg *config.Config) error {
+	for i := range cfg.Providers {
+		prov := &cfg.Providers[i]
+		if prov.SecretRef == nil {
+			continue
+		}
+
+		namespace := prov.SecretRef.Namespace
+		if len(namespace) == 0 {
+			namespace = autopilotNamespace()
+		}
+
+		secret, err := k8s.Instance().GetSecret(prov.SecretRef.Name, namespace)
+		if err != nil {
+			return fmt.Errorf("provider %s: failed to read secret %s/%s: %v",
+				prov.Name, namespace, prov.SecretRef.Name, err)
+		}
+
+		prov.SecretParams = make(map[string]string)
+		for key, value := range secret.Data {
+			prov.SecretParams[key] = string(value)
+		}
+	}
+
+	return nil
+}
+
+// autopilotNamespace returns the namespace autopilot runs in
+func autopilotNamespace() string {
+	if ns := os.Getenv(podNamespaceEnv); len(ns) > 0 {
+		return ns
+	}
+
+	return defaultNamespace
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"sort"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+)
+
+// updateMatchedObjects records the evaluation trees of the objects matched by
+// the evaluated policies. The caller must hold the controller lock.
+func (c *crdController) updateMatchedObjects(matched map[string]map[string]string, evaluated map[string]bool) {
+	for name := range evaluated {
+		objects := matched[name]
+		if objects == nil {
+			objects = make(map[string]string)
+		}
+
+		if reflect.DeepEqual(objects, c.matchedObjects[name]) {
+			continue
+		}
+
+		if len(objects) == 0 && len(c.matchedObjects[name]) == 0 {
+			continue
+		}
+
+		c.matchedObjects[name] = objects
+		c.statusChanged[name] = true
+	}
+
+	for name := range c.matchedObjects {
+		if _, ok := c.storagePolicies[name]; !ok {
+			delete(c.matchedObjects, name)
+		}
+	}
+}
+
+// syncPolicyStatus publishes the deferred actions and the matched objects in
+// the status of the policies that changed. Failed updates are retried on the
+// next call. The caller must hold the controller lock.
+func (c *crdController) syncPolicyStatus() {
+	for name := range c.statusChanged {
+		policy, ok := c.storagePolicies[name]
+		if !ok {
+			delete(c.statusChanged, name)
+			continue
+		}
+
+		actions := make([]autopilot.PendingAction, 0)
+		for _, pending := range c.pendingActions {
+			if pending.policy == name {
+				actions = append(actions, pending.status)
+			}
+		}
+
+		sort.Slice(actions, func(i, j int) bool {
+			return actions[i].Object < actions[j].Object
+		})
+
+		evaluations := make([]autopilot.ObjectEvaluation, 0, len(c.matchedObjects[name]))
+		for object, evaluation := range c.matchedObjects[name] {
+			evaluations = append(evaluations, autopilot.ObjectEvaluation{
+				Object:     object,
+				Evaluation: evaluation,
+			})
+		}
+
+		sort.Slice(evaluations, func(i, j int) bool {
+			return evaluations[i].Object < evaluations[j].Object
+		})
+
+		updated := policy.DeepCopy()
+		updated.Status.PendingActions = actions
+		updated.Status.MatchedObjects = evaluations
+		if err := sdk.Update(updated); err != nil {
+			log.StoragePolicyLog(policy).Errorf("failed to update policy status: %v", err)
+			continue
+		}
+
+		c.storagePolicies[name] = updated
+		delete(c.statusChanged, name)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const metricsNamespace = "autopilot"
+
+var (
+	policyEvaluationDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "policy_evaluation_duration_seconds",
+		Help:      "Time taken to query the providers and evaluate the conditions of a policy.",
+		Buckets:   prom.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"policy"})
+
+	conditionsMet = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "conditions_met_total",
+		Help:      "Number of times the conditions of a policy were met on an object.",
+	}, []string{"policy"})
+
+	actionsTriggered = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "actions_triggered_total",
+		Help:      "Number of policy actions triggered, by action.",
+	}, []string{"action"})
+
+	actionsSucceeded = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "actions_succeeded_total",
+		Help:      "Number of policy actions that were verified, by action.",
+	}, []string{"action"})
+
+	actionsFailed = prom.NewCounterVec(prom.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "actions_failed_total",
+		Help:      "Number of policy actions that were rejected, failed or did not take effect, by action.",
+	}, []string{"action"})
+
+	actionQueueDepth = prom.NewGauge(prom.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "action_queue_depth",
+		Help:      "Number of actions deferred until their policy schedule allows them to run.",
+	})
+
+	lastSuccessfulPoll = prom.NewGauge(prom.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_successful_poll_timestamp_seconds",
+		Help:      "Unix time of the last poll cycle that evaluated the policies without error.",
+	})
+)
+
+func init() {
+	prom.MustRegister(
+		policyEvaluationDuration,
+		conditionsMet,
+		actionsTriggered,
+		actionsSucceeded,
+		actionsFailed,
+		actionQueueDepth,
+		lastSuccessfulPoll,
+	)
+}
+
+// registerMetrics registers the metrics read from the controller state when
+// they are scraped
+func (c *crdController) registerMetrics() {
+	prom.MustRegister(
+		prom.NewGaugeFunc(prom.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "objects_in_cooldown",
+			Help:      "Number of objects left alone after a policy action.",
+		}, func() float64 {
+			c.probationLock.Lock()
+			defer c.probationLock.Unlock()
+			return float64(len(c.objectsInProbation))
+		}),
+		prom.NewGaugeFunc(prom.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "actions_in_flight",
+			Help:      "Number of policy actions waiting for their verification to complete.",
+		}, func() float64 {
+			c.probationLock.Lock()
+			defer c.probationLock.Unlock()
+			return float64(len(c.objectsVerifying))
+		}),
+	)
+}
+
+// serveHTTP serves the autopilot metrics and health endpoints in the background
+func serveHTTP(addr string, h *health) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", h.serveHealthz)
+	mux.HandleFunc("/readyz", h.serveReadyz)
+
+	go func() {
+		logrus.Infof("serving the autopilot metrics and health endpoints on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logrus.Errorf("failed to serve the autopilot endpoints: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libopenstorage/autopilot/audit"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/libopenstorage/autopilot/pkg/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultVerificationTimeout = 5 * time.Minute
+	verificationInterval       = 10 * time.Second
+)
+
+// actionResult describes how to verify and undo an action that was executed
+type actionResult struct {
+	// verify returns true once the action has taken effect
+	verify func() (bool, error)
+	// rollback undoes the action, it is nil if the action can't be undone
+	rollback func() error
+}
+
+// verifyAction waits for the executed action to take effect and reports the
+// outcome. If the verification fails, the action is rolled back when the
+// policy asks for it. The verification is traced as a child of the span of the
+// action.
+func (c *crdController) verifyAction(
+	action *trace.Span,
+	match *policyMatch,
+	result *actionResult,
+) {
+	policy, object := match.policy, match.object
+	defer c.unmarkObjectVerifying(object)
+
+	span := action.Start("action.verify",
+		trace.Attr("policy.name", policy.Name),
+		trace.Attr("object.id", object),
+		trace.Attr("action.name", policy.Spec.Action.Name))
+	defer span.End()
+
+	// the policy may have been evaluated again since the action ran, log the trace of the action
+	logger := log.StoragePolicyTraceLog(policy, span.TraceID())
+
+	spec := policy.Spec.Action.Verification
+	if spec == nil {
+		spec = &autopilot.ActionVerification{}
+	}
+
+	timeout := defaultVerificationTimeout
+	if len(spec.Timeout) > 0 {
+		var err error
+		if timeout, err = time.ParseDuration(spec.Timeout); err != nil {
+			actionsFailed.WithLabelValues(policy.Spec.Action.Name).Inc()
+			c.recordActionFailure(match, fmt.Errorf("invalid verification timeout %q: %v", spec.Timeout, err))
+			return
+		}
+	}
+
+	logger.Infof("verifying action %s on object %s (timeout %v)",
+		policy.Spec.Action.Name, object, timeout)
+
+	err := wait.PollImmediate(verificationInterval, timeout, func() (bool, error) {
+		if result.verify != nil {
+			done, err := result.verify()
+			if err != nil {
+				logger.Warnf("failed to verify action on object %s: %v", object, err)
+				return false, nil
+			}
+
+			if !done {
+				return false, nil
+			}
+		}
+
+		if spec.ConditionsCleared {
+			met, err := c.isConditionMetOnProviders(span, policy, object)
+			if err != nil {
+				// the outcome is unknown until the providers answer, retry on the next step
+				logger.Warnf("failed to query providers to verify action on object %s: %v", object, err)
+				return false, nil
+			}
+
+			return !met, nil
+		}
+
+		return true, nil
+	})
+	if err == nil {
+		actionsSucceeded.WithLabelValues(policy.Spec.Action.Name).Inc()
+		logger.Infof("action %s verified on object %s", policy.Spec.Action.Name, object)
+		msg := fmt.Sprintf("action: %s completed successfully on object: %s",
+			policy.Spec.Action.Name, object)
+		c.recordTracedEvent(policy, span.TraceID(),
+			v1.EventTypeNormal,
+			string(autopilot.StoragePolicyActionSuccessful),
+			msg)
+		c.auditDecision(match, audit.DecisionSucceeded, audit.ReasonVerification, msg)
+		return
+	}
+
+	actionsFailed.WithLabelValues(policy.Spec.Action.Name).Inc()
+	err = fmt.Errorf("action: %s did not take effect on object: %s within %v",
+		policy.Spec.Action.Name, object, timeout)
+	span.RecordError(err)
+	c.recordActionFailure(match, err)
+
+	if !spec.Rollback {
+		return
+	}
+
+	if result.rollback == nil {
+		logger.Warnf("action %s can't be rolled back", policy.Spec.Action.Name)
+		return
+	}
+
+	rollback := span.Start("action.rollback", trace.Attr("policy.name", policy.Name), trace.Attr("object.id", object))
+	err = result.rollback()
+	rollback.RecordError(err)
+	rollback.End()
+	if err != nil {
+		c.recordActionFailure(match, fmt.Errorf("failed to roll back action: %s on object: %s: %v",
+			policy.Spec.Action.Name, object, err))
+		return
+	}
+
+	logger.Infof("rolled back action %s on object %s", policy.Spec.Action.Name, object)
+	msg := fmt.Sprintf("action: %s rolled back on object: %s",
+		policy.Spec.Action.Name, object)
+	c.recordTracedEvent(policy, span.TraceID(),
+		v1.EventTypeNormal,
+		string(autopilot.StoragePolicyActionRolledBack),
+		msg)
+	c.auditDecision(match, audit.DecisionRolledBack, audit.ReasonVerification, msg)
+}
+
+func (c *crdController) recordActionFailure(match *policyMatch, err error) {
+	traceID := match.span.TraceID()
+	log.StoragePolicyTraceLog(match.policy, traceID).Errorln(err)
+	c.recordTracedEvent(match.policy, traceID,
+		v1.EventTypeWarning,
+		string(autopilot.StoragePolicyActionFailed),
+		err.Error())
+	c.auditDecision(match, audit.DecisionFailed, audit.ReasonVerification, err.Error())
+}
+
+// recordTracedEvent records the event of the policy with the given trace ID.
+// The verification outlives the poll cycle of the action, by then the trace ID
+// of the current evaluation of the policy belongs to a later cycle.
+func (c *crdController) recordTracedEvent(policy *autopilot.StoragePolicy, traceID, eventtype, reason, message string) {
+	if len(traceID) == 0 {
+		c.recorder.Event(policy, eventtype, reason, message)
+		return
+	}
+
+	c.recorder.AnnotatedEventf(policy, map[string]string{traceIDAnnotation: traceID}, eventtype, reason, "%s", message)
+}
+
+func (c *crdController) isObjectVerifying(object string) bool {
+	c.probationLock.Lock()
+	defer c.probationLock.Unlock()
+
+	_, present := c.objectsVerifying[object]
+	return present
+}
+
+func (c *crdController) markObjectVerifying(policy *autopilot.StoragePolicy, object string) {
+	c.probationLock.Lock()
+	defer c.probationLock.Unlock()
+
+	c.objectsVerifying[object] = policy.Name
+}
+
+func (c *crdController) unmarkObjectVerifying(object string) {
+	c.probationLock.Lock()
+	defer c.probationLock.Unlock()
+
+	delete(c.objectsVerifying, object)
+}
+
+// isActionLimitReached returns true if the concurrency limits of the
+// configuration don't allow another action of the policy to run until some of
+// the actions in flight complete their verification
+func (c *crdController) isActionLimitReached(policy *autopilot.StoragePolicy) bool {
+	limits := c.config().Concurrency
+
+	c.probationLock.Lock()
+	defer c.probationLock.Unlock()
+
+	if limits.MaxActions > 0 && len(c.objectsVerifying) >= limits.MaxActions {
+		return true
+	}
+
+	if limits.MaxActionsPerPolicy == 0 {
+		return false
+	}
+
+	inFlight := 0
+	for _, name := range c.objectsVerifying {
+		if name == policy.Name {
+			inFlight++
+		}
+	}
+
+	return inFlight >= limits.MaxActionsPerPolicy
+}
+
+// isConditionMetOnProviders returns true if the policy conditions are still
+// met on the object. The providers are looked up under the controller lock
+// since a reload closes the providers in use when the action ran.
+func (c *crdController) isConditionMetOnProviders(
+	span *trace.Span,
+	policy *autopilot.StoragePolicy,
+	object string,
+) (bool, error) {
+	c.lock()
+	defer c.unlock()
+
+	vecs, err := queryPolicy(span, c.providers, c.defaultProvider(), policy)
+	if err != nil {
+		return false, err
+	}
+
+	return isConditionMetOnObject(policy, object, vecs), nil
+}
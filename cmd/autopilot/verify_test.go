@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kubernetes/client-go/tools/record"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// tracingRecorder keeps the trace ID annotation of every recorded event
+type tracingRecorder struct {
+	*record.FakeRecorder
+	traceIDs []string
+}
+
+func (r *tracingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.traceIDs = append(r.traceIDs, "")
+	r.FakeRecorder.Event(object, eventtype, reason, message)
+}
+
+func (r *tracingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string,
+	eventtype, reason, messageFmt string, args ...interface{}) {
+	r.traceIDs = append(r.traceIDs, annotations[traceIDAnnotation])
+	r.FakeRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+func TestVerificationTraceID(t *testing.T) {
+	policy := newPolicy("resize", "", 0)
+	c, _ := newTestController(policy)
+	recorder := &tracingRecorder{FakeRecorder: record.NewFakeRecorder(10)}
+	c.recorder = &notifyingRecorder{EventRecorder: recorder}
+
+	// the next poll cycle evaluates the policy while the action is verified
+	log.SetStoragePolicyTraceID(policy, "next-cycle")
+	defer log.SetStoragePolicyTraceID(policy, "")
+
+	c.recordTracedEvent(policy, "action-cycle", v1.EventTypeNormal,
+		string(autopilot.StoragePolicyActionSuccessful), "action: resize completed")
+	c.recorder.Event(policy, v1.EventTypeNormal, string(autopilot.StoragePolicyActionTriggered), "action: resize triggered")
+
+	require.Equal(t, []string{"action-cycle", "next-cycle"}, recorder.traceIDs,
+		"Expected the verification event to keep the trace of the action")
+	require.Equal(t, []string{
+		"Normal " + string(autopilot.StoragePolicyActionSuccessful) + " action: resize completed",
+		"Normal " + string(autopilot.StoragePolicyActionTriggered) + " action: resize triggered",
+	}, events(recorder.FakeRecorder))
+
+	entry := log.StoragePolicyTraceLog(policy, "action-cycle")
+	require.Equal(t, "action-cycle", entry.Data[log.TraceIDField])
+	require.Equal(t, "next-cycle", log.StoragePolicyLog(policy).Data[log.TraceIDField])
+}
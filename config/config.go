@@ -17,37 +17,286 @@ limitations under the License.
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
+const (
+	// Version is the version of the configuration schema
+	Version = "v1"
+	// DefaultPollRate is the poll rate of the metrics providers when the configuration doesn't set one
+	DefaultPollRate = "10s"
+)
+
+// SecretRef names a kubernetes secret whose keys are added to the params of a
+// provider, so credentials don't have to be written in the configuration
+type SecretRef struct {
+	Name string `yaml:"name"`
+	// Namespace defaults to the namespace autopilot runs in
+	Namespace string `yaml:"namespace"`
+}
+
 // MetricsProvider provides metrics data to autopilot
 type MetricsProvider struct {
+	Name             string     `yaml:"name"`
+	Type             string     `yaml:"type"`
+	Params           string     `yaml:"params"`
+	SecretRef        *SecretRef `yaml:"secretRef"`
+	Timeout          string     `yaml:"timeout"`
+	Retries          *int       `yaml:"retries"`
+	RetryBackoff     string     `yaml:"retry_backoff"`
+	FailureThreshold int        `yaml:"failure_threshold"`
+	ResetTimeout     string     `yaml:"reset_timeout"`
+
+	// SecretParams are the params read from the secret of the provider
+	SecretParams map[string]string `yaml:"-"`
+}
+
+// Notifier sends the policy events to a notification channel
+type Notifier struct {
 	Name   string `yaml:"name"`
 	Type   string `yaml:"type"`
 	Params string `yaml:"params"`
+	// Policies are the name patterns of the policies notified, all policies if empty
+	Policies []string `yaml:"policies"`
+	// Events are the event reasons notified, all the notified reasons if empty
+	Events []string `yaml:"events"`
+	// Severity is the lowest severity notified, info, warning or error
+	Severity string `yaml:"severity"`
+	// DedupWindow is the time the same notification is not sent again
+	DedupWindow string `yaml:"dedup_window"`
+}
+
+// ConcurrencyLimits limit the number of policy actions in flight, until their
+// verification completes. Zero means no limit.
+type ConcurrencyLimits struct {
+	MaxActions          int `yaml:"max_actions"`
+	MaxActionsPerPolicy int `yaml:"max_actions_per_policy"`
 }
 
 // Config defines the autopilot configuration structure
 type Config struct {
-	Providers      []MetricsProvider `yaml:"providers"`
-	PollRate       string            `yaml:"poll_rate"`
-	CooldownPeriod int               `yaml:"cool_down_rate"`
+	Version         string            `yaml:"version"`
+	Providers       []MetricsProvider `yaml:"providers"`
+	PollRate        string            `yaml:"poll_rate"`
+	CooldownPeriod  int               `yaml:"cool_down_rate"`
+	DryRun          bool              `yaml:"dry_run"`
+	StorageEndpoint string            `yaml:"storage_endpoint"`
+	StorageTLS      string            `yaml:"storage_tls"`
+	Concurrency     ConcurrencyLimits `yaml:"concurrency"`
+	Notifiers       []Notifier        `yaml:"notifiers"`
+
+	// lines of the settings in the configuration file, to report problems
+	lines map[string]int
 }
 
-// ReadFile reads a configuration file
+// ReadFile reads a configuration file, see Parse
 func ReadFile(f string) (*Config, error) {
-	config := &Config{}
-
 	data, err := ioutil.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(data, config); err != nil {
+	return Parse(data)
+}
+
+// ReadFileStrict reads a configuration file, see ParseStrict
+func ReadFileStrict(f string) (*Config, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
 		return nil, err
 	}
 
+	return ParseStrict(data)
+}
+
+// Parse parses a configuration document. The ${NAME} references are replaced
+// with the value of the environment variables, or with the default of a
+// ${NAME:-default} reference if the variable is not set. The settings that
+// are not set get their default and the configuration is validated. All the
+// problems of the document are returned as Problems, along with the
+// configuration when the document could be parsed. Unknown settings are
+// logged and ignored, so a configuration written for a newer autopilot still
+// loads.
+func Parse(data []byte) (*Config, error) {
+	return parse(data, false)
+}
+
+// ParseStrict parses a configuration document like Parse, except that unknown
+// settings are reported as problems
+func ParseStrict(data []byte) (*Config, error) {
+	return parse(data, true)
+}
+
+func parse(data []byte, strict bool) (*Config, error) {
+	data, problems := expandEnv(data)
+
+	unmarshal := yaml.Unmarshal
+	if strict {
+		unmarshal = yaml.UnmarshalStrict
+	} else if err := yaml.UnmarshalStrict(data, &Config{}); err != nil {
+		if _, ok := err.(*yaml.TypeError); ok {
+			for _, problem := range yamlProblems(err) {
+				logrus.Warnf("config: ignoring %v", problem)
+			}
+		}
+	}
+
+	config := &Config{}
+	if err := unmarshal(data, config); err != nil {
+		problems = append(problems, yamlProblems(err)...)
+		if _, ok := err.(*yaml.TypeError); !ok {
+			// the document could not be parsed
+			return nil, problems
+		}
+	}
+
+	config.lines = lineIndex(data)
+	config.SetDefaults()
+
+	if err := config.Validate(); err != nil {
+		problems = append(problems, err.(Problems)...)
+	}
+
+	if len(problems) > 0 {
+		problems.Sort()
+		return config, problems
+	}
+
 	return config, nil
 }
+
+// SetDefaults sets the default of the settings that are not set
+func (c *Config) SetDefaults() {
+	if len(c.Version) == 0 {
+		c.Version = Version
+	}
+
+	if len(c.PollRate) == 0 {
+		c.PollRate = DefaultPollRate
+	}
+}
+
+// Problem returns a problem of the setting at the given path, such as
+// providers[0].timeout, on the line of the setting
+func (c *Config) Problem(path, format string, args ...interface{}) Problem {
+	return Problem{
+		Line:    lookupLine(c.lines, path),
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Validate checks that the configuration can be used to run autopilot. It
+// returns all the problems found as Problems.
+func (c *Config) Validate() error {
+	problems := make(Problems, 0)
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, c.Problem(path, format, args...))
+	}
+
+	if len(c.Version) > 0 && c.Version != Version {
+		add("version", "unsupported version %q, the supported version is %s", c.Version, Version)
+	}
+
+	if len(c.Providers) == 0 {
+		add("providers", "no metrics providers")
+	}
+
+	names := make(map[string]bool)
+	for i, prov := range c.Providers {
+		path := fmt.Sprintf("providers[%d]", i)
+
+		if len(prov.Name) == 0 {
+			add(path+".name", "provider has no name")
+		} else if names[prov.Name] {
+			add(path+".name", "duplicate provider %s", prov.Name)
+		}
+		names[prov.Name] = true
+
+		if len(prov.Type) == 0 {
+			add(path+".type", "provider has no type")
+		}
+
+		durations := []struct {
+			name  string
+			value string
+		}{
+			{"timeout", prov.Timeout},
+			{"retry_backoff", prov.RetryBackoff},
+			{"reset_timeout", prov.ResetTimeout},
+		}
+
+		for _, d := range durations {
+			if len(d.value) == 0 {
+				continue
+			}
+
+			if _, err := time.ParseDuration(d.value); err != nil {
+				add(path+"."+d.name, "invalid duration %q", d.value)
+			}
+		}
+
+		if prov.Retries != nil && *prov.Retries < 0 {
+			add(path+".retries", "must not be negative, got %d", *prov.Retries)
+		}
+
+		if prov.FailureThreshold < 0 {
+			add(path+".failure_threshold", "must not be negative, got %d", prov.FailureThreshold)
+		}
+
+		if prov.SecretRef != nil && len(prov.SecretRef.Name) == 0 {
+			add(path+".secretRef.name", "secret has no name")
+		}
+	}
+
+	notifiers := make(map[string]bool)
+	for i, notifier := range c.Notifiers {
+		path := fmt.Sprintf("notifiers[%d]", i)
+
+		if len(notifier.Name) == 0 {
+			add(path+".name", "notifier has no name")
+		} else if notifiers[notifier.Name] {
+			add(path+".name", "duplicate notifier %s", notifier.Name)
+		}
+		notifiers[notifier.Name] = true
+
+		if len(notifier.Type) == 0 {
+			add(path+".type", "notifier has no type")
+		}
+
+		if len(notifier.DedupWindow) > 0 {
+			if _, err := time.ParseDuration(notifier.DedupWindow); err != nil {
+				add(path+".dedup_window", "invalid duration %q", notifier.DedupWindow)
+			}
+		}
+	}
+
+	if pollRate, err := time.ParseDuration(c.PollRate); err != nil {
+		add("poll_rate", "invalid duration %q", c.PollRate)
+	} else if pollRate <= 0 {
+		add("poll_rate", "must be positive, got %s", c.PollRate)
+	}
+
+	if c.CooldownPeriod < 0 {
+		add("cool_down_rate", "must not be negative, got %d", c.CooldownPeriod)
+	}
+
+	if c.Concurrency.MaxActions < 0 {
+		add("concurrency.max_actions", "must not be negative, got %d", c.Concurrency.MaxActions)
+	}
+
+	if c.Concurrency.MaxActionsPerPolicy < 0 {
+		add("concurrency.max_actions_per_policy", "must not be negative, got %d", c.Concurrency.MaxActionsPerPolicy)
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `providers:
+  - name: default
+    type: prometheus
+    params: url=http://prometheus:9090/api/v1
+poll_rate: 5s
+`
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			Providers: []MetricsProvider{{Name: "default", Type: "prometheus"}},
+			PollRate:  "5s",
+		}
+	}
+
+	require.NoError(t, valid().Validate())
+
+	cfg := valid()
+	cfg.Providers = nil
+	require.Error(t, cfg.Validate(), "no providers")
+
+	cfg = valid()
+	cfg.Providers = append(cfg.Providers, MetricsProvider{Name: "default", Type: "kubelet"})
+	require.Error(t, cfg.Validate(), "duplicate provider")
+
+	cfg = valid()
+	cfg.Providers[0].Type = ""
+	require.Error(t, cfg.Validate(), "provider without type")
+
+	cfg = valid()
+	cfg.PollRate = "5"
+	require.Error(t, cfg.Validate(), "poll rate without unit")
+
+	cfg = valid()
+	cfg.PollRate = "0s"
+	require.Error(t, cfg.Validate(), "zero poll rate")
+
+	cfg = valid()
+	cfg.CooldownPeriod = -1
+	require.Error(t, cfg.Validate(), "negative cooldown")
+
+	cfg = valid()
+	cfg.Notifiers = []Notifier{{Name: "slack", Type: "slack", DedupWindow: "30m"}}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Notifiers = append(cfg.Notifiers, Notifier{Name: "slack", Type: "teams"})
+	require.Error(t, cfg.Validate(), "duplicate notifier")
+
+	cfg.Notifiers = []Notifier{{Name: "slack"}}
+	require.Error(t, cfg.Validate(), "notifier without type")
+
+	cfg.Notifiers = []Notifier{{Name: "slack", Type: "slack", DedupWindow: "30"}}
+	require.Error(t, cfg.Validate(), "dedup window without unit")
+}
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(`providers:
+  - name: default
+    type: prometheus
+`))
+	require.NoError(t, err)
+	require.Equal(t, Version, cfg.Version)
+	require.Equal(t, DefaultPollRate, cfg.PollRate)
+}
+
+func TestParseProblems(t *testing.T) {
+	_, err := Parse([]byte(`version: v2
+providers:
+  # the default provider
+  - name: default
+    type: prometheus
+    params: >-
+      url=https://prometheus:9090/api/v1
+      timeout: 5
+    timeout: 30
+  - type: kubelet
+    retries: -1
+    secretRef:
+      namespace: kube-system
+poll_rate: 5
+cool_down_rate: -1
+`))
+	require.Error(t, err)
+
+	problems, ok := err.(Problems)
+	require.True(t, ok, "expected problems, got %T", err)
+
+	expected := []string{
+		"line 1: version: unsupported version \"v2\", the supported version is v1",
+		"line 9: providers[0].timeout: invalid duration \"30\"",
+		"line 10: providers[1].name: provider has no name",
+		"line 11: providers[1].retries: must not be negative, got -1",
+		"line 12: providers[1].secretRef.name: secret has no name",
+		"line 14: poll_rate: invalid duration \"5\"",
+		"line 15: cool_down_rate: must not be negative, got -1",
+	}
+
+	actual := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		actual = append(actual, problem.Error())
+	}
+	require.Equal(t, expected, actual)
+}
+
+func TestParseUnknownField(t *testing.T) {
+	cfg, err := Parse([]byte(testConfig + "poll_rat: 5s\n"))
+	require.NoError(t, err, "Expected unknown settings to be ignored")
+	require.Equal(t, "5s", cfg.PollRate)
+
+	_, err = ParseStrict([]byte(testConfig + "poll_rat: 5s\n"))
+	require.Error(t, err)
+
+	problems, ok := err.(Problems)
+	require.True(t, ok, "expected problems, got %T", err)
+	require.Len(t, problems, 1)
+	require.Equal(t, 6, problems[0].Line)
+	require.Contains(t, problems[0].Message, "field poll_rat not found")
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	_, err := Parse([]byte("providers:\n  - name: default\n   type: prometheus\n"))
+	require.Error(t, err)
+
+	problems, ok := err.(Problems)
+	require.True(t, ok, "expected problems, got %T", err)
+	require.Len(t, problems, 1)
+	require.NotZero(t, problems[0].Line)
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("AUTOPILOT_TEST_URL", "http://prometheus:9090/api/v1")
+	defer os.Unsetenv("AUTOPILOT_TEST_URL")
+	os.Unsetenv("AUTOPILOT_TEST_UNSET")
+
+	cfg, err := Parse([]byte(`# ${AUTOPILOT_TEST_UNSET} is not expanded in comments
+providers:
+  - name: default
+    type: prometheus # ${AUTOPILOT_TEST_UNSET}
+    params: url=${AUTOPILOT_TEST_URL} header.X-Literal=$${AUTOPILOT_TEST_URL}
+poll_rate: ${AUTOPILOT_TEST_UNSET:-30s}
+`))
+	require.NoError(t, err)
+	require.Equal(t, "url=http://prometheus:9090/api/v1 header.X-Literal=${AUTOPILOT_TEST_URL}", cfg.Providers[0].Params)
+	require.Equal(t, "30s", cfg.PollRate)
+
+	_, err = Parse([]byte(testConfig + "storage_endpoint: ${AUTOPILOT_TEST_UNSET}\n"))
+	require.Error(t, err)
+	problems := err.(Problems)
+	require.Len(t, problems, 1)
+	require.Equal(t, 6, problems[0].Line)
+	require.Contains(t, problems[0].Message, "AUTOPILOT_TEST_UNSET")
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autopilot-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(f, []byte(testConfig), 0644))
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	changed := Watch(f, 10*time.Millisecond, stop)
+
+	select {
+	case <-changed:
+		t.Fatal("unchanged file reported as changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// replace the file like kubernetes does for config maps
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte(testConfig+"cool_down_rate: 60\n"), 0644))
+	require.NoError(t, os.Rename(tmp, f))
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("changed file not reported")
+	}
+
+	cfg, err := ReadFile(f)
+	require.NoError(t, err)
+	require.Equal(t, 60, cfg.CooldownPeriod)
+}
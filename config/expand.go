@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+)
+
+// envRegex matches the ${NAME} and ${NAME:-default} references, and the
+// $${NAME} escapes of the references that are kept as they are
+var envRegex = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv replaces the environment variable references of the document,
+// except in comments. The references to variables that are not set and have
+// no default are problems.
+func expandEnv(data []byte) ([]byte, Problems) {
+	problems := make(Problems, 0)
+
+	var out bytes.Buffer
+	last := 0
+	for _, loc := range envRegex.FindAllSubmatchIndex(data, -1) {
+		out.Write(data[last:loc[0]])
+		last = loc[1]
+
+		ref := data[loc[0]:loc[1]]
+		if inComment(data, loc[0]) {
+			out.Write(ref)
+			continue
+		}
+
+		if bytes.HasPrefix(ref, []byte("$$")) {
+			out.Write(ref[1:])
+			continue
+		}
+
+		name := string(data[loc[2]:loc[3]])
+		if value, ok := os.LookupEnv(name); ok {
+			out.WriteString(value)
+			continue
+		}
+
+		if loc[4] >= 0 {
+			// skip the :- of the default
+			out.Write(data[loc[4]+2 : loc[5]])
+			continue
+		}
+
+		problems = append(problems, Problem{
+			Line:    bytes.Count(data[:loc[0]], []byte("\n")) + 1,
+			Message: "environment variable " + name + " is not set",
+		})
+	}
+	out.Write(data[last:])
+
+	return out.Bytes(), problems
+}
+
+// inComment returns true if the offset of the document is in a comment
+func inComment(data []byte, offset int) bool {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	prefix := data[start:offset]
+
+	return bytes.HasPrefix(bytes.TrimLeft(prefix, " \t"), []byte("#")) ||
+		bytes.Contains(prefix, []byte(" #"))
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type lineFrame struct {
+	indent int
+	path   string
+	item   bool
+	items  int
+}
+
+// lineIndex returns the line of every setting of a yaml document by its path,
+// such as providers[0].timeout. It only understands the block style used by
+// the configuration files, flow style collections are indexed by their key.
+func lineIndex(data []byte) map[string]int {
+	lines := make(map[string]int)
+	stack := []*lineFrame{{indent: -1}}
+
+	// indentation of the block scalar being skipped, -1 outside of one
+	block := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if block >= 0 {
+			if indent > block {
+				continue
+			}
+			block = -1
+		}
+
+		isItem := text == "-" || strings.HasPrefix(text, "- ")
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			if indent > top.indent || (isItem && !top.item && indent == top.indent) {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		if isItem {
+			parent := stack[len(stack)-1]
+			path := fmt.Sprintf("%s[%d]", parent.path, parent.items)
+			parent.items++
+			lines[path] = n
+
+			stack = append(stack, &lineFrame{indent: indent, path: path, item: true})
+
+			rest := strings.TrimLeft(text[1:], " ")
+			indent += len(text) - len(rest)
+			text = rest
+		}
+
+		key, value, ok := splitKey(text)
+		if !ok {
+			continue
+		}
+
+		parent := stack[len(stack)-1]
+		path := key
+		if len(parent.path) > 0 {
+			path = parent.path + "." + key
+		}
+		lines[path] = n
+
+		stack = append(stack, &lineFrame{indent: indent, path: path})
+
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			block = indent
+		}
+	}
+
+	return lines
+}
+
+// splitKey splits a "key: value" line
+func splitKey(text string) (string, string, bool) {
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+
+	key := strings.Trim(text[:i], `"' `)
+	if len(key) == 0 {
+		return "", "", false
+	}
+
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// lookupLine returns the line of the setting, or the line of its closest
+// parent when the setting is missing
+func lookupLine(lines map[string]int, path string) int {
+	for len(path) > 0 {
+		if n, ok := lines[path]; ok {
+			return n
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return 0
+}
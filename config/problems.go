@@ -0,0 +1,91 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Problem is an error found in a configuration
+type Problem struct {
+	// Line is the line of the problem in the configuration file, 0 if it is not known
+	Line int
+	// Path is the setting of the problem, such as providers[0].timeout
+	Path    string
+	Message string
+}
+
+func (p Problem) Error() string {
+	msg := p.Message
+	if len(p.Path) > 0 {
+		msg = p.Path + ": " + msg
+	}
+
+	if p.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", p.Line, msg)
+	}
+
+	return msg
+}
+
+// Problems are all the errors found in a configuration
+type Problems []Problem
+
+func (p Problems) Error() string {
+	msgs := make([]string, 0, len(p))
+	for _, problem := range p {
+		msgs = append(msgs, problem.Error())
+	}
+
+	return "config: " + strings.Join(msgs, "; ")
+}
+
+// Sort sorts the problems by line
+func (p Problems) Sort() {
+	sort.SliceStable(p, func(i, j int) bool {
+		return p[i].Line < p[j].Line
+	})
+}
+
+// yamlProblems returns the problems of a yaml parsing error
+func yamlProblems(err error) Problems {
+	msgs := []string{err.Error()}
+	if terr, ok := err.(*yaml.TypeError); ok {
+		msgs = terr.Errors
+	}
+
+	problems := make(Problems, 0, len(msgs))
+	for _, msg := range msgs {
+		problem := Problem{Message: msg}
+		if match := yamlLineRegex.FindStringSubmatch(msg); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+			problem.Message = match[2]
+		}
+
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+)
+
+// Watch polls the configuration file every interval and returns a channel
+// that fires when its content changes. The content is compared rather than the
+// modification time since kubernetes updates mounted config maps by swapping a
+// symlink. The watch ends when stop is closed.
+func Watch(f string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	last := checksum(f)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sum := checksum(f)
+				if sum == nil || bytes.Equal(sum, last) {
+					// a file being replaced can be missing for a moment
+					continue
+				}
+				last = sum
+
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return changed
+}
+
+func checksum(f string) []byte {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+// samplesPerWindow is the number of samples fetched over a lookback window when no step is given
+const samplesPerWindow = 60
+
+// Sample is a single [timestamp, value] point of a vector
+type Sample struct {
+	Time  float64
+	Value float64
+}
+
+// ParseSample parses a [timestamp, "value"] pair as returned by the prometheus api
+func ParseSample(pair []interface{}) (Sample, error) {
+	if len(pair) != 2 {
+		return Sample{}, fmt.Errorf("metrics: invalid sample %v", pair)
+	}
+
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("metrics: invalid sample timestamp %v", pair[0])
+	}
+
+	var value float64
+	switch v := pair[1].(type) {
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Sample{}, fmt.Errorf("metrics: invalid sample value %q", v)
+		}
+		value = parsed
+	case float64:
+		value = v
+	default:
+		return Sample{}, fmt.Errorf("metrics: invalid sample value %v", pair[1])
+	}
+
+	return Sample{Time: ts, Value: value}, nil
+}
+
+// RangeParams returns the lookback window and step of the aggregation
+func RangeParams(agg *autopilot.ConditionAggregation) (time.Duration, time.Duration, error) {
+	window, err := time.ParseDuration(agg.Window)
+	if err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("metrics: invalid aggregation window %q", agg.Window)
+	}
+
+	if len(agg.Step) > 0 {
+		step, err := time.ParseDuration(agg.Step)
+		if err != nil || step <= 0 {
+			return 0, 0, fmt.Errorf("metrics: invalid aggregation step %q", agg.Step)
+		}
+		return window, step, nil
+	}
+
+	step := window / samplesPerWindow
+	if step < time.Second {
+		step = time.Second
+	}
+
+	return window, step.Round(time.Second), nil
+}
+
+// Reduce reduces the values of a range vector to a single value using the aggregation function
+func Reduce(agg *autopilot.ConditionAggregation, values [][]interface{}) (float64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("metrics: no samples to aggregate")
+	}
+
+	samples := make([]Sample, 0, len(values))
+	for _, pair := range values {
+		sample, err := ParseSample(pair)
+		if err != nil {
+			return 0, err
+		}
+		samples = append(samples, sample)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Time < samples[j].Time
+	})
+
+	first, last := samples[0], samples[len(samples)-1]
+
+	switch agg.Function {
+	case autopilot.AggregationAvg:
+		return sum(samples) / float64(len(samples)), nil
+	case autopilot.AggregationSum:
+		return sum(samples), nil
+	case autopilot.AggregationMin:
+		min := math.Inf(1)
+		for _, s := range samples {
+			min = math.Min(min, s.Value)
+		}
+		return min, nil
+	case autopilot.AggregationMax:
+		max := math.Inf(-1)
+		for _, s := range samples {
+			max = math.Max(max, s.Value)
+		}
+		return max, nil
+	case autopilot.AggregationLast:
+		return last.Value, nil
+	case autopilot.AggregationDelta:
+		return last.Value - first.Value, nil
+	case autopilot.AggregationRate:
+		if last.Time == first.Time {
+			return 0, nil
+		}
+		return (last.Value - first.Value) / (last.Time - first.Time), nil
+	case autopilot.AggregationPercentile:
+		return percentile(samples, agg.Percentile)
+	default:
+		return 0, fmt.Errorf("metrics: unsupported aggregation function %q", agg.Function)
+	}
+}
+
+// Compare returns true if the value satisfies the condition operator against the threshold
+func Compare(operator autopilot.LabelSelectorOperator, value float64, threshold string) (bool, error) {
+	t, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return false, fmt.Errorf("metrics: invalid condition value %q", threshold)
+	}
+
+	switch strings.ToLower(string(operator)) {
+	case "gt":
+		return value > t, nil
+	case "lt":
+		return value < t, nil
+	case "eq":
+		return value == t, nil
+	default:
+		return false, fmt.Errorf("metrics: unsupported condition operator %q", operator)
+	}
+}
+
+func sum(samples []Sample) float64 {
+	total := 0.0
+	for _, s := range samples {
+		total += s.Value
+	}
+	return total
+}
+
+// percentile returns the p-th percentile of the samples interpolating between the closest ranks
+func percentile(samples []Sample, p float64) (float64, error) {
+	if p < 0 || p > 100 {
+		return 0, fmt.Errorf("metrics: invalid percentile %v", p)
+	}
+
+	values := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		values = append(values, s.Value)
+	}
+	sort.Float64s(values)
+
+	rank := p / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return values[lower], nil
+	}
+
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower)), nil
+}
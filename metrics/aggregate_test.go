@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReduce(t *testing.T) {
+	values := [][]interface{}{
+		{float64(120), "40"},
+		{float64(0), "10"},
+		{float64(60), "20"},
+		{float64(180), "30"},
+	}
+
+	tests := []struct {
+		agg      autopilot.ConditionAggregation
+		expected float64
+	}{
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationAvg}, 25},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationMin}, 10},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationMax}, 40},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationSum}, 100},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationLast}, 30},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationDelta}, 20},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationRate}, 20.0 / 180},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationPercentile, Percentile: 50}, 25},
+		{autopilot.ConditionAggregation{Function: autopilot.AggregationPercentile, Percentile: 100}, 40},
+	}
+
+	for _, test := range tests {
+		value, err := Reduce(&test.agg, values)
+		require.NoError(t, err, "Failed to reduce with %s", test.agg.Function)
+		require.InDelta(t, test.expected, value, 1e-9, "Unexpected value for %s", test.agg.Function)
+	}
+
+	_, err := Reduce(&autopilot.ConditionAggregation{Function: "median"}, values)
+	require.Error(t, err, "Expected unknown function to fail")
+
+	_, err = Reduce(&autopilot.ConditionAggregation{Function: autopilot.AggregationAvg}, nil)
+	require.Error(t, err, "Expected empty series to fail")
+}
+
+func TestRangeParams(t *testing.T) {
+	window, step, err := RangeParams(&autopilot.ConditionAggregation{Window: "30m"})
+	require.NoError(t, err, "Failed to parse range params")
+	require.Equal(t, 30*time.Minute, window)
+	require.Equal(t, 30*time.Second, step)
+
+	_, step, err = RangeParams(&autopilot.ConditionAggregation{Window: "30s"})
+	require.NoError(t, err, "Failed to parse range params")
+	require.Equal(t, time.Second, step, "Expected step to be at least a second")
+
+	_, _, err = RangeParams(&autopilot.ConditionAggregation{Window: "10m", Step: "bogus"})
+	require.Error(t, err, "Expected invalid step to fail")
+}
+
+func TestCompare(t *testing.T) {
+	met, err := Compare("gt", 25, "20")
+	require.NoError(t, err)
+	require.True(t, met)
+
+	met, err = Compare("LT", 25, "20")
+	require.NoError(t, err)
+	require.False(t, met)
+
+	_, err = Compare("In", 25, "20")
+	require.Error(t, err, "Expected unsupported operator to fail")
+}
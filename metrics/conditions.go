@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"strings"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+// Condition metrics resolved by the providers that don't take raw queries
+const (
+	// VolumeUsagePercentage is the percentage of the volume capacity in use
+	VolumeUsagePercentage = "volume.usage_percentage"
+	// VolumeUsageGB is the volume space in use in GiB
+	VolumeUsageGB = "volume.usage_gb"
+	// VolumeCapacityGB is the volume capacity in GiB
+	VolumeCapacityGB = "volume.capacity_gb"
+	// VolumeAvailableGB is the volume space available in GiB
+	VolumeAvailableGB = "volume.available_gb"
+	// VolumeInodesPercentage is the percentage of the volume inodes in use
+	VolumeInodesPercentage = "volume.inodes_percentage"
+	// VolumeLatencyMS is the average latency of the volume reads and writes in milliseconds
+	VolumeLatencyMS = "volume.latency_ms"
+	// VolumeIOPS is the number of volume reads and writes per second
+	VolumeIOPS = "volume.iops"
+	// StoragePoolUsagePercentage is the percentage of the storage pool capacity in use
+	StoragePoolUsagePercentage = "storagepool.usage_percentage"
+	// StoragePoolCapacityGB is the storage pool capacity in GiB
+	StoragePoolCapacityGB = "storagepool.capacity_gb"
+	// StoragePoolLatencyMS is the average latency of the storage pool in milliseconds
+	StoragePoolLatencyMS = "storagepool.latency_ms"
+)
+
+// conditionKeyPrefixes are stripped from the condition keys, such as
+// openstorage.io/condition.volume.usage_percentage or the
+// openstorage.io.object.volume/latency_ms PolicyCondition constants
+var conditionKeyPrefixes = []string{
+	autopilot.PolicyConditionPrefix + ".",
+	autopilot.PolicyObjectPrefix + ".",
+	"openstorage.io/condition.",
+	"openstorage.io/object.",
+}
+
+// ConditionMetric returns the metric name of the condition key, such as
+// volume.usage_percentage for openstorage.io/condition.volume.usage_percentage.
+// Keys without a known prefix are returned unchanged.
+func ConditionMetric(key string) string {
+	for _, prefix := range conditionKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return strings.Replace(strings.TrimPrefix(key, prefix), "/", ".", -1)
+		}
+	}
+
+	return key
+}
+
+// LabelsToMetric maps the labels of a series on the metric fields with the
+// same json name, such as volumename, pvc, namespace or alertname
+func LabelsToMetric(labels map[string]string) (Metric, error) {
+	m := Metric{}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return m, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
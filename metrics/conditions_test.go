@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"testing"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionMetric(t *testing.T) {
+	require.Equal(t, VolumeUsagePercentage, ConditionMetric("openstorage.io/condition.volume.usage_percentage"))
+	require.Equal(t, VolumeCapacityGB, ConditionMetric("openstorage.io.condition.volume.capacity_gb"))
+	require.Equal(t, VolumeLatencyMS, ConditionMetric(string(autopilot.PolicyConditionVolumeLatencyMS)))
+	require.Equal(t, StoragePoolLatencyMS, ConditionMetric(string(autopilot.PolicyConditionStoragePoolLatencyMS)))
+	require.Equal(t, "kubelet_volume_stats_used_bytes", ConditionMetric("kubelet_volume_stats_used_bytes"))
+}
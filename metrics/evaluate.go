@@ -0,0 +1,157 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+const (
+	exprAllOf = "allOf"
+	exprAnyOf = "anyOf"
+	exprNot   = "not"
+)
+
+// Evaluation is a node of the evaluation tree of the conditions of a policy on an object
+type Evaluation struct {
+	// Expression is allOf, anyOf, not or the condition of a leaf
+	Expression string
+	// Met is true if the expression is met on the object
+	Met bool
+	// Children are the evaluations of the operands of allOf, anyOf and not
+	Children []*Evaluation
+}
+
+// Evaluate evaluates the conditions and the match group of the policy on the
+// object. The conditions list and the match group must both be met.
+func (r *ResultSet) Evaluate(spec *autopilot.StoragePolicySpec, object string) *Evaluation {
+	index := 0
+	root := &Evaluation{Expression: exprAllOf}
+
+	for _, c := range spec.Conditions {
+		root.Children = append(root.Children, r.evaluateCondition(c, &index, object))
+	}
+
+	if spec.Match != nil {
+		root.Children = append(root.Children, r.evaluateGroup(spec.Match, &index, object))
+	}
+
+	root.Met = allMet(root.Children)
+	return root
+}
+
+// evaluateGroup evaluates the group consuming its conditions in the order of
+// StoragePolicySpec.ConditionList. A group with more than one field set is
+// evaluated as the allOf of its fields.
+func (r *ResultSet) evaluateGroup(g *autopilot.ConditionGroup, index *int, object string) *Evaluation {
+	parts := make([]*Evaluation, 0, 1)
+
+	if g.Condition != nil {
+		parts = append(parts, r.evaluateCondition(g.Condition, index, object))
+	}
+
+	if len(g.AllOf) > 0 {
+		e := &Evaluation{Expression: exprAllOf}
+		for i := range g.AllOf {
+			e.Children = append(e.Children, r.evaluateGroup(&g.AllOf[i], index, object))
+		}
+		e.Met = allMet(e.Children)
+		parts = append(parts, e)
+	}
+
+	if len(g.AnyOf) > 0 {
+		e := &Evaluation{Expression: exprAnyOf}
+		for i := range g.AnyOf {
+			child := r.evaluateGroup(&g.AnyOf[i], index, object)
+			e.Children = append(e.Children, child)
+			e.Met = e.Met || child.Met
+		}
+		parts = append(parts, e)
+	}
+
+	if g.Not != nil {
+		child := r.evaluateGroup(g.Not, index, object)
+		parts = append(parts, &Evaluation{
+			Expression: exprNot,
+			Met:        !child.Met,
+			Children:   []*Evaluation{child},
+		})
+	}
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return &Evaluation{Expression: exprAllOf, Met: allMet(parts), Children: parts}
+}
+
+func (r *ResultSet) evaluateCondition(c *autopilot.LabelSelectorRequirement, index *int, object string) *Evaluation {
+	e := &Evaluation{
+		Expression: fmt.Sprintf("%s %s %s", c.Key, c.Operator, strings.Join(c.Values, ",")),
+		Met:        r.Matched(object, *index),
+	}
+	*index++
+
+	return e
+}
+
+// allMet returns true if there is at least one evaluation and all of them are met
+func allMet(evaluations []*Evaluation) bool {
+	for _, e := range evaluations {
+		if !e.Met {
+			return false
+		}
+	}
+
+	return len(evaluations) > 0
+}
+
+// String returns the evaluation tree with one expression per line
+func (e *Evaluation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (e *Evaluation) write(b *strings.Builder, depth int) {
+	met := "not met"
+	if e.Met {
+		met = "met"
+	}
+
+	fmt.Fprintf(b, "%s%s => %s\n", strings.Repeat("  ", depth), e.Expression, met)
+	for _, child := range e.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// Compact returns the evaluated expression on a single line
+func (e *Evaluation) Compact() string {
+	if len(e.Children) == 0 {
+		return e.Expression
+	}
+
+	children := make([]string, 0, len(e.Children))
+	for _, child := range e.Children {
+		children = append(children, child.Compact())
+	}
+
+	return fmt.Sprintf("%s(%s)", e.Expression, strings.Join(children, ", "))
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"testing"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func condition(key string) *autopilot.LabelSelectorRequirement {
+	return &autopilot.LabelSelectorRequirement{Key: key, Operator: "gt", Values: []string{"80"}}
+}
+
+func TestEvaluateGroups(t *testing.T) {
+	// (usage > 80 OR inodes > 80) AND NOT snapshot_in_progress
+	spec := &autopilot.StoragePolicySpec{
+		Object: autopilot.PolicyObject{Type: autopilot.PolicyObjectTypeVolume},
+		Match: &autopilot.ConditionGroup{
+			AllOf: []autopilot.ConditionGroup{
+				{AnyOf: []autopilot.ConditionGroup{
+					{Condition: condition("usage")},
+					{Condition: condition("inodes")},
+				}},
+				{Not: &autopilot.ConditionGroup{Condition: condition("snapshot_in_progress")}},
+			},
+		},
+	}
+
+	conditions := spec.ConditionList()
+	require.Len(t, conditions, 3)
+	require.Equal(t, "usage", conditions[0].Key)
+	require.Equal(t, "snapshot_in_progress", conditions[2].Key)
+
+	r := NewResultSet(autopilot.PolicyObjectTypeVolume, len(conditions), []Vector{
+		volumeVector("pv-1", 1),
+		volumeVector("pv-2", 0),
+		volumeVector("pv-2", 2),
+		volumeVector("pv-3", 2),
+	})
+
+	require.True(t, r.Evaluate(spec, "pv-1").Met, "Expected inodes without snapshot to match")
+	require.False(t, r.Evaluate(spec, "pv-2").Met, "Expected snapshot in progress to block the match")
+	require.False(t, r.Evaluate(spec, "pv-3").Met, "Expected no usage condition to match")
+
+	require.Equal(t,
+		"allOf(allOf(anyOf(usage gt 80, inodes gt 80), not(snapshot_in_progress gt 80)))",
+		r.Evaluate(spec, "pv-1").Compact())
+}
+
+func TestEvaluateConditionsAndMatch(t *testing.T) {
+	spec := &autopilot.StoragePolicySpec{
+		Conditions: []*autopilot.LabelSelectorRequirement{condition("usage")},
+		Match:      &autopilot.ConditionGroup{Not: &autopilot.ConditionGroup{Condition: condition("latency")}},
+	}
+
+	r := NewResultSet(autopilot.PolicyObjectTypeVolume, 2, []Vector{
+		volumeVector("pv-1", 0),
+		volumeVector("pv-2", 0),
+		volumeVector("pv-2", 1),
+	})
+
+	e := r.Evaluate(spec, "pv-1")
+	require.True(t, e.Met)
+	require.Equal(t, "allOf => met\n  usage gt 80 => met\n  not => met\n    latency gt 80 => not met", e.String())
+	require.False(t, r.Evaluate(spec, "pv-2").Met)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+// DefaultForecastLimit is the value at which a forecast key is considered full
+const DefaultForecastLimit = 100
+
+// Forecast is the projected trend of a series
+type Forecast struct {
+	// Current is the latest value of the series
+	Current float64
+	// Rate is the change of the series per second
+	Rate float64
+	// Limit is the value at which the series is considered full
+	Limit float64
+}
+
+// TimeToLimit returns the time left until the series reaches its limit. It
+// returns +Inf seconds if the series is not growing.
+func (f *Forecast) TimeToLimit() float64 {
+	if f.Current >= f.Limit {
+		return 0
+	}
+
+	if f.Rate <= 0 {
+		return math.Inf(1)
+	}
+
+	return (f.Limit - f.Current) / f.Rate
+}
+
+// ValueAt returns the projected value of the series after the given duration
+func (f *Forecast) ValueAt(d time.Duration) float64 {
+	return f.Current + f.Rate*d.Seconds()
+}
+
+// ForecastLimit returns the limit of the forecast, or the default one if it is not set
+func ForecastLimit(forecast *autopilot.ConditionForecast) float64 {
+	if forecast.Limit > 0 {
+		return forecast.Limit
+	}
+
+	return DefaultForecastLimit
+}
+
+// ForecastRange returns the history window and step of the forecast
+func ForecastRange(forecast *autopilot.ConditionForecast) (time.Duration, time.Duration, error) {
+	return RangeParams(&autopilot.ConditionAggregation{
+		Window: forecast.Window,
+		Step:   forecast.Step,
+	})
+}
+
+// LinearForecast fits a line to the values of a range vector with the least
+// squares method and projects it forward
+func LinearForecast(values [][]interface{}, limit float64) (*Forecast, error) {
+	if len(values) < 2 {
+		return nil, fmt.Errorf("metrics: at least 2 samples are needed for a forecast, got %d", len(values))
+	}
+
+	samples := make([]Sample, 0, len(values))
+	var meanT, meanV float64
+	var last Sample
+	for i, pair := range values {
+		sample, err := ParseSample(pair)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 || sample.Time > last.Time {
+			last = sample
+		}
+
+		samples = append(samples, sample)
+		meanT += sample.Time
+		meanV += sample.Value
+	}
+
+	n := float64(len(samples))
+	meanT /= n
+	meanV /= n
+
+	// the sums are taken on the deviations from the means, squaring unix
+	// timestamps would lose the precision of the slope
+	var sumTT, sumTV float64
+	for _, sample := range samples {
+		dt := sample.Time - meanT
+		sumTT += dt * dt
+		sumTV += dt * (sample.Value - meanV)
+	}
+
+	if sumTT == 0 {
+		return nil, fmt.Errorf("metrics: samples of the forecast have the same timestamp")
+	}
+
+	return &Forecast{
+		Current: last.Value,
+		Rate:    sumTV / sumTT,
+		Limit:   limit,
+	}, nil
+}
+
+// CompareForecast returns true if the time left until the forecast limit
+// satisfies the condition operator against the threshold duration
+func CompareForecast(operator autopilot.LabelSelectorOperator, f *Forecast, threshold string) (bool, error) {
+	d, err := time.ParseDuration(threshold)
+	if err != nil {
+		return false, fmt.Errorf("metrics: invalid forecast condition value %q", threshold)
+	}
+
+	return Compare(operator, f.TimeToLimit(), fmt.Sprint(d.Seconds()))
+}
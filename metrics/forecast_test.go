@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearForecast(t *testing.T) {
+	// usage grows by 10% an hour
+	values := [][]interface{}{
+		{float64(0), "40"},
+		{float64(3600), "50"},
+		{float64(7200), "60"},
+	}
+
+	f, err := LinearForecast(values, 100)
+	require.NoError(t, err, "Failed to forecast")
+	require.Equal(t, float64(60), f.Current)
+	require.InDelta(t, 10.0/3600, f.Rate, 1e-12)
+	require.InDelta(t, 4*3600, f.TimeToLimit(), 1e-6, "Expected volume to be full in 4 hours")
+	require.InDelta(t, 80, f.ValueAt(2*time.Hour), 1e-6)
+
+	met, err := CompareForecast("lt", f, "6h")
+	require.NoError(t, err)
+	require.True(t, met, "Expected volume to be full within 6 hours")
+
+	met, err = CompareForecast("lt", f, "2h")
+	require.NoError(t, err)
+	require.False(t, met, "Expected volume not to be full within 2 hours")
+
+	_, err = LinearForecast(values[:1], 100)
+	require.Error(t, err, "Expected a single sample to fail")
+}
+
+func TestLinearForecastUnixTimestamps(t *testing.T) {
+	// 10m of samples every 10s at realistic timestamps, usage grows by 1% a minute
+	start := float64(1700000000.123)
+	values := make([][]interface{}, 0)
+	for i := 0; i <= 60; i++ {
+		seconds := float64(i * 10)
+		values = append(values, []interface{}{start + seconds, fmt.Sprint(40 + seconds/60)})
+	}
+
+	f, err := LinearForecast(values, 100)
+	require.NoError(t, err, "Failed to forecast")
+	require.InDelta(t, 50, f.Current, 1e-9)
+	require.InEpsilon(t, 1.0/60, f.Rate, 1e-9, "Expected the slope not to lose precision")
+	require.InEpsilon(t, 50*60, f.TimeToLimit(), 1e-6)
+}
+
+func TestForecastNotGrowing(t *testing.T) {
+	f, err := LinearForecast([][]interface{}{
+		{float64(0), "60"},
+		{float64(60), "50"},
+	}, 100)
+	require.NoError(t, err, "Failed to forecast")
+	require.True(t, math.IsInf(f.TimeToLimit(), 1), "Expected a shrinking series to never be full")
+
+	met, err := CompareForecast("lt", f, "24h")
+	require.NoError(t, err)
+	require.False(t, met)
+}
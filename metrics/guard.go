@@ -0,0 +1,253 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTimeout is the default timeout of a single provider query
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetries is the default number of times a failed query is retried
+	DefaultRetries = 2
+	// DefaultRetryBackoff is the default wait before the first retry, it doubles on every retry
+	DefaultRetryBackoff = time.Second
+	// DefaultFailureThreshold is the default number of consecutive failed queries that mark a provider unhealthy
+	DefaultFailureThreshold = 5
+	// DefaultResetTimeout is the default time an unhealthy provider is skipped before it is queried again
+	DefaultResetTimeout = time.Minute
+)
+
+// ErrProviderUnhealthy is returned by a guarded provider that is skipped after too many failed queries
+var ErrProviderUnhealthy = errors.New("metrics: provider is unhealthy")
+
+var providerHealthy = prom.NewGaugeVec(prom.GaugeOpts{
+	Namespace: "autopilot",
+	Name:      "provider_healthy",
+	Help:      "Whether the metrics provider is healthy (1) or skipped by its circuit breaker (0).",
+}, []string{"provider"})
+
+var providerQueryDuration = prom.NewHistogramVec(prom.HistogramOpts{
+	Namespace: "autopilot",
+	Name:      "provider_query_duration_seconds",
+	Help:      "Time taken by a single query attempt on the metrics provider.",
+	Buckets:   prom.ExponentialBuckets(0.01, 2, 12),
+}, []string{"provider"})
+
+var providerQueryErrors = prom.NewCounterVec(prom.CounterOpts{
+	Namespace: "autopilot",
+	Name:      "provider_query_errors_total",
+	Help:      "Number of failed query attempts on the metrics provider.",
+}, []string{"provider"})
+
+func init() {
+	prom.MustRegister(providerHealthy, providerQueryDuration, providerQueryErrors)
+}
+
+// GuardOptions configures the timeouts, retries and circuit breaker of a guarded provider
+type GuardOptions struct {
+	// Timeout is the timeout of a single query attempt
+	Timeout time.Duration
+	// Retries is the number of times a failed query is retried, zero disables the
+	// retries. It is not defaulted, callers set DefaultRetries themselves.
+	Retries int
+	// RetryBackoff is the wait before the first retry, it doubles on every retry
+	RetryBackoff time.Duration
+	// FailureThreshold is the number of consecutive failed queries that mark the provider unhealthy
+	FailureThreshold int
+	// ResetTimeout is how long an unhealthy provider is skipped before it is queried again
+	ResetTimeout time.Duration
+}
+
+// Guarded is a provider guarded by query timeouts, retries and a circuit
+// breaker that skips the provider while it is unhealthy
+type Guarded struct {
+	name     string
+	provider Provider
+	opts     GuardOptions
+
+	mu          sync.Mutex
+	failures    int
+	openUntil   time.Time
+	lastSuccess time.Time
+}
+
+// Guard wraps the provider with the given options. Timeouts, backoff and
+// thresholds that are not set take their default value. Retries are taken as
+// given since zero is a valid number of retries.
+func Guard(name string, provider Provider, opts GuardOptions) *Guarded {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = DefaultFailureThreshold
+	}
+	if opts.ResetTimeout <= 0 {
+		opts.ResetTimeout = DefaultResetTimeout
+	}
+
+	providerHealthy.WithLabelValues(name).Set(1)
+
+	return &Guarded{
+		name:     name,
+		provider: provider,
+		opts:     opts,
+	}
+}
+
+// Healthy returns false while the circuit breaker of the provider is open
+func (g *Guarded) Healthy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.failures < g.opts.FailureThreshold
+}
+
+// LastSuccess returns the time of the last successful query, zero if none
+func (g *Guarded) LastSuccess() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.lastSuccess
+}
+
+// Triggered implements the Trigger interface method for the providers that
+// push metrics, it returns nil for the other providers
+func (g *Guarded) Triggered() <-chan struct{} {
+	if trigger, ok := g.provider.(Trigger); ok {
+		return trigger.Triggered()
+	}
+
+	return nil
+}
+
+// Close releases the resources of the provider, such as its listeners
+func (g *Guarded) Close() error {
+	if closer, ok := g.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Query implements the Provider.Query interface method
+func (g *Guarded) Query(ctx context.Context, policy *StoragePolicy) ([]Vector, error) {
+	if !g.allow() {
+		return nil, ErrProviderUnhealthy
+	}
+
+	backoff := g.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		vecs, err := g.query(ctx, policy)
+		if err == nil {
+			g.succeeded()
+			return vecs, nil
+		}
+
+		if attempt >= g.opts.Retries || ctx.Err() != nil {
+			g.failed(err)
+			return nil, err
+		}
+
+		logrus.Warnf("metrics: query on provider %s failed, retrying in %v: %v", g.name, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			g.failed(ctx.Err())
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (g *Guarded) query(ctx context.Context, policy *StoragePolicy) ([]Vector, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	vecs, err := g.provider.Query(ctx, policy)
+	providerQueryDuration.WithLabelValues(g.name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		providerQueryErrors.WithLabelValues(g.name).Inc()
+	}
+
+	return vecs, err
+}
+
+// allow returns true if the provider can be queried. Once the reset timeout of
+// an unhealthy provider expires a single trial query is let through.
+func (g *Guarded) allow() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.failures < g.opts.FailureThreshold {
+		return true
+	}
+
+	now := time.Now()
+	if now.Before(g.openUntil) {
+		return false
+	}
+
+	// hold off other queries while the trial query runs
+	g.openUntil = now.Add(g.opts.ResetTimeout)
+	return true
+}
+
+func (g *Guarded) succeeded() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.failures >= g.opts.FailureThreshold {
+		logrus.Infof("metrics: provider %s is healthy again", g.name)
+	}
+
+	g.failures = 0
+	g.lastSuccess = time.Now()
+	providerHealthy.WithLabelValues(g.name).Set(1)
+}
+
+func (g *Guarded) failed(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.failures++
+	if g.failures == g.opts.FailureThreshold {
+		logrus.Errorf("metrics: provider %s failed %d queries in a row, skipping it for %v: %v",
+			g.name, g.failures, g.opts.ResetTimeout, err)
+	}
+
+	if g.failures >= g.opts.FailureThreshold {
+		g.openUntil = time.Now().Add(g.opts.ResetTimeout)
+		providerHealthy.WithLabelValues(g.name).Set(0)
+	}
+}
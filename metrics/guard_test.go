@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	calls int
+	fail  bool
+	delay time.Duration
+}
+
+func (f *fakeProvider) Query(ctx context.Context, policy *StoragePolicy) ([]Vector, error) {
+	f.calls++
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if f.fail {
+		return nil, errors.New("query failed")
+	}
+
+	return []Vector{{}}, nil
+}
+
+func TestGuardRetries(t *testing.T) {
+	prov := &fakeProvider{fail: true}
+	g := Guard("retries", prov, GuardOptions{Retries: 2, RetryBackoff: time.Millisecond})
+
+	_, err := g.Query(context.Background(), &StoragePolicy{})
+	require.Error(t, err, "Expected query to fail")
+	require.Equal(t, 3, prov.calls, "Expected the query to be retried twice")
+
+	prov = &fakeProvider{fail: true}
+	g = Guard("no-retries", prov, GuardOptions{RetryBackoff: time.Millisecond})
+	_, err = g.Query(context.Background(), &StoragePolicy{})
+	require.Error(t, err, "Expected query to fail")
+	require.Equal(t, 1, prov.calls, "Expected zero retries to be kept")
+}
+
+func TestGuardLastSuccess(t *testing.T) {
+	prov := &fakeProvider{fail: true}
+	g := Guard("last-success", prov, GuardOptions{RetryBackoff: time.Millisecond})
+	require.True(t, g.LastSuccess().IsZero(), "Expected no successful query yet")
+
+	_, err := g.Query(context.Background(), &StoragePolicy{})
+	require.Error(t, err, "Expected query to fail")
+	require.True(t, g.Healthy(), "Expected a single failure not to open the breaker")
+	require.True(t, g.LastSuccess().IsZero(), "Expected a healthy provider without a successful query")
+
+	prov.fail = false
+	start := time.Now()
+	_, err = g.Query(context.Background(), &StoragePolicy{})
+	require.NoError(t, err, "Failed to query")
+	require.False(t, g.LastSuccess().Before(start), "Expected the successful query to be recorded")
+}
+
+func TestGuardTimeout(t *testing.T) {
+	prov := &fakeProvider{delay: time.Minute}
+	g := Guard("timeout", prov, GuardOptions{Timeout: 10 * time.Millisecond})
+
+	start := time.Now()
+	_, err := g.Query(context.Background(), &StoragePolicy{})
+	require.Error(t, err, "Expected query to time out")
+	require.True(t, time.Since(start) < 10*time.Second, "Expected query to be abandoned")
+}
+
+func TestGuardCircuitBreaker(t *testing.T) {
+	prov := &fakeProvider{fail: true}
+	g := Guard("breaker", prov, GuardOptions{
+		FailureThreshold: 2,
+		ResetTimeout:     50 * time.Millisecond,
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := g.Query(context.Background(), &StoragePolicy{})
+		require.Error(t, err, "Expected query to fail")
+	}
+	require.False(t, g.Healthy(), "Expected provider to be unhealthy")
+
+	calls := prov.calls
+	_, err := g.Query(context.Background(), &StoragePolicy{})
+	require.Equal(t, ErrProviderUnhealthy, err, "Expected unhealthy provider to be skipped")
+	require.Equal(t, calls, prov.calls, "Expected no query on an unhealthy provider")
+
+	time.Sleep(60 * time.Millisecond)
+	prov.fail = false
+	_, err = g.Query(context.Background(), &StoragePolicy{})
+	require.NoError(t, err, "Expected trial query to succeed")
+	require.True(t, g.Healthy(), "Expected provider to be healthy again")
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+const (
+	// ParamBearerToken is the bearer token sent with every request
+	ParamBearerToken = "bearer_token"
+	// ParamBearerTokenFile is a file holding the bearer token, it is read on every request
+	ParamBearerTokenFile = "bearer_token_file"
+	// ParamUsername is the basic auth user name
+	ParamUsername = "username"
+	// ParamPassword is the basic auth password
+	ParamPassword = "password"
+	// ParamPasswordFile is a file holding the basic auth password
+	ParamPasswordFile = "password_file"
+	// ParamCertFile is the client certificate for mutual TLS
+	ParamCertFile = "cert_file"
+	// ParamKeyFile is the client key for mutual TLS
+	ParamKeyFile = "key_file"
+	// ParamCAFile is the CA bundle used to verify the server certificate
+	ParamCAFile = "ca_file"
+	// ParamInsecureSkipVerify disables the verification of the server certificate
+	ParamInsecureSkipVerify = "insecure_skip_verify"
+	// ParamHeaderPrefix prefixes the params that are sent as request headers,
+	// such as header.X-Scope-OrgID=tenant
+	ParamHeaderPrefix = "header."
+)
+
+// Client is an http client that authenticates the requests of a metrics
+// provider based on the provider params
+type Client struct {
+	client    *http.Client
+	headers   http.Header
+	token     string
+	tokenFile string
+	username  string
+	password  string
+}
+
+// New returns a new client configured from the provider params
+func New(params sparks.Params) (*Client, error) {
+	c := &Client{
+		headers:   make(http.Header),
+		token:     params.String(ParamBearerToken),
+		tokenFile: params.String(ParamBearerTokenFile),
+		username:  params.String(ParamUsername),
+		password:  params.String(ParamPassword),
+	}
+
+	if len(c.token) > 0 && len(c.tokenFile) > 0 {
+		return nil, fmt.Errorf("only one of %s and %s can be set", ParamBearerToken, ParamBearerTokenFile)
+	}
+
+	if len(c.username) > 0 && (len(c.token) > 0 || len(c.tokenFile) > 0) {
+		return nil, errors.New("basic auth and bearer token auth can't be used together")
+	}
+
+	if file := params.String(ParamPasswordFile); len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c.password = strings.TrimSpace(string(data))
+	}
+
+	for key, value := range params {
+		if strings.HasPrefix(key, ParamHeaderPrefix) {
+			c.headers.Set(strings.TrimPrefix(key, ParamHeaderPrefix), sparks.NewValue(value).String())
+		}
+	}
+
+	tlsConfig, err := NewTLSConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return c, nil
+}
+
+// Do sends the request with the configured authentication and headers
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	for key, values := range c.headers {
+		req.Header[key] = values
+	}
+
+	switch {
+	case len(c.token) > 0:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case len(c.tokenFile) > 0:
+		data, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(data)))
+	case len(c.username) > 0:
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	return c.client.Do(req)
+}
+
+// NewTLSConfig returns the TLS configuration of the ca_file, cert_file,
+// key_file and insecure_skip_verify params
+func NewTLSConfig(params sparks.Params) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: params.Bool(ParamInsecureSkipVerify),
+	}
+
+	if caFile := params.String(ParamCAFile); len(caFile) > 0 {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	certFile := params.String(ParamCertFile)
+	keyFile := params.String(ParamKeyFile)
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return nil, fmt.Errorf("both %s and %s are needed for client certificates", ParamCertFile, ParamKeyFile)
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
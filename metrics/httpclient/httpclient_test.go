@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, chan *http.Request) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	return server, requests
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600), "Failed to write %s", name)
+	return path
+}
+
+func TestBearerTokenFileAndHeaders(t *testing.T) {
+	server, requests := newTestServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "httpclient")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	params := sparks.Params{
+		ParamCAFile:            writeFile(t, dir, "ca.crt", ca),
+		ParamBearerTokenFile:   writeFile(t, dir, "token", []byte("s3cr3t\n")),
+		"header.X-Scope-OrgID": "tenant1",
+	}
+
+	client, err := New(params)
+	require.NoError(t, err, "Failed to create client")
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err, "Failed to create request")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err, "Failed to send request")
+	resp.Body.Close()
+
+	r := <-requests
+	require.Equal(t, "Bearer s3cr3t", r.Header.Get("Authorization"), "Unexpected authorization header")
+	require.Equal(t, "tenant1", r.Header.Get("X-Scope-OrgID"), "Unexpected tenant header")
+}
+
+func TestBasicAuthInsecure(t *testing.T) {
+	server, requests := newTestServer(t)
+	defer server.Close()
+
+	client, err := New(sparks.ParseStringParams("username=admin password=\"pass word\" insecure_skip_verify=true"))
+	require.NoError(t, err, "Failed to create client")
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err, "Failed to create request")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err, "Failed to send request")
+	resp.Body.Close()
+
+	r := <-requests
+	user, pass, ok := r.BasicAuth()
+	require.True(t, ok, "Expected basic auth")
+	require.Equal(t, "admin", user, "Unexpected user name")
+	require.Equal(t, "pass word", pass, "Unexpected password")
+}
+
+func TestUnverifiedServer(t *testing.T) {
+	server, _ := newTestServer(t)
+	defer server.Close()
+
+	client, err := New(sparks.Params{})
+	require.NoError(t, err, "Failed to create client")
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err, "Failed to create request")
+
+	_, err = client.Do(req)
+	require.Error(t, err, "Expected an error for an unknown certificate authority")
+}
+
+func TestInvalidParams(t *testing.T) {
+	_, err := New(sparks.ParseStringParams("bearer_token=a bearer_token_file=/tmp/b"))
+	require.Error(t, err, "Expected an error for two bearer tokens")
+
+	_, err = New(sparks.ParseStringParams("username=a bearer_token=b"))
+	require.Error(t, err, "Expected an error for mixed auth")
+
+	_, err = New(sparks.ParseStringParams("cert_file=/tmp/cert"))
+	require.Error(t, err, "Expected an error for a certificate without a key")
+}
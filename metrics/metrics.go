@@ -47,13 +47,27 @@ func Register(name string, provider NewFunc) {
 	providers[name] = provider
 }
 
+// Registered returns true if a metrics provider is available by the provided name
+func Registered(name string) bool {
+	provMu.RLock()
+	defer provMu.RUnlock()
+
+	_, ok := providers[name]
+	return ok
+}
+
 // NewProvider creates a new metrics provider
 func NewProvider(name, params string) (Provider, error) {
+	return NewProviderWithParams(name, sparks.ParseStringParams(params))
+}
+
+// NewProviderWithParams creates a new metrics provider with parsed params
+func NewProviderWithParams(name string, params Params) (Provider, error) {
 	provMu.RLock()
 	newFn, ok := providers[name]
 	provMu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("metrics: unknown provider %q (forgotten import?)", name)
 	}
-	return newFn(sparks.ParseStringParams(params))
+	return newFn(params)
 }
@@ -0,0 +1,378 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alertmanager
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ParamListen is the address the webhook receiver listens on. Defaults to :9099.
+	ParamListen = "listen"
+	// ParamPath is the path of the webhook receiver. Defaults to /alerts.
+	ParamPath = "path"
+
+	// The webhook requests are authenticated with the bearer_token,
+	// bearer_token_file, username, password and password_file params of the
+	// httpclient package, one of them is required.
+
+	defaultListen = ":9099"
+	defaultPath   = "/alerts"
+
+	alertStatusFiring   = "firing"
+	alertStatusResolved = "resolved"
+
+	labelAlertName  = "alertname"
+	labelAlertState = "alertstate"
+)
+
+type (
+	// webhook is the payload alertmanager posts to webhook receivers
+	webhook struct {
+		Version string  `json:"version"`
+		Status  string  `json:"status"`
+		Alerts  []alert `json:"alerts"`
+	}
+
+	alert struct {
+		Status      string            `json:"status"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+		StartsAt    time.Time         `json:"startsAt"`
+		EndsAt      time.Time         `json:"endsAt"`
+		Fingerprint string            `json:"fingerprint"`
+	}
+
+	// auth are the credentials the webhook requests must carry, a bearer token
+	// or a basic auth user name and password
+	auth struct {
+		token     string
+		tokenFile string
+		username  string
+		password  string
+	}
+
+	alertmanager struct {
+		auth     *auth
+		server   *http.Server
+		listener net.Listener
+		trigger  chan struct{}
+
+		mu     sync.Mutex
+		alerts map[string]alert
+	}
+)
+
+// New returns a new alertmanager provider and starts its webhook receiver
+func New(params metrics.Params) (metrics.Provider, error) {
+	creds, err := newAuth(params)
+	if err != nil {
+		return nil, fmt.Errorf("alertmanager: %v", err)
+	}
+
+	a := &alertmanager{
+		auth:    creds,
+		trigger: make(chan struct{}, 1),
+		alerts:  make(map[string]alert),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(params.String(ParamPath, defaultPath), a.receive)
+
+	listener, err := net.Listen("tcp", params.String(ParamListen, defaultListen))
+	if err != nil {
+		return nil, fmt.Errorf("alertmanager: %v", err)
+	}
+
+	a.listener = listener
+	a.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := a.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("alertmanager: webhook receiver stopped: %v", err)
+		}
+	}()
+
+	logrus.Infof("alertmanager: receiving alerts on %s%s", listener.Addr(), params.String(ParamPath, defaultPath))
+
+	return a, nil
+}
+
+// newAuth returns the credentials of the webhook receiver from the params of
+// the httpclient package. The receiver can trigger actions, so the credentials
+// are required.
+func newAuth(params metrics.Params) (*auth, error) {
+	a := &auth{
+		token:     params.String(httpclient.ParamBearerToken),
+		tokenFile: params.String(httpclient.ParamBearerTokenFile),
+		username:  params.String(httpclient.ParamUsername),
+		password:  params.String(httpclient.ParamPassword),
+	}
+
+	if len(a.token) > 0 && len(a.tokenFile) > 0 {
+		return nil, fmt.Errorf("only one of %s and %s can be set",
+			httpclient.ParamBearerToken, httpclient.ParamBearerTokenFile)
+	}
+
+	if file := params.String(httpclient.ParamPasswordFile); len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		a.password = strings.TrimSpace(string(data))
+	}
+
+	bearer := len(a.token) > 0 || len(a.tokenFile) > 0
+	basic := len(a.username) > 0
+	switch {
+	case bearer && basic:
+		return nil, errors.New("basic auth and bearer token auth can't be used together")
+	case basic && len(a.password) == 0:
+		return nil, fmt.Errorf("%s needs %s or %s", httpclient.ParamUsername,
+			httpclient.ParamPassword, httpclient.ParamPasswordFile)
+	case !bearer && !basic:
+		return nil, fmt.Errorf("the webhook receiver needs %s, %s or %s and %s",
+			httpclient.ParamBearerToken, httpclient.ParamBearerTokenFile,
+			httpclient.ParamUsername, httpclient.ParamPassword)
+	}
+
+	if len(a.tokenFile) > 0 {
+		// fail early on a missing file, it is read again on every request to pick up rotations
+		if _, err := a.bearerToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func (a *auth) bearerToken() (string, error) {
+	if len(a.tokenFile) == 0 {
+		return a.token, nil
+	}
+
+	data, err := ioutil.ReadFile(a.tokenFile)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// authorized returns true if the request carries the credentials of the receiver
+func (a *auth) authorized(r *http.Request) bool {
+	if len(a.username) > 0 {
+		username, password, ok := r.BasicAuth()
+		return ok && equal(username, a.username) && equal(password, a.password)
+	}
+
+	token, err := a.bearerToken()
+	if err != nil {
+		logrus.Errorf("alertmanager: failed to read the bearer token: %v", err)
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	return len(token) > 0 && strings.HasPrefix(header, "Bearer ") &&
+		equal(strings.TrimPrefix(header, "Bearer "), token)
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Triggered implements the metrics.Trigger interface method, it fires when new alerts are received
+func (a *alertmanager) Triggered() <-chan struct{} {
+	return a.trigger
+}
+
+// Close stops the webhook receiver
+func (a *alertmanager) Close() error {
+	return a.server.Close()
+}
+
+func (a *alertmanager) receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.auth.authorized(r) {
+		logrus.Warnf("alertmanager: rejected unauthorized webhook request from %s", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Basic realm="autopilot"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook := &webhook{}
+	if err := json.NewDecoder(r.Body).Decode(hook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if a.update(hook.Alerts, time.Now()) {
+		select {
+		case a.trigger <- struct{}{}:
+		default:
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// update records the firing alerts and drops the resolved ones. It returns
+// true if a new alert started firing.
+func (a *alertmanager) update(alerts []alert, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fired := false
+	for _, al := range alerts {
+		key := alertKey(al)
+		if al.Status == alertStatusResolved || (!al.EndsAt.IsZero() && al.EndsAt.Before(now)) {
+			delete(a.alerts, key)
+			continue
+		}
+
+		if _, ok := a.alerts[key]; !ok {
+			logrus.Infof("alertmanager: alert %s firing %v", al.Labels[labelAlertName], al.Labels)
+			fired = true
+		}
+		a.alerts[key] = al
+	}
+
+	return fired
+}
+
+// firing returns the alerts that are still firing at the given time
+func (a *alertmanager) firing(now time.Time) []alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := make([]alert, 0, len(a.alerts))
+	for key, al := range a.alerts {
+		if !al.EndsAt.IsZero() && al.EndsAt.Before(now) {
+			delete(a.alerts, key)
+			continue
+		}
+		alerts = append(alerts, al)
+	}
+
+	return alerts
+}
+
+// Query implements the metrics.Provider.Query interface method. Conditions
+// select alerts the way the prometheus ALERTS series does, such as
+// ALERTS{alertname="VolumeAlmostFull",severity="critical"} eq 1.
+func (a *alertmanager) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+	now := time.Now()
+	alerts := a.firing(now)
+	rval := make([]metrics.Vector, 0)
+
+	for i, c := range policy.Spec.ConditionList() {
+		selector, err := ParseSelector(c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("alertmanager: condition %s: %v", c.Key, err)
+		}
+
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("alertmanager: condition %s has no value", c.Key)
+		}
+
+		// a firing alert has the value 1 like the prometheus ALERTS series
+		met, err := metrics.Compare(c.Operator, 1, c.Values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if !met {
+			continue
+		}
+
+		for _, al := range alerts {
+			labels := withState(al.Labels)
+			if !selector.Matches(labels) {
+				continue
+			}
+
+			metric, err := metrics.LabelsToMetric(labels)
+			if err != nil {
+				return nil, err
+			}
+			metric.Name = alertsSeries
+
+			rval = append(rval, metrics.Vector{
+				Metric:    metric,
+				Value:     []interface{}{float64(now.Unix()), strconv.Itoa(1)},
+				Condition: i,
+			})
+		}
+	}
+
+	return rval, nil
+}
+
+// withState returns the labels of the alert with the alertstate label of the
+// prometheus ALERTS series
+func withState(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[labelAlertState] = alertStatusFiring
+
+	return out
+}
+
+func alertKey(al alert) string {
+	if len(al.Fingerprint) > 0 {
+		return al.Fingerprint
+	}
+
+	names := make([]string, 0, len(al.Labels))
+	for name := range al.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+al.Labels[name])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func init() {
+	metrics.Register("alertmanager", New)
+}
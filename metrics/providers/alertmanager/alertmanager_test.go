@@ -0,0 +1,135 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+const payload = `{
+  "version": "4",
+  "status": "firing",
+  "alerts": [
+    {"status": "firing", "fingerprint": "a1",
+     "labels": {"alertname": "VolumeAlmostFull", "severity": "critical", "volumename": "pvc-1", "namespace": "db"}},
+    {"status": "firing", "fingerprint": "a2",
+     "labels": {"alertname": "VolumeAlmostFull", "severity": "warning", "volumename": "pvc-2"}},
+    {"status": "firing", "fingerprint": "a3",
+     "labels": {"alertname": "NodeDown", "severity": "critical", "node": "node-1"}}
+  ]
+}`
+
+func TestParseSelector(t *testing.T) {
+	s, err := ParseSelector(`ALERTS{alertname="VolumeAlmostFull", severity=~"crit.*", volumename!="pvc-9"}`)
+	require.NoError(t, err, "Failed to parse selector")
+	require.Len(t, s, 3)
+
+	require.True(t, s.Matches(map[string]string{"alertname": "VolumeAlmostFull", "severity": "critical"}))
+	require.False(t, s.Matches(map[string]string{"alertname": "VolumeAlmostFull", "severity": "warning"}))
+	require.False(t, s.Matches(map[string]string{
+		"alertname": "VolumeAlmostFull", "severity": "critical", "volumename": "pvc-9"}))
+
+	s, err = ParseSelector("NodeDown")
+	require.NoError(t, err)
+	require.True(t, s.Matches(map[string]string{"alertname": "NodeDown"}))
+
+	for _, invalid := range []string{"", `up{job="x"}`, `ALERTS{alertname="x"`, `ALERTS{alertname}`, `ALERTS{a="x" b="y"}`} {
+		_, err := ParseSelector(invalid)
+		require.Error(t, err, "Expected selector %q to fail", invalid)
+	}
+}
+
+func TestReceiveAndQuery(t *testing.T) {
+	a := &alertmanager{
+		auth:    &auth{token: "s3cr3t"},
+		trigger: make(chan struct{}, 1),
+		alerts:  make(map[string]alert),
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBufferString(payload))
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	a.receive(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case <-a.Triggered():
+	default:
+		t.Fatal("Expected new alerts to trigger an evaluation")
+	}
+
+	policy := &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: `ALERTS{alertname="VolumeAlmostFull",severity="critical"}`, Operator: "eq", Values: []string{"1"}},
+			},
+		},
+	}
+
+	vecs, err := a.Query(context.Background(), policy)
+	require.NoError(t, err, "Failed to query alerts")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	require.Equal(t, "db", *vecs[0].Metric.Namespace)
+	require.Equal(t, "VolumeAlmostFull", *vecs[0].Metric.AlertName)
+	require.Equal(t, "critical", *vecs[0].Metric.AlertSeverity)
+	require.Equal(t, "firing", *vecs[0].Metric.AlertState)
+
+	a.update([]alert{{Status: "resolved", Fingerprint: "a1"}}, time.Now())
+	vecs, err = a.Query(context.Background(), policy)
+	require.NoError(t, err)
+	require.Empty(t, vecs, "Expected resolved alert to be dropped")
+}
+
+func TestReceiveUnauthorized(t *testing.T) {
+	a := &alertmanager{
+		auth:    &auth{username: "alertmanager", password: "s3cr3t"},
+		trigger: make(chan struct{}, 1),
+		alerts:  make(map[string]alert),
+	}
+
+	for _, creds := range [][]string{nil, {"alertmanager", "wrong"}, {"other", "s3cr3t"}} {
+		req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBufferString(payload))
+		if creds != nil {
+			req.SetBasicAuth(creds[0], creds[1])
+		}
+
+		w := httptest.NewRecorder()
+		a.receive(w, req)
+		require.Equal(t, http.StatusUnauthorized, w.Code, "credentials %v", creds)
+	}
+	require.Empty(t, a.firing(time.Now()), "Expected unauthorized alerts to be dropped")
+
+	req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewBufferString(payload))
+	req.SetBasicAuth("alertmanager", "s3cr3t")
+	w := httptest.NewRecorder()
+	a.receive(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, a.firing(time.Now()), 3)
+}
+
+func TestNewAuth(t *testing.T) {
+	_, err := newAuth(metrics.Params{})
+	require.Error(t, err, "Expected the receiver to require credentials")
+
+	_, err = newAuth(metrics.Params{"username": "alertmanager"})
+	require.Error(t, err, "Expected basic auth to require a password")
+
+	_, err = newAuth(metrics.Params{"bearer_token": "a", "username": "b", "password": "c"})
+	require.Error(t, err)
+
+	creds, err := newAuth(metrics.Params{"bearer_token": "s3cr3t"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/alerts", nil)
+	require.False(t, creds.authorized(req))
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	require.True(t, creds.authorized(req))
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alertmanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const alertsSeries = "ALERTS"
+
+type matchType string
+
+const (
+	matchEqual     matchType = "="
+	matchNotEqual  matchType = "!="
+	matchRegexp    matchType = "=~"
+	matchNotRegexp matchType = "!~"
+)
+
+// matcher matches the value of a single label
+type matcher struct {
+	name  string
+	typ   matchType
+	value string
+	re    *regexp.Regexp
+}
+
+// Selector selects alerts by their labels
+type Selector []matcher
+
+// ParseSelector parses an ALERTS series selector such as
+// ALERTS{alertname="VolumeAlmostFull",severity=~"critical|warning"}. A bare
+// name such as VolumeAlmostFull selects the alerts with that alert name.
+func ParseSelector(s string) (Selector, error) {
+	s = strings.TrimSpace(s)
+
+	open := strings.Index(s, "{")
+	if open < 0 {
+		if len(s) == 0 {
+			return nil, errors.New("empty alert selector")
+		}
+
+		if s == alertsSeries {
+			return Selector{}, nil
+		}
+
+		return Selector{{name: labelAlertName, typ: matchEqual, value: s}}, nil
+	}
+
+	if name := strings.TrimSpace(s[:open]); len(name) > 0 && name != alertsSeries {
+		return nil, fmt.Errorf("alert selector must select the %s series, got %s", alertsSeries, name)
+	}
+
+	if !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("alert selector %s is missing a closing brace", s)
+	}
+
+	selector := Selector{}
+	body := s[open+1 : len(s)-1]
+	for len(strings.TrimSpace(body)) > 0 {
+		m, rest, err := parseMatcher(body)
+		if err != nil {
+			return nil, err
+		}
+
+		selector = append(selector, m)
+		body = strings.TrimSpace(rest)
+		if strings.HasPrefix(body, ",") {
+			body = body[1:]
+		} else if len(body) > 0 {
+			return nil, fmt.Errorf("unexpected %q in alert selector", body)
+		}
+	}
+
+	return selector, nil
+}
+
+// parseMatcher parses the first matcher of the selector body and returns the rest of the body
+func parseMatcher(body string) (matcher, string, error) {
+	body = strings.TrimSpace(body)
+
+	end := strings.IndexAny(body, "=!")
+	if end <= 0 {
+		return matcher{}, "", fmt.Errorf("invalid label matcher %q", body)
+	}
+
+	m := matcher{name: strings.TrimSpace(body[:end])}
+	body = body[end:]
+
+	for _, typ := range []matchType{matchRegexp, matchNotRegexp, matchNotEqual, matchEqual} {
+		if strings.HasPrefix(body, string(typ)) {
+			m.typ = typ
+			body = strings.TrimSpace(body[len(typ):])
+			break
+		}
+	}
+
+	if len(m.typ) == 0 || !strings.HasPrefix(body, `"`) {
+		return matcher{}, "", fmt.Errorf("invalid label matcher for %s", m.name)
+	}
+
+	// find the closing quote, skipping escaped ones
+	closing := -1
+	for i := 1; i < len(body); i++ {
+		if body[i] == '\\' {
+			i++
+			continue
+		}
+		if body[i] == '"' {
+			closing = i
+			break
+		}
+	}
+
+	if closing < 0 {
+		return matcher{}, "", fmt.Errorf("unterminated value for label %s", m.name)
+	}
+
+	value, err := strconv.Unquote(body[:closing+1])
+	if err != nil {
+		return matcher{}, "", fmt.Errorf("invalid value for label %s: %v", m.name, err)
+	}
+	m.value = value
+
+	if m.typ == matchRegexp || m.typ == matchNotRegexp {
+		if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return matcher{}, "", fmt.Errorf("invalid regexp for label %s: %v", m.name, err)
+		}
+	}
+
+	return m, body[closing+1:], nil
+}
+
+// Matches returns true if the labels satisfy every matcher of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, m := range s {
+		value := labels[m.name]
+
+		var ok bool
+		switch m.typ {
+		case matchEqual:
+			ok = value == m.value
+		case matchNotEqual:
+			ok = value != m.value
+		case matchRegexp:
+			ok = m.re.MatchString(value)
+		case matchNotRegexp:
+			ok = !m.re.MatchString(value)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
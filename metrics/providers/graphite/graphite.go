@@ -0,0 +1,284 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ParamURL is the url of the graphite web api
+	ParamURL = "url"
+	// ParamFrom is the start of the render window of the conditions without an aggregation. Defaults to -5min.
+	ParamFrom = "from"
+	// ParamTemplate is the path template used to map the names of the series returned by
+	// targets that are not templates themselves, such as storage.{node}.{volumename}.latency
+	ParamTemplate = "template"
+
+	defaultFrom = "-5min"
+)
+
+// placeholderRegex matches the label placeholders of a path template. Graphite
+// alternations such as {a,b} are not placeholders.
+var placeholderRegex = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+type (
+	// renderSeries is a series of the render api json format
+	renderSeries struct {
+		Target     string            `json:"target"`
+		Tags       map[string]string `json:"tags"`
+		Datapoints [][]*float64      `json:"datapoints"`
+	}
+
+	graphite struct {
+		url      string
+		from     string
+		template *Template
+		client   *httpclient.Client
+	}
+)
+
+// Template maps the nodes of a graphite path on metric labels
+type Template struct {
+	nodes []string
+}
+
+// ParseTemplate parses a path template such as storage.{node}.{volumename}.latency
+func ParseTemplate(s string) *Template {
+	return &Template{nodes: strings.Split(s, ".")}
+}
+
+// IsTemplate returns true if the target has label placeholders
+func IsTemplate(target string) bool {
+	return placeholderRegex.MatchString(target)
+}
+
+// Target returns the render target of the template, every placeholder matches any node
+func (t *Template) Target() string {
+	return placeholderRegex.ReplaceAllString(strings.Join(t.nodes, "."), "*")
+}
+
+// Labels returns the labels of the series name, and false if the name does not fit the template
+func (t *Template) Labels(name string) (map[string]string, bool) {
+	nodes := strings.Split(name, ".")
+	if len(nodes) != len(t.nodes) {
+		return nil, false
+	}
+
+	labels := make(map[string]string)
+	for i, node := range t.nodes {
+		if m := placeholderRegex.FindStringSubmatch(node); m != nil && m[0] == node {
+			labels[m[1]] = nodes[i]
+		}
+	}
+
+	return labels, true
+}
+
+// New returns a new graphite provider instance
+func New(params metrics.Params) (metrics.Provider, error) {
+	client, err := httpclient.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("graphite: %v", err)
+	}
+
+	g := &graphite{
+		url:    params.String(ParamURL),
+		from:   params.String(ParamFrom, defaultFrom),
+		client: client,
+	}
+
+	if len(g.url) == 0 {
+		return nil, fmt.Errorf("graphite: missing %s param", ParamURL)
+	}
+
+	if template := params.String(ParamTemplate); len(template) > 0 {
+		g.template = ParseTemplate(template)
+	}
+
+	return g, nil
+}
+
+// Query implements the metrics.Provider.Query interface method. The condition
+// keys are render targets or path templates, the last value of every series
+// is compared with the condition, or the reduced value of the series for
+// conditions with an aggregation.
+func (g *graphite) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+	rval := make([]metrics.Vector, 0)
+
+	for i, c := range policy.Spec.ConditionList() {
+		if c.Forecast != nil {
+			return nil, fmt.Errorf("graphite: condition %s: forecasts are not supported", c.Key)
+		}
+
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("graphite: condition %s has no value", c.Key)
+		}
+
+		target, template := c.Key, g.template
+		if IsTemplate(c.Key) {
+			template = ParseTemplate(c.Key)
+			target = template.Target()
+		}
+
+		from := g.from
+		agg := &autopilot.ConditionAggregation{Function: autopilot.AggregationLast}
+		if c.Aggregation != nil {
+			agg = c.Aggregation
+			window, _, err := metrics.RangeParams(agg)
+			if err != nil {
+				return nil, err
+			}
+			from = fmt.Sprintf("-%ds", int64(window.Seconds()))
+		}
+
+		all, err := g.render(ctx, target, from)
+		if err != nil {
+			log.StoragePolicyLog(policy).Errorf("graphite: error executing condition %s: %v", c.Key, err)
+			return nil, err
+		}
+
+		for _, s := range all {
+			values := datapoints(s.Datapoints)
+			if len(values) == 0 {
+				continue
+			}
+
+			value, err := metrics.Reduce(agg, values)
+			if err != nil {
+				return nil, err
+			}
+
+			met, err := metrics.Compare(c.Operator, value, c.Values[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if !met {
+				continue
+			}
+
+			labels := make(map[string]string)
+			for k, v := range s.Tags {
+				labels[k] = v
+			}
+
+			if template != nil {
+				templateLabels, ok := template.Labels(s.Target)
+				if !ok {
+					logrus.Debugf("graphite: series %s does not fit the path template", s.Target)
+				}
+				for k, v := range templateLabels {
+					labels[k] = v
+				}
+			}
+
+			metric, err := metrics.LabelsToMetric(labels)
+			if err != nil {
+				return nil, err
+			}
+			metric.Name = s.Target
+
+			rval = append(rval, metrics.Vector{
+				Metric:    metric,
+				Value:     []interface{}{float64(time.Now().Unix()), strconv.FormatFloat(value, 'f', -1, 64)},
+				Values:    values,
+				Condition: i,
+			})
+		}
+	}
+
+	return rval, nil
+}
+
+// datapoints converts the [value, timestamp] datapoints of the render api to
+// [timestamp, value] samples, dropping the empty ones
+func datapoints(points [][]*float64) [][]interface{} {
+	values := make([][]interface{}, 0, len(points))
+	for _, point := range points {
+		if len(point) != 2 || point[0] == nil || point[1] == nil {
+			continue
+		}
+		values = append(values, []interface{}{*point[1], *point[0]})
+	}
+
+	return values
+}
+
+func (g *graphite) render(ctx context.Context, target, from string) ([]renderSeries, error) {
+	base, err := url.Parse(g.url)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = path.Join(base.Path, "/render")
+
+	q := base.Query()
+	q.Set("target", target)
+	q.Set("from", from)
+	q.Set("format", "json")
+	base.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	logrus.Infof("graphite: executing query %s", req.URL.String())
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get data: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	all := make([]renderSeries, 0)
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
+
+func init() {
+	metrics.Register("graphite", New)
+}
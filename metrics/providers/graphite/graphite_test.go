@@ -0,0 +1,69 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+const renderData = `[
+  {"target": "storage.node1.pvc-1.latency", "tags": {}, "datapoints": [[40, 1550000000], [60, 1550000060], [null, 1550000120]]},
+  {"target": "storage.node2.pvc-2.latency", "tags": {}, "datapoints": [[10, 1550000000], [20, 1550000060]]}
+]`
+
+func TestTemplate(t *testing.T) {
+	tmpl := ParseTemplate("storage.{node}.{volumename}.latency")
+	require.True(t, IsTemplate("storage.{node}.{volumename}.latency"))
+	require.False(t, IsTemplate("storage.{node1,node2}.*.latency"), "Expected alternations not to be placeholders")
+	require.Equal(t, "storage.*.*.latency", tmpl.Target())
+
+	labels, ok := tmpl.Labels("storage.node1.pvc-1.latency")
+	require.True(t, ok)
+	require.Equal(t, map[string]string{"node": "node1", "volumename": "pvc-1"}, labels)
+
+	_, ok = tmpl.Labels("storage.node1.latency")
+	require.False(t, ok)
+}
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/render", r.URL.Path)
+		require.Equal(t, "storage.*.*.latency", r.URL.Query().Get("target"))
+		require.Equal(t, "json", r.URL.Query().Get("format"))
+		fmt.Fprint(w, renderData)
+	}))
+	defer server.Close()
+
+	prov, err := New(sparks.ParseStringParams("url=" + server.URL))
+	require.NoError(t, err, "Failed to create provider")
+
+	policy := &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: "storage.{node}.{volumename}.latency", Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	}
+
+	vecs, err := prov.Query(context.Background(), policy)
+	require.NoError(t, err, "Failed to query")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	require.Equal(t, "node1", vecs[0].Metric.NodeName)
+	require.Len(t, vecs[0].Values, 2, "Expected null datapoints to be dropped")
+
+	policy.Spec.Conditions[0].Aggregation = &autopilot.ConditionAggregation{
+		Function: autopilot.AggregationAvg,
+		Window:   "10m",
+	}
+	vecs, err = prov.Query(context.Background(), policy)
+	require.NoError(t, err, "Failed to query")
+	require.Empty(t, vecs, "Expected the average of pvc-1 not to match")
+}
@@ -0,0 +1,450 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	"github.com/sirupsen/logrus"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+const (
+	// ParamURL is the url of the influxdb http api
+	ParamURL = "url"
+	// ParamLanguage is the query language of the condition keys: influxql or flux. Defaults to influxql.
+	ParamLanguage = "language"
+	// ParamDatabase is the database of the influxql queries
+	ParamDatabase = "db"
+	// ParamRetentionPolicy is the retention policy of the influxql queries
+	ParamRetentionPolicy = "rp"
+	// ParamOrg is the organization of the flux queries
+	ParamOrg = "org"
+	// ParamTagPrefix prefixes the params that map an influxdb tag on a metric
+	// label, such as tag.volumename=pv_name. Tags named after the metric labels
+	// are mapped without params.
+	ParamTagPrefix = "tag."
+
+	languageInfluxQL = "influxql"
+	languageFlux     = "flux"
+)
+
+type (
+	// influxQLResponse is the response of the influxql /query endpoint
+	influxQLResponse struct {
+		Results []struct {
+			Series []struct {
+				Name    string            `json:"name"`
+				Tags    map[string]string `json:"tags"`
+				Columns []string          `json:"columns"`
+				Values  [][]interface{}   `json:"values"`
+			} `json:"series"`
+			Error string `json:"error"`
+		} `json:"results"`
+		Error string `json:"error"`
+	}
+
+	// series is a series of [timestamp, value] samples and its tags
+	series struct {
+		tags   map[string]string
+		values [][]interface{}
+	}
+
+	influxdb struct {
+		url      string
+		language string
+		db       string
+		rp       string
+		org      string
+		tags     map[string]string
+		client   *httpclient.Client
+	}
+)
+
+// fluxColumns are the columns of the flux tables that are not tags
+var fluxColumns = map[string]bool{
+	"":             true,
+	"result":       true,
+	"table":        true,
+	"_start":       true,
+	"_stop":        true,
+	"_time":        true,
+	"_value":       true,
+	"_field":       true,
+	"_measurement": true,
+}
+
+// New returns a new influxdb provider instance
+func New(params metrics.Params) (metrics.Provider, error) {
+	client, err := httpclient.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("influxdb: %v", err)
+	}
+
+	i := &influxdb{
+		url:      params.String(ParamURL),
+		language: params.String(ParamLanguage, languageInfluxQL),
+		db:       params.String(ParamDatabase),
+		rp:       params.String(ParamRetentionPolicy),
+		org:      params.String(ParamOrg),
+		tags:     make(map[string]string),
+		client:   client,
+	}
+
+	if len(i.url) == 0 {
+		return nil, fmt.Errorf("influxdb: missing %s param", ParamURL)
+	}
+
+	if i.language != languageInfluxQL && i.language != languageFlux {
+		return nil, fmt.Errorf("influxdb: invalid %s param %q", ParamLanguage, i.language)
+	}
+
+	for key, value := range params {
+		if strings.HasPrefix(key, ParamTagPrefix) {
+			i.tags[sparks.NewValue(value).String()] = strings.TrimPrefix(key, ParamTagPrefix)
+		}
+	}
+
+	return i, nil
+}
+
+// Query implements the metrics.Provider.Query interface method. The condition
+// keys are influxql or flux queries, the last value of every series they
+// return is compared with the condition, or the reduced value of the series
+// for conditions with an aggregation.
+func (i *influxdb) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+	rval := make([]metrics.Vector, 0)
+
+	for index, c := range policy.Spec.ConditionList() {
+		if c.Forecast != nil {
+			return nil, fmt.Errorf("influxdb: condition %s: forecasts are not supported", c.Key)
+		}
+
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("influxdb: condition %s has no value", c.Key)
+		}
+
+		var all []series
+		var err error
+		if i.language == languageFlux {
+			all, err = i.queryFlux(ctx, c.Key)
+		} else {
+			all, err = i.queryInfluxQL(ctx, c.Key)
+		}
+		if err != nil {
+			log.StoragePolicyLog(policy).Errorf("influxdb: error executing condition %s: %v", c.Key, err)
+			return nil, err
+		}
+
+		for _, s := range all {
+			if len(s.values) == 0 {
+				continue
+			}
+
+			value, err := reduce(c.Aggregation, s.values)
+			if err != nil {
+				return nil, err
+			}
+
+			met, err := metrics.Compare(c.Operator, value, c.Values[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if !met {
+				continue
+			}
+
+			metric, err := metrics.LabelsToMetric(i.mapTags(s.tags))
+			if err != nil {
+				return nil, err
+			}
+
+			rval = append(rval, metrics.Vector{
+				Metric:    metric,
+				Value:     []interface{}{float64(time.Now().Unix()), strconv.FormatFloat(value, 'f', -1, 64)},
+				Condition: index,
+			})
+		}
+	}
+
+	return rval, nil
+}
+
+// reduce returns the last value of the series, or the value reduced by the
+// aggregation of the condition
+func reduce(agg *autopilot.ConditionAggregation, values [][]interface{}) (float64, error) {
+	if agg == nil {
+		agg = &autopilot.ConditionAggregation{Function: autopilot.AggregationLast}
+	}
+
+	return metrics.Reduce(agg, values)
+}
+
+// mapTags renames the tags mapped by the tag params to their metric label
+func (i *influxdb) mapTags(tags map[string]string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for name, value := range tags {
+		if label, ok := i.tags[name]; ok {
+			name = label
+		}
+		labels[name] = value
+	}
+
+	return labels
+}
+
+func (i *influxdb) queryInfluxQL(ctx context.Context, query string) ([]series, error) {
+	base, err := url.Parse(i.url)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = path.Join(base.Path, "/query")
+
+	q := base.Query()
+	q.Set("q", query)
+	q.Set("epoch", "s")
+	if len(i.db) > 0 {
+		q.Set("db", i.db)
+	}
+	if len(i.rp) > 0 {
+		q.Set("rp", i.rp)
+	}
+	base.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := i.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseInfluxQL(data)
+}
+
+func (i *influxdb) queryFlux(ctx context.Context, query string) ([]series, error) {
+	base, err := url.Parse(i.url)
+	if err != nil {
+		return nil, err
+	}
+	base.Path = path.Join(base.Path, "/api/v2/query")
+
+	if len(i.org) > 0 {
+		q := base.Query()
+		q.Set("org", i.org)
+		base.RawQuery = q.Encode()
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query": query,
+		"type":  languageFlux,
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", base.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+
+	data, err := i.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFlux(data)
+}
+
+func (i *influxdb) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	req = req.WithContext(ctx)
+	logrus.Infof("influxdb: executing query %s", req.URL.String())
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get data: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+func parseInfluxQL(data []byte) ([]series, error) {
+	resp := &influxQLResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Error) > 0 {
+		return nil, errors.New(resp.Error)
+	}
+
+	all := make([]series, 0)
+	for _, result := range resp.Results {
+		if len(result.Error) > 0 {
+			return nil, errors.New(result.Error)
+		}
+
+		for _, s := range result.Series {
+			timeColumn, valueColumn := -1, -1
+			for index, column := range s.Columns {
+				if column == "time" {
+					timeColumn = index
+				} else if valueColumn < 0 {
+					valueColumn = index
+				}
+			}
+
+			if timeColumn < 0 || valueColumn < 0 {
+				return nil, fmt.Errorf("series %s has no time or value column", s.Name)
+			}
+
+			values := make([][]interface{}, 0, len(s.Values))
+			for _, row := range s.Values {
+				if len(row) <= timeColumn || len(row) <= valueColumn || row[valueColumn] == nil {
+					continue
+				}
+				values = append(values, []interface{}{row[timeColumn], row[valueColumn]})
+			}
+
+			all = append(all, series{tags: s.Tags, values: values})
+		}
+	}
+
+	return all, nil
+}
+
+// parseFlux parses the flux csv response. Every table of the response is a series.
+func parseFlux(data []byte) ([]series, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	tables := make(map[string]*series)
+	order := make([]string, 0)
+
+	var header []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// tables with different columns are separated by a blank line and a new header,
+		// the csv reader skips the blank line so the header is told by its column names
+		if header == nil || isFluxHeader(record) {
+			header = record
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+		for index, column := range header {
+			if index < len(record) {
+				row[column] = record[index]
+			}
+		}
+
+		if msg, ok := row["error"]; ok && len(msg) > 0 {
+			return nil, errors.New(msg)
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, row["_time"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid _time %q", row["_time"])
+		}
+
+		key := row["result"] + "/" + row["table"]
+		s, ok := tables[key]
+		if !ok {
+			s = &series{tags: make(map[string]string)}
+			for column, value := range row {
+				if !fluxColumns[column] {
+					s.tags[column] = value
+				}
+			}
+			tables[key] = s
+			order = append(order, key)
+		}
+
+		s.values = append(s.values, []interface{}{float64(ts.UnixNano()) / 1e9, row["_value"]})
+	}
+
+	all := make([]series, 0, len(order))
+	for _, key := range order {
+		s := tables[key]
+		sort.Slice(s.values, func(a, b int) bool {
+			return s.values[a][0].(float64) < s.values[b][0].(float64)
+		})
+		all = append(all, *s)
+	}
+
+	return all, nil
+}
+
+// isFluxHeader returns whether the record is the header of a table. The _time
+// column name is never a value of a row, and errors have a table of their own.
+func isFluxHeader(record []string) bool {
+	for index, field := range record {
+		if field == "_time" || (index <= 1 && field == "error") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func init() {
+	metrics.Register("influxdb", New)
+}
@@ -0,0 +1,107 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+const influxQLData = `{"results":[{"statement_id":0,"series":[
+  {"name":"disk","tags":{"pv":"pvc-1","namespace":"db"},"columns":["time","last"],"values":[[1550000000,85.5]]},
+  {"name":"disk","tags":{"pv":"pvc-2","namespace":"db"},"columns":["time","last"],"values":[[1550000000,40]]}
+]}]}`
+
+const fluxData = "" +
+	",result,table,_start,_stop,_time,_value,_field,_measurement,volumename\r\n" +
+	",_result,0,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:10:00Z,70,used_percent,disk,pvc-1\r\n" +
+	",_result,0,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:20:00Z,90,used_percent,disk,pvc-1\r\n" +
+	",_result,1,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:10:00Z,10,used_percent,disk,pvc-2\r\n" +
+	"\r\n"
+
+// fluxSchemas is a response with two tables of different columns, each with its own header
+const fluxSchemas = "" +
+	",result,table,_start,_stop,_time,_value,_field,_measurement,volumename\r\n" +
+	",_result,0,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:10:00Z,70,used_percent,disk,pvc-1\r\n" +
+	"\r\n" +
+	",result,table,_start,_stop,_time,_value,_field,_measurement,host,volumename\r\n" +
+	",_result,1,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:20:00Z,85,used_percent,disk,node-1,pvc-2\r\n" +
+	",_result,1,2019-02-12T00:00:00Z,2019-02-12T01:00:00Z,2019-02-12T00:10:00Z,80,used_percent,disk,node-1,pvc-2\r\n" +
+	"\r\n"
+
+func policy(key string, agg *autopilot.ConditionAggregation) *metrics.StoragePolicy {
+	return &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: key, Operator: "gt", Values: []string{"80"}, Aggregation: agg},
+			},
+		},
+	}
+}
+
+func TestInfluxQL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/query", r.URL.Path)
+		require.Equal(t, "telegraf", r.URL.Query().Get("db"))
+		fmt.Fprint(w, influxQLData)
+	}))
+	defer server.Close()
+
+	prov, err := New(sparks.ParseStringParams(fmt.Sprintf("url=%s db=telegraf tag.volumename=pv", server.URL)))
+	require.NoError(t, err, "Failed to create provider")
+
+	vecs, err := prov.Query(context.Background(), policy(`SELECT last("used_percent") FROM "disk" GROUP BY "pv"`, nil))
+	require.NoError(t, err, "Failed to query")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	require.Equal(t, "db", *vecs[0].Metric.Namespace)
+}
+
+func TestFlux(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/query", r.URL.Path)
+		require.Equal(t, "POST", r.Method)
+		fmt.Fprint(w, fluxData)
+	}))
+	defer server.Close()
+
+	prov, err := New(sparks.ParseStringParams(fmt.Sprintf("url=%s language=flux org=storage", server.URL)))
+	require.NoError(t, err, "Failed to create provider")
+
+	query := `from(bucket: "telegraf") |> range(start: -1h) |> filter(fn: (r) => r._field == "used_percent")`
+
+	vecs, err := prov.Query(context.Background(), policy(query, nil))
+	require.NoError(t, err, "Failed to query")
+	require.Len(t, vecs, 1, "Expected the last value of pvc-1 to match")
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+
+	vecs, err = prov.Query(context.Background(), policy(query, &autopilot.ConditionAggregation{
+		Function: autopilot.AggregationAvg,
+	}))
+	require.NoError(t, err, "Failed to query")
+	require.Empty(t, vecs, "Expected the average of pvc-1 not to match")
+}
+
+func TestParseFluxSchemas(t *testing.T) {
+	all, err := parseFlux([]byte(fluxSchemas))
+	require.NoError(t, err, "Failed to parse tables with different columns")
+	require.Len(t, all, 2)
+
+	require.Equal(t, map[string]string{"volumename": "pvc-1"}, all[0].tags)
+	require.Len(t, all[0].values, 1)
+
+	require.Equal(t, map[string]string{"host": "node-1", "volumename": "pvc-2"}, all[1].tags)
+	require.Len(t, all[1].values, 2)
+	require.Equal(t, "80", all[1].values[0][1], "Expected the values sorted by time")
+	require.Equal(t, "85", all[1].values[1][1])
+
+	_, err = parseFlux([]byte(fluxSchemas + ",error,reference\r\n,query timed out,\r\n\r\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "query timed out")
+}
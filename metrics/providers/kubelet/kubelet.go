@@ -0,0 +1,539 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// ParamSource is where the volume stats are read from: summary for the
+	// kubelet /stats/summary api or metrics for the kubelet /metrics endpoint.
+	// Defaults to summary.
+	ParamSource = "source"
+	// ParamKubeConfig is the kubeconfig used to reach the API server, the in
+	// cluster config is used if it is not set
+	ParamKubeConfig = "kubeconfig"
+	// ParamCacheTTL is how long the list of nodes and PVCs is reused across
+	// queries. Defaults to 1m.
+	ParamCacheTTL = "cache_ttl"
+	// ParamNodeTimeout is how long the stats of a single node are waited for
+	// before the node is skipped. Defaults to 5s.
+	ParamNodeTimeout = "node_timeout"
+
+	sourceSummary = "summary"
+	sourceMetrics = "metrics"
+
+	defaultCacheTTL    = time.Minute
+	defaultNodeTimeout = 5 * time.Second
+
+	gib = float64(1 << 30)
+)
+
+// kubelet_volume_stats_* metrics exposed by the kubelet
+const (
+	statsCapacityBytes  = "kubelet_volume_stats_capacity_bytes"
+	statsAvailableBytes = "kubelet_volume_stats_available_bytes"
+	statsUsedBytes      = "kubelet_volume_stats_used_bytes"
+	statsInodes         = "kubelet_volume_stats_inodes"
+	statsInodesFree     = "kubelet_volume_stats_inodes_free"
+	statsInodesUsed     = "kubelet_volume_stats_inodes_used"
+)
+
+// cluster is the access of the provider to the API server
+type cluster interface {
+	// nodes lists the nodes of the cluster
+	nodes() ([]v1.Node, error)
+	// persistentVolumeClaims lists the PVCs of every namespace
+	persistentVolumeClaims() ([]v1.PersistentVolumeClaim, error)
+	// nodeProxy gets the path of the kubelet of the node through the API server node proxy
+	nodeProxy(ctx context.Context, node, path string) ([]byte, error)
+}
+
+type apiCluster struct {
+	client kubernetes.Interface
+}
+
+func (c *apiCluster) nodes() ([]v1.Node, error) {
+	nodes, err := c.client.CoreV1().Nodes().List(meta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes.Items, nil
+}
+
+func (c *apiCluster) persistentVolumeClaims() ([]v1.PersistentVolumeClaim, error) {
+	pvcs, err := c.client.CoreV1().PersistentVolumeClaims("").List(meta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return pvcs.Items, nil
+}
+
+func (c *apiCluster) nodeProxy(ctx context.Context, node, path string) ([]byte, error) {
+	return c.client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(node).
+		SubResource("proxy").
+		Suffix(path).
+		Context(ctx).
+		DoRaw()
+}
+
+type kubelet struct {
+	cluster     cluster
+	source      string
+	cacheTTL    time.Duration
+	nodeTimeout time.Duration
+
+	// ready nodes and PV of every bound PVC, listed at most every cacheTTL
+	mu       sync.Mutex
+	nodes    []string
+	volumes  map[string]string
+	cachedAt time.Time
+}
+
+// volumeStats are the stats of the volume of a PVC as reported by the kubelet
+type volumeStats struct {
+	namespace  string
+	pvc        string
+	node       string
+	capacity   float64
+	available  float64
+	used       float64
+	inodes     float64
+	inodesFree float64
+	inodesUsed float64
+}
+
+// summary is the subset of the kubelet /stats/summary response holding the volume stats
+type summary struct {
+	Pods []struct {
+		Volumes []struct {
+			PVCRef *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef,omitempty"`
+			CapacityBytes  *uint64 `json:"capacityBytes,omitempty"`
+			AvailableBytes *uint64 `json:"availableBytes,omitempty"`
+			UsedBytes      *uint64 `json:"usedBytes,omitempty"`
+			Inodes         *uint64 `json:"inodes,omitempty"`
+			InodesFree     *uint64 `json:"inodesFree,omitempty"`
+			InodesUsed     *uint64 `json:"inodesUsed,omitempty"`
+		} `json:"volume,omitempty"`
+	} `json:"pods"`
+}
+
+// New returns a new kubelet volume stats provider instance
+func New(params metrics.Params) (metrics.Provider, error) {
+	source := params.String(ParamSource, sourceSummary)
+	if source != sourceSummary && source != sourceMetrics {
+		return nil, fmt.Errorf("kubelet: invalid %s param %q", ParamSource, source)
+	}
+
+	var config *rest.Config
+	var err error
+	if kubeconfig := params.String(ParamKubeConfig); len(kubeconfig) > 0 {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kubelet: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kubelet: %v", err)
+	}
+
+	cacheTTL := defaultCacheTTL
+	if ttl := params.String(ParamCacheTTL); len(ttl) > 0 {
+		if cacheTTL, err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("kubelet: invalid %s param %q: %v", ParamCacheTTL, ttl, err)
+		}
+	}
+
+	nodeTimeout := defaultNodeTimeout
+	if timeout := params.String(ParamNodeTimeout); len(timeout) > 0 {
+		if nodeTimeout, err = time.ParseDuration(timeout); err != nil || nodeTimeout <= 0 {
+			return nil, fmt.Errorf("kubelet: invalid %s param %q", ParamNodeTimeout, timeout)
+		}
+	}
+
+	return &kubelet{
+		cluster:     &apiCluster{client: client},
+		source:      source,
+		cacheTTL:    cacheTTL,
+		nodeTimeout: nodeTimeout,
+	}, nil
+}
+
+// Query implements the metrics.Provider.Query interface method
+func (k *kubelet) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+	conditions := policy.Spec.ConditionList()
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	nodes, volumes, err := k.inventory(false)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := k.volumeStats(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stats {
+		if _, ok := volumes[s.namespace+"/"+s.pvc]; !ok {
+			// a PVC created since the last listing
+			if _, volumes, err = k.inventory(true); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	now := float64(time.Now().Unix())
+	rval := make([]metrics.Vector, 0)
+	for i, c := range conditions {
+		if c.Aggregation != nil || c.Forecast != nil {
+			return nil, fmt.Errorf("kubelet: condition %s: aggregations and forecasts are not supported", c.Key)
+		}
+
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("kubelet: condition %s has no value", c.Key)
+		}
+
+		for _, s := range stats {
+			value, err := conditionValue(metrics.ConditionMetric(c.Key), s)
+			if err != nil {
+				log.StoragePolicyLog(policy).Errorf("kubelet: failed to evaluate condition %s: %v", c.Key, err)
+				return nil, err
+			}
+
+			met, err := metrics.Compare(c.Operator, value, c.Values[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if !met {
+				continue
+			}
+
+			namespace, pvc := s.namespace, s.pvc
+			vec := metrics.Vector{
+				Metric: metrics.Metric{
+					Name:      c.Key,
+					NodeName:  s.node,
+					VolumePVC: &pvc,
+					Namespace: &namespace,
+				},
+				Value:     []interface{}{now, strconv.FormatFloat(value, 'f', -1, 64)},
+				Condition: i,
+			}
+
+			if pv, ok := volumes[namespace+"/"+pvc]; ok {
+				vec.Metric.VolumeName = &pv
+			}
+
+			rval = append(rval, vec)
+		}
+	}
+
+	return rval, nil
+}
+
+// conditionValue returns the value of the condition metric for the volume
+func conditionValue(name string, s *volumeStats) (float64, error) {
+	switch name {
+	case statsCapacityBytes:
+		return s.capacity, nil
+	case statsAvailableBytes:
+		return s.available, nil
+	case statsUsedBytes:
+		return s.used, nil
+	case statsInodes:
+		return s.inodes, nil
+	case statsInodesFree:
+		return s.inodesFree, nil
+	case statsInodesUsed:
+		return s.inodesUsed, nil
+	case metrics.VolumeCapacityGB:
+		return s.capacity / gib, nil
+	case metrics.VolumeAvailableGB:
+		return s.available / gib, nil
+	case metrics.VolumeUsageGB:
+		return s.used / gib, nil
+	case metrics.VolumeUsagePercentage:
+		if s.capacity == 0 {
+			return 0, nil
+		}
+		return 100 * s.used / s.capacity, nil
+	case metrics.VolumeInodesPercentage:
+		if s.inodes == 0 {
+			return 0, nil
+		}
+		return 100 * s.inodesUsed / s.inodes, nil
+	default:
+		return 0, fmt.Errorf("unsupported condition metric %q", name)
+	}
+}
+
+// inventory returns the ready nodes and the PV bound to every PVC keyed by
+// PVC namespace/name. They are listed again once the cache expires, or when
+// refresh is set unless they were just listed.
+func (k *kubelet) inventory(refresh bool) ([]string, map[string]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	age := time.Since(k.cachedAt)
+	if k.volumes != nil && age < k.cacheTTL && (!refresh || age < time.Second) {
+		return k.nodes, k.volumes, nil
+	}
+
+	nodes, err := k.cluster.nodes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("kubelet: failed to list nodes: %v", err)
+	}
+
+	pvcs, err := k.cluster.persistentVolumeClaims()
+	if err != nil {
+		return nil, nil, fmt.Errorf("kubelet: failed to list PVCs: %v", err)
+	}
+
+	k.nodes = make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if isNodeReady(&node) {
+			k.nodes = append(k.nodes, node.Name)
+		} else {
+			logrus.Debugf("kubelet: skipping node %s that is not ready", node.Name)
+		}
+	}
+
+	k.volumes = make(map[string]string)
+	for _, pvc := range pvcs {
+		if len(pvc.Spec.VolumeName) > 0 {
+			k.volumes[pvc.Namespace+"/"+pvc.Name] = pvc.Spec.VolumeName
+		}
+	}
+
+	k.cachedAt = time.Now()
+	return k.nodes, k.volumes, nil
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// volumeStats collects the stats of the PVC volumes from the kubelet of the
+// nodes through the API server node proxy. The nodes whose stats can't be read
+// within the node timeout are skipped, it fails only if none of them can be read.
+func (k *kubelet) volumeStats(ctx context.Context, nodes []string) ([]*volumeStats, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("kubelet: no ready node")
+	}
+
+	suffix := "stats/summary"
+	if k.source == sourceMetrics {
+		suffix = "metrics"
+	}
+
+	stats := make([]*volumeStats, 0)
+	var lastErr error
+	failed := 0
+	for _, node := range nodes {
+		data, err := k.nodeProxy(ctx, node, suffix)
+		if err == nil {
+			var nodeStats []*volumeStats
+			if k.source == sourceMetrics {
+				nodeStats, err = parseMetrics(data)
+			} else {
+				nodeStats, err = parseSummary(data)
+			}
+
+			if err == nil {
+				for _, s := range nodeStats {
+					s.node = node
+				}
+				stats = append(stats, nodeStats...)
+				continue
+			}
+
+			err = fmt.Errorf("invalid volume stats: %v", err)
+		}
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("kubelet: %v", ctx.Err())
+		}
+
+		failed++
+		lastErr = fmt.Errorf("node %s: %v", node, err)
+		logrus.Warnf("kubelet: skipping node %s, failed to get its volume stats: %v", node, err)
+	}
+
+	if failed == len(nodes) {
+		return nil, fmt.Errorf("kubelet: failed to get the volume stats of every node, last error: %v", lastErr)
+	}
+
+	return stats, nil
+}
+
+// nodeProxy gets the path of the kubelet of the node, a slow node doesn't
+// hold the remaining nodes past the node timeout
+func (k *kubelet) nodeProxy(ctx context.Context, node, path string) ([]byte, error) {
+	timeout := k.nodeTimeout
+	if timeout <= 0 {
+		timeout = defaultNodeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return k.cluster.nodeProxy(ctx, node, path)
+}
+
+func parseSummary(data []byte) ([]*volumeStats, error) {
+	s := &summary{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	value := func(v *uint64) float64 {
+		if v == nil {
+			return 0
+		}
+		return float64(*v)
+	}
+
+	stats := make([]*volumeStats, 0)
+	seen := make(map[string]bool)
+	for _, pod := range s.Pods {
+		for _, vol := range pod.Volumes {
+			if vol.PVCRef == nil {
+				continue
+			}
+
+			// a PVC mounted by several pods on the node is reported once per pod
+			key := vol.PVCRef.Namespace + "/" + vol.PVCRef.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			stats = append(stats, &volumeStats{
+				namespace:  vol.PVCRef.Namespace,
+				pvc:        vol.PVCRef.Name,
+				capacity:   value(vol.CapacityBytes),
+				available:  value(vol.AvailableBytes),
+				used:       value(vol.UsedBytes),
+				inodes:     value(vol.Inodes),
+				inodesFree: value(vol.InodesFree),
+				inodesUsed: value(vol.InodesUsed),
+			})
+		}
+	}
+
+	return stats, nil
+}
+
+func parseMetrics(data []byte) ([]*volumeStats, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	byPVC := make(map[string]*volumeStats)
+	stats := make([]*volumeStats, 0)
+
+	fields := map[string]func(*volumeStats) *float64{
+		statsCapacityBytes:  func(s *volumeStats) *float64 { return &s.capacity },
+		statsAvailableBytes: func(s *volumeStats) *float64 { return &s.available },
+		statsUsedBytes:      func(s *volumeStats) *float64 { return &s.used },
+		statsInodes:         func(s *volumeStats) *float64 { return &s.inodes },
+		statsInodesFree:     func(s *volumeStats) *float64 { return &s.inodesFree },
+		statsInodesUsed:     func(s *volumeStats) *float64 { return &s.inodesUsed },
+	}
+
+	for name, field := range fields {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			namespace, pvc := labelValue(m, "namespace"), labelValue(m, "persistentvolumeclaim")
+			if len(pvc) == 0 {
+				continue
+			}
+
+			key := namespace + "/" + pvc
+			s, ok := byPVC[key]
+			if !ok {
+				s = &volumeStats{namespace: namespace, pvc: pvc}
+				byPVC[key] = s
+				stats = append(stats, s)
+			}
+
+			*field(s) = m.GetGauge().GetValue()
+		}
+	}
+
+	return stats, nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+
+	return ""
+}
+
+func init() {
+	metrics.Register("kubelet", New)
+}
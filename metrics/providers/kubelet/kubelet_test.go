@@ -0,0 +1,189 @@
+package kubelet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const summaryData = `{
+  "node": {"nodeName": "node-1"},
+  "pods": [
+    {"volume": [
+      {"name": "data", "pvcRef": {"name": "pgdata", "namespace": "db"},
+       "capacityBytes": 10737418240, "availableBytes": 2147483648, "usedBytes": 8589934592,
+       "inodes": 1000, "inodesFree": 250, "inodesUsed": 750},
+      {"name": "token", "capacityBytes": 100}
+    ]},
+    {"volume": [
+      {"name": "data", "pvcRef": {"name": "pgdata", "namespace": "db"}, "usedBytes": 8589934592}
+    ]}
+  ]
+}`
+
+const metricsData = `# HELP kubelet_volume_stats_used_bytes Number of used bytes in the volume
+# TYPE kubelet_volume_stats_used_bytes gauge
+kubelet_volume_stats_used_bytes{namespace="db",persistentvolumeclaim="pgdata"} 8.589934592e+09
+# HELP kubelet_volume_stats_capacity_bytes Capacity in bytes of the volume
+# TYPE kubelet_volume_stats_capacity_bytes gauge
+kubelet_volume_stats_capacity_bytes{namespace="db",persistentvolumeclaim="pgdata"} 1.073741824e+10
+`
+
+func TestParseSummary(t *testing.T) {
+	stats, err := parseSummary([]byte(summaryData))
+	require.NoError(t, err, "Failed to parse summary")
+	require.Len(t, stats, 1, "Expected only the PVC volume to be reported, once")
+
+	s := stats[0]
+	require.Equal(t, "db", s.namespace)
+	require.Equal(t, "pgdata", s.pvc)
+
+	usage, err := conditionValue(metrics.VolumeUsagePercentage, s)
+	require.NoError(t, err)
+	require.Equal(t, float64(80), usage)
+
+	inodes, err := conditionValue(metrics.VolumeInodesPercentage, s)
+	require.NoError(t, err)
+	require.Equal(t, float64(75), inodes)
+
+	capacity, err := conditionValue(metrics.VolumeCapacityGB, s)
+	require.NoError(t, err)
+	require.Equal(t, float64(10), capacity)
+
+	_, err = conditionValue("volume.bogus", s)
+	require.Error(t, err, "Expected unknown metric to fail")
+}
+
+func TestParseMetrics(t *testing.T) {
+	stats, err := parseMetrics([]byte(metricsData))
+	require.NoError(t, err, "Failed to parse metrics")
+	require.Len(t, stats, 1)
+
+	usage, err := conditionValue(metrics.VolumeUsagePercentage, stats[0])
+	require.NoError(t, err)
+	require.Equal(t, float64(80), usage)
+
+	used, err := conditionValue(statsUsedBytes, stats[0])
+	require.NoError(t, err)
+	require.Equal(t, float64(8589934592), used)
+}
+
+type fakeCluster struct {
+	nodeList  []v1.Node
+	pvcList   []v1.PersistentVolumeClaim
+	stats     map[string]string
+	nodeLists int
+	// slow nodes answer only when the request is canceled
+	slow map[string]bool
+}
+
+func (f *fakeCluster) nodes() ([]v1.Node, error) {
+	f.nodeLists++
+	return f.nodeList, nil
+}
+
+func (f *fakeCluster) persistentVolumeClaims() ([]v1.PersistentVolumeClaim, error) {
+	return f.pvcList, nil
+}
+
+func (f *fakeCluster) nodeProxy(ctx context.Context, node, path string) ([]byte, error) {
+	if f.slow[node] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	data, ok := f.stats[node]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return []byte(data), nil
+}
+
+func testNode(name string, ready v1.ConditionStatus) v1.Node {
+	return v1.Node{
+		ObjectMeta: meta.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+func TestQuerySkipsFailedNodes(t *testing.T) {
+	cluster := &fakeCluster{
+		nodeList: []v1.Node{
+			testNode("node-1", v1.ConditionTrue),
+			testNode("node-2", v1.ConditionTrue),
+			testNode("node-3", v1.ConditionUnknown),
+		},
+		pvcList: []v1.PersistentVolumeClaim{{
+			ObjectMeta: meta.ObjectMeta{Name: "pgdata", Namespace: "db"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+		}},
+		// node-2 is unreachable
+		stats: map[string]string{"node-1": summaryData, "node-3": summaryData},
+	}
+	k := &kubelet{cluster: cluster, source: sourceSummary, cacheTTL: time.Minute}
+
+	policy := &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: metrics.VolumeUsagePercentage, Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	}
+
+	vecs, err := k.Query(context.Background(), policy)
+	require.NoError(t, err, "Expected the unreachable node to be skipped")
+	require.Len(t, vecs, 1, "Expected the node that is not ready to be skipped")
+	require.Equal(t, "node-1", vecs[0].Metric.NodeName)
+	require.Equal(t, "pv-1", *vecs[0].Metric.VolumeName)
+
+	_, err = k.Query(context.Background(), policy)
+	require.NoError(t, err)
+	require.Equal(t, 1, cluster.nodeLists, "Expected the nodes to be cached")
+
+	cluster.stats = nil
+	k.cachedAt = time.Time{}
+	_, err = k.Query(context.Background(), policy)
+	require.Error(t, err, "Expected the query to fail when every node fails")
+}
+
+func TestQuerySkipsSlowNodes(t *testing.T) {
+	cluster := &fakeCluster{
+		nodeList: []v1.Node{
+			testNode("node-1", v1.ConditionTrue),
+			testNode("node-2", v1.ConditionTrue),
+		},
+		pvcList: []v1.PersistentVolumeClaim{{
+			ObjectMeta: meta.ObjectMeta{Name: "pgdata", Namespace: "db"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-1"},
+		}},
+		stats: map[string]string{"node-1": summaryData, "node-2": summaryData},
+		slow:  map[string]bool{"node-1": true},
+	}
+	k := &kubelet{cluster: cluster, source: sourceSummary, cacheTTL: time.Minute, nodeTimeout: 10 * time.Millisecond}
+
+	policy := &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: metrics.VolumeUsagePercentage, Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	vecs, err := k.Query(ctx, policy)
+	require.NoError(t, err, "Expected the slow node to be skipped")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "node-2", vecs[0].Metric.NodeName)
+	require.NoError(t, ctx.Err(), "Expected the slow node not to hold the query")
+}
@@ -0,0 +1,361 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/pkg/log"
+	osd "github.com/libopenstorage/autopilot/pkg/openstorage"
+	"github.com/libopenstorage/openstorage/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ParamEndpoint is the openstorage SDK endpoint, such as portworx-service.kube-system:9020
+	ParamEndpoint = "endpoint"
+	// ParamToken is the token sent with every request to secured SDK endpoints
+	ParamToken = "token"
+
+	gib = float64(1 << 30)
+
+	pvcLabel       = "pvc"
+	namespaceLabel = "namespace"
+)
+
+type openstorage struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// New returns a new openstorage SDK provider instance
+func New(params metrics.Params) (metrics.Provider, error) {
+	endpoint := params.String(ParamEndpoint)
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("openstorage: missing %s param", ParamEndpoint)
+	}
+
+	tlsConfig, err := osd.TLSConfig(params)
+	if err != nil {
+		return nil, fmt.Errorf("openstorage: %v", err)
+	}
+
+	conn, err := osd.Dial(endpoint, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("openstorage: %v", err)
+	}
+
+	return &openstorage{
+		conn:  conn,
+		token: params.String(ParamToken),
+	}, nil
+}
+
+// Query implements the metrics.Provider.Query interface method
+func (o *openstorage) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+	if len(o.token) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "bearer "+o.token)
+	}
+
+	snapshot := &snapshot{conn: o.conn}
+	now := float64(time.Now().Unix())
+	rval := make([]metrics.Vector, 0)
+
+	for i, c := range policy.Spec.ConditionList() {
+		if c.Aggregation != nil || c.Forecast != nil {
+			return nil, fmt.Errorf("openstorage: condition %s: aggregations and forecasts are not supported", c.Key)
+		}
+
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("openstorage: condition %s has no value", c.Key)
+		}
+
+		samples, err := snapshot.samples(ctx, metrics.ConditionMetric(c.Key))
+		if err != nil {
+			log.StoragePolicyLog(policy).Errorf("openstorage: failed to evaluate condition %s: %v", c.Key, err)
+			return nil, err
+		}
+
+		for _, sample := range samples {
+			met, err := metrics.Compare(c.Operator, sample.value, c.Values[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if !met {
+				continue
+			}
+
+			sample.metric.Name = c.Key
+			rval = append(rval, metrics.Vector{
+				Metric:    sample.metric,
+				Value:     []interface{}{now, strconv.FormatFloat(sample.value, 'f', -1, 64)},
+				Condition: i,
+			})
+		}
+	}
+
+	return rval, nil
+}
+
+// Close closes the connection to the SDK endpoint
+func (o *openstorage) Close() error {
+	return o.conn.Close()
+}
+
+// sample is the value of a metric for a single object
+type sample struct {
+	metric metrics.Metric
+	value  float64
+}
+
+// snapshot caches the volumes and nodes fetched while evaluating the
+// conditions of a single query
+type snapshot struct {
+	conn    *grpc.ClientConn
+	volumes []*api.Volume
+	nodes   []*api.StorageNode
+}
+
+func (s *snapshot) samples(ctx context.Context, name string) ([]sample, error) {
+	switch name {
+	case metrics.VolumeUsagePercentage, metrics.VolumeUsageGB, metrics.VolumeCapacityGB:
+		return s.volumeCapacitySamples(ctx, name)
+	case metrics.VolumeLatencyMS, metrics.VolumeIOPS:
+		return s.volumeStatsSamples(ctx, name)
+	case metrics.StoragePoolUsagePercentage, metrics.StoragePoolCapacityGB, metrics.StoragePoolLatencyMS:
+		return s.poolSamples(ctx, name)
+	default:
+		return nil, fmt.Errorf("unsupported condition metric %q", name)
+	}
+}
+
+func (s *snapshot) volumeCapacitySamples(ctx context.Context, name string) ([]sample, error) {
+	volumes, err := s.listVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := api.NewOpenStorageVolumeClient(s.conn)
+	samples := make([]sample, 0, len(volumes))
+	for _, vol := range volumes {
+		size := float64(vol.GetSpec().GetSize())
+
+		var value float64
+		switch name {
+		case metrics.VolumeCapacityGB:
+			value = size / gib
+		default:
+			used, err := volumeUsage(ctx, client, vol)
+			if err != nil {
+				return nil, err
+			}
+
+			if name == metrics.VolumeUsageGB {
+				value = used / gib
+			} else if size > 0 {
+				value = 100 * used / size
+			}
+		}
+
+		samples = append(samples, sample{metric: volumeMetric(vol), value: value})
+	}
+
+	return samples, nil
+}
+
+// volumeUsage returns the bytes used by the volume, drivers that don't
+// implement the capacity usage call fall back on the usage of the volume
+func volumeUsage(ctx context.Context, client api.OpenStorageVolumeClient, vol *api.Volume) (float64, error) {
+	resp, err := client.CapacityUsage(ctx, &api.SdkVolumeCapacityUsageRequest{VolumeId: vol.GetId()})
+	if err == nil {
+		return float64(resp.GetCapacityUsageInfo().GetTotalBytes()), nil
+	}
+
+	if status.Code(err) == codes.Unimplemented {
+		return float64(vol.GetUsage()), nil
+	}
+
+	return 0, err
+}
+
+func (s *snapshot) volumeStatsSamples(ctx context.Context, name string) ([]sample, error) {
+	volumes, err := s.listVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := api.NewOpenStorageVolumeClient(s.conn)
+	samples := make([]sample, 0, len(volumes))
+	for _, vol := range volumes {
+		resp, err := client.Stats(ctx, &api.SdkVolumeStatsRequest{
+			VolumeId:      vol.GetId(),
+			NotCumulative: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		stats := resp.GetStats()
+		var value float64
+		switch name {
+		case metrics.VolumeLatencyMS:
+			value = latency(stats)
+		case metrics.VolumeIOPS:
+			if stats.GetIntervalMs() > 0 {
+				value = float64(stats.GetReads()+stats.GetWrites()) / (float64(stats.GetIntervalMs()) / 1000)
+			}
+		}
+
+		samples = append(samples, sample{metric: volumeMetric(vol), value: value})
+	}
+
+	return samples, nil
+}
+
+func (s *snapshot) poolSamples(ctx context.Context, name string) ([]sample, error) {
+	nodes, err := s.listNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]sample, 0)
+	for _, node := range nodes {
+		for _, pool := range node.GetPools() {
+			var value float64
+			switch name {
+			case metrics.StoragePoolUsagePercentage:
+				if pool.GetTotalSize() > 0 {
+					value = 100 * float64(pool.GetUsed()) / float64(pool.GetTotalSize())
+				}
+			case metrics.StoragePoolCapacityGB:
+				value = float64(pool.GetTotalSize()) / gib
+			case metrics.StoragePoolLatencyMS:
+				return nil, errors.New("storage pool latency is not reported by the openstorage SDK")
+			}
+
+			poolID := fmt.Sprintf("%s/%d", node.GetId(), pool.GetID())
+			samples = append(samples, sample{
+				metric: metrics.Metric{
+					Node:     node.GetId(),
+					NodeName: node.GetSchedulerNodeName(),
+					Pool:     &poolID,
+				},
+				value: value,
+			})
+		}
+	}
+
+	return samples, nil
+}
+
+func (s *snapshot) listVolumes(ctx context.Context) ([]*api.Volume, error) {
+	if s.volumes != nil {
+		return s.volumes, nil
+	}
+
+	client := api.NewOpenStorageVolumeClient(s.conn)
+	resp, err := client.Enumerate(ctx, &api.SdkVolumeEnumerateRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]*api.Volume, 0, len(resp.GetVolumeIds()))
+	for _, id := range resp.GetVolumeIds() {
+		inspect, err := client.Inspect(ctx, &api.SdkVolumeInspectRequest{VolumeId: id})
+		if err != nil {
+			return nil, err
+		}
+
+		// snapshots are not policy objects
+		if inspect.GetVolume().GetSource().GetParent() != "" {
+			continue
+		}
+		volumes = append(volumes, inspect.GetVolume())
+	}
+
+	s.volumes = volumes
+	return volumes, nil
+}
+
+func (s *snapshot) listNodes(ctx context.Context) ([]*api.StorageNode, error) {
+	if s.nodes != nil {
+		return s.nodes, nil
+	}
+
+	client := api.NewOpenStorageNodeClient(s.conn)
+	resp, err := client.Enumerate(ctx, &api.SdkNodeEnumerateRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*api.StorageNode, 0, len(resp.GetNodeIds()))
+	for _, id := range resp.GetNodeIds() {
+		inspect, err := client.Inspect(ctx, &api.SdkNodeInspectRequest{NodeId: id})
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, inspect.GetNode())
+	}
+
+	s.nodes = nodes
+	return nodes, nil
+}
+
+// volumeMetric returns the metric labels of the volume. The locator name of
+// volumes provisioned for PVCs is the name of the PV.
+func volumeMetric(vol *api.Volume) metrics.Metric {
+	id := vol.GetId()
+	name := vol.GetLocator().GetName()
+	m := metrics.Metric{
+		Node:       vol.GetAttachedOn(),
+		Volume:     &id,
+		VolumeName: &name,
+	}
+
+	labels := vol.GetLocator().GetVolumeLabels()
+	if pvc, ok := labels[pvcLabel]; ok {
+		m.VolumePVC = &pvc
+	}
+	if ns, ok := labels[namespaceLabel]; ok {
+		m.Namespace = &ns
+	}
+
+	return m
+}
+
+// latency returns the average latency of the reads and writes in milliseconds
+func latency(stats *api.Stats) float64 {
+	ops := stats.GetReads() + stats.GetWrites()
+	if ops == 0 {
+		return 0
+	}
+
+	return float64(stats.GetReadMs()+stats.GetWriteMs()) / float64(ops)
+}
+
+func init() {
+	metrics.Register("openstorage", New)
+}
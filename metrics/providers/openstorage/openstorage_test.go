@@ -0,0 +1,214 @@
+package openstorage
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/libopenstorage/openstorage/api"
+	"github.com/stretchr/testify/require"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeVolumes serves the volume calls of the provider, the other calls of the
+// embedded interface are not implemented
+type fakeVolumes struct {
+	api.OpenStorageVolumeServer
+	volumes map[string]*api.Volume
+	// usage of the volumes that implement the capacity usage call
+	usage map[string]int64
+	// token is the bearer token expected in the calls
+	token string
+}
+
+func (f *fakeVolumes) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if auth := md["authorization"]; len(auth) == 0 || auth[0] != "bearer "+f.token {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+func (f *fakeVolumes) Enumerate(ctx context.Context, req *api.SdkVolumeEnumerateRequest) (*api.SdkVolumeEnumerateResponse, error) {
+	if err := f.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	resp := &api.SdkVolumeEnumerateResponse{}
+	for id := range f.volumes {
+		resp.VolumeIds = append(resp.VolumeIds, id)
+	}
+	return resp, nil
+}
+
+func (f *fakeVolumes) Inspect(ctx context.Context, req *api.SdkVolumeInspectRequest) (*api.SdkVolumeInspectResponse, error) {
+	vol, ok := f.volumes[req.GetVolumeId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
+	}
+	return &api.SdkVolumeInspectResponse{Volume: vol}, nil
+}
+
+func (f *fakeVolumes) CapacityUsage(ctx context.Context, req *api.SdkVolumeCapacityUsageRequest) (*api.SdkVolumeCapacityUsageResponse, error) {
+	used, ok := f.usage[req.GetVolumeId()]
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "capacity usage not supported")
+	}
+	return &api.SdkVolumeCapacityUsageResponse{CapacityUsageInfo: &api.CapacityUsageInfo{TotalBytes: used}}, nil
+}
+
+type fakeNodes struct {
+	api.OpenStorageNodeServer
+	nodes map[string]*api.StorageNode
+}
+
+func (f *fakeNodes) Enumerate(ctx context.Context, req *api.SdkNodeEnumerateRequest) (*api.SdkNodeEnumerateResponse, error) {
+	resp := &api.SdkNodeEnumerateResponse{}
+	for id := range f.nodes {
+		resp.NodeIds = append(resp.NodeIds, id)
+	}
+	return resp, nil
+}
+
+func (f *fakeNodes) Inspect(ctx context.Context, req *api.SdkNodeInspectRequest) (*api.SdkNodeInspectResponse, error) {
+	node, ok := f.nodes[req.GetNodeId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "node %s not found", req.GetNodeId())
+	}
+	return &api.SdkNodeInspectResponse{Node: node}, nil
+}
+
+func volume(id string, size, usage uint64) *api.Volume {
+	return &api.Volume{
+		Id:      id,
+		Locator: &api.VolumeLocator{Name: "pvc-" + id},
+		Spec:    &api.VolumeSpec{Size: size},
+		Usage:   usage,
+	}
+}
+
+func TestVolumeMetric(t *testing.T) {
+	m := volumeMetric(&api.Volume{
+		Id: "1234",
+		Locator: &api.VolumeLocator{
+			Name:         "pvc-9b776615",
+			VolumeLabels: map[string]string{"pvc": "data", "namespace": "db"},
+		},
+	})
+
+	require.Equal(t, "1234", *m.Volume)
+	require.Equal(t, "pvc-9b776615", *m.VolumeName)
+	require.Equal(t, "data", *m.VolumePVC)
+	require.Equal(t, "db", *m.Namespace)
+}
+
+func TestLatency(t *testing.T) {
+	require.Equal(t, float64(0), latency(&api.Stats{}))
+	require.Equal(t, float64(3), latency(&api.Stats{Reads: 2, ReadMs: 4, Writes: 2, WriteMs: 8}))
+}
+
+func TestQuery(t *testing.T) {
+	snapshot := volume("snap-1", 10<<30, 0)
+	snapshot.Source = &api.Source{Parent: "vol-1"}
+
+	server := grpc.NewServer()
+	api.RegisterOpenStorageVolumeServer(server, &fakeVolumes{
+		volumes: map[string]*api.Volume{
+			"vol-1":  volume("vol-1", 10<<30, 0),
+			"vol-2":  volume("vol-2", 10<<30, 6<<30),
+			"vol-3":  volume("vol-3", 10<<30, 0),
+			"snap-1": snapshot,
+		},
+		usage: map[string]int64{"vol-1": 8 << 30, "vol-3": 1 << 30},
+		token: "secret",
+	})
+	api.RegisterOpenStorageNodeServer(server, &fakeNodes{
+		nodes: map[string]*api.StorageNode{
+			"node-1": {
+				Id:                "node-1",
+				SchedulerNodeName: "worker-1",
+				Pools: []*api.StoragePool{
+					{ID: 0, TotalSize: 100 << 30, Used: 90 << 30},
+					{ID: 1, TotalSize: 100 << 30, Used: 10 << 30},
+				},
+			},
+		},
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+	go server.Serve(lis)
+	defer server.Stop()
+
+	prov, err := New(sparks.ParseStringParams("endpoint=" + lis.Addr().String() + " token=secret"))
+	require.NoError(t, err, "Failed to create provider")
+
+	vecs, err := prov.Query(context.Background(), &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: metrics.VolumeUsagePercentage, Operator: "gt", Values: []string{"50"}},
+				{Key: metrics.StoragePoolUsagePercentage, Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	})
+	require.NoError(t, err, "Failed to query")
+
+	usage := make(map[string]float64)
+	for _, vec := range vecs {
+		sample, err := metrics.ParseSample(vec.Value)
+		require.NoError(t, err, "Failed to parse the value")
+
+		switch vec.Condition {
+		case 0:
+			usage[*vec.Metric.Volume] = sample.Value
+		case 1:
+			require.Equal(t, "worker-1", vec.Metric.NodeName)
+			usage[*vec.Metric.Pool] = sample.Value
+		}
+	}
+
+	// vol-2 falls back on the usage of the volume, the snapshot is not a policy object
+	require.Equal(t, map[string]float64{"vol-1": 80, "vol-2": 60, "node-1/0": 90}, usage)
+
+	prov, err = New(sparks.ParseStringParams("endpoint=" + lis.Addr().String()))
+	require.NoError(t, err, "Failed to create provider")
+
+	_, err = prov.Query(context.Background(), &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: metrics.VolumeUsagePercentage, Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	})
+	require.Equal(t, codes.Unauthenticated, status.Code(err), "Expected the query without a token to be rejected")
+
+	closer, ok := prov.(io.Closer)
+	require.True(t, ok, "Expected the provider to close its connection")
+	require.NoError(t, closer.Close())
+	_, err = prov.Query(context.Background(), &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{
+				{Key: metrics.VolumeUsagePercentage, Operator: "gt", Values: []string{"50"}},
+			},
+		},
+	})
+	require.Error(t, err, "Expected a closed provider to fail the query")
+}
+
+func TestNewTLS(t *testing.T) {
+	_, err := New(sparks.ParseStringParams("endpoint=localhost:9020 tls=true"))
+	require.NoError(t, err, "Failed to create provider with TLS")
+
+	_, err = New(sparks.ParseStringParams("endpoint=localhost:9020 ca_file=/nonexistent/ca.pem"))
+	require.Error(t, err, "Expected a missing CA file to fail")
+
+	_, err = New(sparks.ParseStringParams("endpoint=localhost:9020 cert_file=/etc/autopilot/cert.pem"))
+	require.Error(t, err, "Expected a client certificate without a key to fail")
+}
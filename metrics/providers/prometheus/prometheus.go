@@ -17,6 +17,7 @@ limitations under the License.
 package prometheus
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,11 +25,12 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/libopenstorage/autopilot/metrics"
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
 	meta "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
-	"github.com/libopenstorage/autopilot/pkg/log"
 	"github.com/sirupsen/logrus"
 )
 
@@ -54,6 +56,7 @@ type (
 	prometheus struct {
 		params metrics.Params
 		url    string
+		client *httpclient.Client
 	}
 )
 
@@ -65,16 +68,20 @@ var promQLOperatorLookup = map[meta.LabelSelectorOperator]string{
 
 // New returns a new prometheus instance
 func New(params metrics.Params) (metrics.Provider, error) {
+	client, err := httpclient.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: %v", err)
+	}
+
 	return &prometheus{
 		params: params,
 		url:    params.String("url"),
+		client: client,
 	}, nil
 }
 
 // query implements the metrics.Provider.Query interface method
-func (p *prometheus) query(params metrics.Params) ([]metrics.Vector, error) {
-	client := &http.Client{}
-
+func (p *prometheus) query(ctx context.Context, params metrics.Params) ([]metrics.Vector, error) {
 	base, err := url.Parse(p.url)
 	if err != nil {
 		return nil, err
@@ -114,13 +121,16 @@ func (p *prometheus) query(params metrics.Params) ([]metrics.Vector, error) {
 	}
 
 	req.URL.RawQuery = q.Encode()
+	req = req.WithContext(ctx)
 
 	logrus.Infof("prometheus: executing query %s", req.URL.String())
 
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get data: %s", resp.Status)
 	}
@@ -159,31 +169,232 @@ func (p *prometheus) ConditionToQuery(condition *meta.LabelSelectorRequirement)
 	return condition.Key + " " + p.LookupOperator(condition.Operator) + " " + condition.Values[0]
 }
 
-func (p *prometheus) Query(policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
+func (p *prometheus) Query(ctx context.Context, policy *metrics.StoragePolicy) ([]metrics.Vector, error) {
 	rval := make([]metrics.Vector, 0)
 
-	for _, c := range policy.Spec.Conditions {
-		m := make(metrics.Params)
-		m["query"] = p.ConditionToQuery(c)
-		vectors, err := p.query(m)
+	for i, c := range policy.Spec.ConditionList() {
+		var vectors []metrics.Vector
+		var err error
+		switch {
+		case c.Forecast != nil:
+			vectors, err = p.queryForecast(ctx, c)
+		case c.Aggregation != nil:
+			vectors, err = p.queryRange(ctx, c)
+		default:
+			m := make(metrics.Params)
+			m["query"] = p.ConditionToQuery(c)
+			vectors, err = p.query(ctx, m)
+		}
 		if err != nil {
 			logrus.Errorf("prometheus: error executing policy %q, %s, % #v", policy.Name, c.Key, err)
 			return nil, err
 		}
 
-		if len(vectors) == 0 {
-			// all conditions have to be met. So will not run the query for subsequent
-			// conditions
-			return nil, nil
+		for _, vec := range vectors {
+			vec.Condition = i
+			rval = append(rval, vec)
 		}
-
-		log.StoragePolicyLog(policy).Infof("[debug] vectors in response: %v", vectors)
-		rval = append(rval, vectors...)
 	}
 
 	return rval, nil
 }
 
+// queryRange fetches the samples of the condition key over the lookback window
+// of its aggregation and returns the series whose reduced value meets the
+// condition. The reduced value is returned as the instant value of each series.
+func (p *prometheus) queryRange(ctx context.Context, c *meta.LabelSelectorRequirement) ([]metrics.Vector, error) {
+	if len(c.Values) == 0 {
+		return nil, fmt.Errorf("condition %s has no value", c.Key)
+	}
+
+	window, step, err := metrics.RangeParams(c.Aggregation)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	m := make(metrics.Params)
+	m["query"] = c.Key
+	m["path"] = "/query_range"
+	m["start"] = now.Add(-window).Format(time.RFC3339)
+	m["end"] = now.Format(time.RFC3339)
+	m["step"] = strconv.FormatFloat(step.Seconds(), 'f', -1, 64)
+
+	vectors, err := p.query(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]metrics.Vector, 0)
+	for _, vec := range vectors {
+		if len(vec.Values) == 0 {
+			continue
+		}
+
+		value, err := metrics.Reduce(c.Aggregation, vec.Values)
+		if err != nil {
+			return nil, err
+		}
+
+		met, err := metrics.Compare(c.Operator, value, c.Values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if !met {
+			continue
+		}
+
+		vec.Value = []interface{}{float64(now.Unix()), strconv.FormatFloat(value, 'f', -1, 64)}
+		vec.Values = nil
+		matched = append(matched, vec)
+	}
+
+	return matched, nil
+}
+
+// queryForecast projects the series of the condition key forward and returns
+// the series whose time left until the forecast limit meets the condition. The
+// time left in seconds is returned as the instant value of each series.
+func (p *prometheus) queryForecast(ctx context.Context, c *meta.LabelSelectorRequirement) ([]metrics.Vector, error) {
+	if len(c.Values) == 0 {
+		return nil, fmt.Errorf("condition %s has no value", c.Key)
+	}
+
+	var vectors []metrics.Vector
+	var err error
+	switch c.Forecast.Method {
+	case meta.ForecastLinearRegression, "":
+		vectors, err = p.forecastRegression(ctx, c)
+	case meta.ForecastPredictLinear:
+		vectors, err = p.forecastPredictLinear(ctx, c)
+	default:
+		err = fmt.Errorf("unsupported forecast method %q", c.Forecast.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := float64(time.Now().Unix())
+	matched := make([]metrics.Vector, 0)
+	for _, vec := range vectors {
+		met, err := metrics.CompareForecast(c.Operator, vec.Forecast, c.Values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if !met {
+			continue
+		}
+
+		vec.Value = []interface{}{now, strconv.FormatFloat(vec.Forecast.TimeToLimit(), 'f', -1, 64)}
+		vec.Values = nil
+		matched = append(matched, vec)
+	}
+
+	return matched, nil
+}
+
+// forecastRegression fits a line to the history of every series of the key
+func (p *prometheus) forecastRegression(ctx context.Context, c *meta.LabelSelectorRequirement) ([]metrics.Vector, error) {
+	window, step, err := metrics.ForecastRange(c.Forecast)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	m := make(metrics.Params)
+	m["query"] = c.Key
+	m["path"] = "/query_range"
+	m["start"] = now.Add(-window).Format(time.RFC3339)
+	m["end"] = now.Format(time.RFC3339)
+	m["step"] = strconv.FormatFloat(step.Seconds(), 'f', -1, 64)
+
+	vectors, err := p.query(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	forecasts := make([]metrics.Vector, 0, len(vectors))
+	for _, vec := range vectors {
+		if len(vec.Values) < 2 {
+			continue
+		}
+
+		vec.Forecast, err = metrics.LinearForecast(vec.Values, metrics.ForecastLimit(c.Forecast))
+		if err != nil {
+			return nil, err
+		}
+		forecasts = append(forecasts, vec)
+	}
+
+	return forecasts, nil
+}
+
+// forecastPredictLinear projects every series of the key with predict_linear
+// over the condition threshold and joins it with the current value of the series
+func (p *prometheus) forecastPredictLinear(ctx context.Context, c *meta.LabelSelectorRequirement) ([]metrics.Vector, error) {
+	window, _, err := metrics.ForecastRange(c.Forecast)
+	if err != nil {
+		return nil, err
+	}
+
+	horizon, err := time.ParseDuration(c.Values[0])
+	if err != nil || horizon <= 0 {
+		return nil, fmt.Errorf("invalid forecast condition value %q", c.Values[0])
+	}
+
+	current, err := p.query(ctx, metrics.Params{"query": c.Key})
+	if err != nil {
+		return nil, err
+	}
+
+	currentValues := make(map[string]float64)
+	for _, vec := range current {
+		sample, err := metrics.ParseSample(vec.Value)
+		if err != nil {
+			return nil, err
+		}
+		currentValues[metricKey(vec.Metric)] = sample.Value
+	}
+
+	projected, err := p.query(ctx, metrics.Params{
+		"query": fmt.Sprintf("predict_linear(%s[%ds], %d)", c.Key, int64(window.Seconds()), int64(horizon.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forecasts := make([]metrics.Vector, 0, len(projected))
+	for _, vec := range projected {
+		value, ok := currentValues[metricKey(vec.Metric)]
+		if !ok {
+			continue
+		}
+
+		sample, err := metrics.ParseSample(vec.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		vec.Forecast = &metrics.Forecast{
+			Current: value,
+			Rate:    (sample.Value - value) / horizon.Seconds(),
+			Limit:   metrics.ForecastLimit(c.Forecast),
+		}
+		forecasts = append(forecasts, vec)
+	}
+
+	return forecasts, nil
+}
+
+// metricKey identifies a series by its labels, predict_linear drops the metric name
+func metricKey(metric metrics.Metric) string {
+	metric.Name = ""
+	data, _ := json.Marshal(metric)
+	return string(data)
+}
+
 func init() {
 	metrics.Register("prometheus", New)
 }
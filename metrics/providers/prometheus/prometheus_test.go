@@ -0,0 +1,229 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/libopenstorage/autopilot/metrics"
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+const usageKey = "px_volume_usage_percentage"
+
+// series is a prometheus series of pvc with either an instant value or a range of values
+func series(pvc string, name string, samples ...[]interface{}) map[string]interface{} {
+	s := map[string]interface{}{
+		"metric": map[string]string{"__name__": name, "volumename": pvc},
+	}
+	if len(samples) == 1 {
+		s["value"] = samples[0]
+	} else {
+		s["values"] = samples
+	}
+	return s
+}
+
+func sample(t float64, v float64) []interface{} {
+	return []interface{}{t, strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// newServer serves the result of every query from results and checks the
+// query_range parameters
+func newServer(t *testing.T, results map[string][]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		resultType := "vector"
+		switch r.URL.Path {
+		case "/api/v1/query":
+		case "/api/v1/query_range":
+			resultType = "matrix"
+			start, err := strconv.ParseInt(q.Get("start"), 10, 64)
+			require.NoError(t, err, "Expected a unix start")
+			end, err := strconv.ParseInt(q.Get("end"), 10, 64)
+			require.NoError(t, err, "Expected a unix end")
+			require.True(t, end > start, "Expected the range to end after it starts")
+			require.NotEmpty(t, q.Get("step"))
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		result, ok := results[q.Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"status": "error", "errorType": "bad_data", "error": "unexpected query %s"}`, q.Get("query"))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"resultType": resultType,
+				"result":     result,
+			},
+		})
+	}))
+}
+
+func newProvider(t *testing.T, server *httptest.Server) metrics.Provider {
+	prov, err := New(sparks.ParseStringParams("url=" + server.URL + "/api/v1"))
+	require.NoError(t, err, "Failed to create provider")
+	return prov
+}
+
+func policyOf(condition *autopilot.LabelSelectorRequirement) *metrics.StoragePolicy {
+	return &metrics.StoragePolicy{
+		Spec: autopilot.StoragePolicySpec{
+			Conditions: []*autopilot.LabelSelectorRequirement{condition},
+		},
+	}
+}
+
+func valueOf(t *testing.T, vec metrics.Vector) float64 {
+	s, err := metrics.ParseSample(vec.Value)
+	require.NoError(t, err, "Failed to parse the value")
+	return s.Value
+}
+
+func TestQuery(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := newServer(t, map[string][]map[string]interface{}{
+		usageKey + " > 50": {series("pvc-1", usageKey, sample(now, 60))},
+	})
+	defer server.Close()
+
+	vecs, err := newProvider(t, server).Query(context.Background(), policyOf(&autopilot.LabelSelectorRequirement{
+		Key: usageKey, Operator: "gt", Values: []string{"50"},
+	}))
+	require.NoError(t, err, "Failed to query")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	require.Equal(t, float64(60), valueOf(t, vecs[0]))
+
+	_, err = newProvider(t, server).Query(context.Background(), policyOf(&autopilot.LabelSelectorRequirement{
+		Key: usageKey, Operator: "lt", Values: []string{"50"},
+	}))
+	require.Error(t, err, "Expected the error of prometheus to be returned")
+}
+
+func TestQueryRange(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := newServer(t, map[string][]map[string]interface{}{
+		usageKey: {
+			series("pvc-1", usageKey, sample(now-20, 40), sample(now-10, 70), sample(now, 70)),
+			series("pvc-2", usageKey, sample(now-20, 10), sample(now-10, 90), sample(now, 20)),
+			series("pvc-3", usageKey),
+		},
+	})
+	defer server.Close()
+	prov := newProvider(t, server)
+
+	tests := []struct {
+		aggregation *autopilot.ConditionAggregation
+		threshold   string
+		expected    map[string]float64
+	}{
+		{
+			aggregation: &autopilot.ConditionAggregation{Function: autopilot.AggregationAvg, Window: "10m", Step: "10s"},
+			threshold:   "50",
+			expected:    map[string]float64{"pvc-1": 60},
+		},
+		{
+			aggregation: &autopilot.ConditionAggregation{Function: autopilot.AggregationMax, Window: "10m"},
+			threshold:   "80",
+			expected:    map[string]float64{"pvc-2": 90},
+		},
+		{
+			aggregation: &autopilot.ConditionAggregation{Function: autopilot.AggregationDelta, Window: "10m"},
+			threshold:   "5",
+			expected:    map[string]float64{"pvc-1": 30, "pvc-2": 10},
+		},
+		{
+			aggregation: &autopilot.ConditionAggregation{Function: autopilot.AggregationLast, Window: "10m"},
+			threshold:   "80",
+			expected:    map[string]float64{},
+		},
+	}
+
+	for _, test := range tests {
+		vecs, err := prov.Query(context.Background(), policyOf(&autopilot.LabelSelectorRequirement{
+			Key: usageKey, Operator: "gt", Values: []string{test.threshold}, Aggregation: test.aggregation,
+		}))
+		require.NoError(t, err, "Failed to query the %s of the range", test.aggregation.Function)
+
+		actual := make(map[string]float64)
+		for _, vec := range vecs {
+			require.Empty(t, vec.Values, "Expected the range to be reduced")
+			actual[*vec.Metric.VolumeName] = valueOf(t, vec)
+		}
+		require.Equal(t, test.expected, actual, "Unexpected %s of the range", test.aggregation.Function)
+	}
+}
+
+func TestForecastRegression(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := newServer(t, map[string][]map[string]interface{}{
+		usageKey: {
+			// grows by 10% an hour, 5h left until full
+			series("pvc-1", usageKey, sample(now-3600, 40), sample(now-1800, 45), sample(now, 50)),
+			series("pvc-2", usageKey, sample(now-3600, 50), sample(now-1800, 50), sample(now, 50)),
+			series("pvc-3", usageKey, sample(now, 50)),
+		},
+	})
+	defer server.Close()
+	prov := newProvider(t, server)
+
+	condition := &autopilot.LabelSelectorRequirement{
+		Key:      usageKey,
+		Operator: "lt",
+		Values:   []string{"24h"},
+		Forecast: &autopilot.ConditionForecast{Window: "1h", Step: "30m"},
+	}
+	vecs, err := prov.Query(context.Background(), policyOf(condition))
+	require.NoError(t, err, "Failed to forecast")
+	require.Len(t, vecs, 1, "Expected only the growing series to be full within a day")
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	require.InDelta(t, 5*3600, valueOf(t, vecs[0]), 1e-6)
+
+	condition.Values = []string{"1h"}
+	vecs, err = prov.Query(context.Background(), policyOf(condition))
+	require.NoError(t, err, "Failed to forecast")
+	require.Empty(t, vecs)
+}
+
+func TestForecastPredictLinear(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := newServer(t, map[string][]map[string]interface{}{
+		usageKey: {
+			series("pvc-1", usageKey, sample(now, 50)),
+			series("pvc-2", usageKey, sample(now, 50)),
+		},
+		// predict_linear drops the metric name, pvc-3 has no current value
+		fmt.Sprintf("predict_linear(%s[3600s], 86400)", usageKey): {
+			series("pvc-1", "", sample(now, 290)),
+			series("pvc-2", "", sample(now, 40)),
+			series("pvc-3", "", sample(now, 500)),
+		},
+	})
+	defer server.Close()
+
+	vecs, err := newProvider(t, server).Query(context.Background(), policyOf(&autopilot.LabelSelectorRequirement{
+		Key:      usageKey,
+		Operator: "lt",
+		Values:   []string{"24h"},
+		Forecast: &autopilot.ConditionForecast{Method: autopilot.ForecastPredictLinear, Window: "1h"},
+	}))
+	require.NoError(t, err, "Failed to forecast")
+	require.Len(t, vecs, 1)
+	require.Equal(t, "pvc-1", *vecs[0].Metric.VolumeName)
+	// 240% a day is 1% every 6 minutes, 50% left
+	require.InDelta(t, 50*360, valueOf(t, vecs[0]), 1e-6)
+}
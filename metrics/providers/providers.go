@@ -18,5 +18,10 @@ package providers
 
 import (
 	// register the providers
+	_ "github.com/libopenstorage/autopilot/metrics/providers/alertmanager"
+	_ "github.com/libopenstorage/autopilot/metrics/providers/graphite"
+	_ "github.com/libopenstorage/autopilot/metrics/providers/influxdb"
+	_ "github.com/libopenstorage/autopilot/metrics/providers/kubelet"
+	_ "github.com/libopenstorage/autopilot/metrics/providers/openstorage"
 	_ "github.com/libopenstorage/autopilot/metrics/providers/prometheus"
 )
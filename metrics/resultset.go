@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+// ResultSet indexes the vectors returned for the conditions of a policy by the
+// identity of the object they belong to, so the conditions of every object are
+// evaluated from a single query per condition
+type ResultSet struct {
+	conditions int
+	objects    map[string]map[int][]Vector
+}
+
+// ObjectID returns the identity of the object of the given type the metric
+// belongs to, and false if the metric doesn't carry it
+func ObjectID(objectType string, metric Metric) (string, bool) {
+	var id *string
+	switch objectType {
+	case autopilot.PolicyObjectTypeVolume:
+		id = metric.VolumeName
+	case autopilot.PolicyObjectTypeStoragePool:
+		id = metric.Pool
+	case autopilot.PolicyObjectTypeDisk:
+		id = metric.Disk
+	case autopilot.PolicyObjectTypeNode:
+		if len(metric.NodeName) > 0 {
+			return metric.NodeName, true
+		}
+		return metric.Node, len(metric.Node) > 0
+	}
+
+	if id == nil || len(*id) == 0 {
+		return "", false
+	}
+
+	return *id, true
+}
+
+// NewResultSet returns the result set of the vectors of a policy with the
+// given object type and number of conditions, as returned by
+// StoragePolicySpec.ConditionList. Vectors that don't identify an object of
+// that type are dropped.
+func NewResultSet(objectType string, conditions int, vecs []Vector) *ResultSet {
+	r := &ResultSet{
+		conditions: conditions,
+		objects:    make(map[string]map[int][]Vector),
+	}
+
+	for _, vec := range vecs {
+		id, ok := ObjectID(objectType, vec.Metric)
+		if !ok {
+			continue
+		}
+
+		if _, ok := r.objects[id]; !ok {
+			r.objects[id] = make(map[int][]Vector)
+		}
+		r.objects[id][vec.Condition] = append(r.objects[id][vec.Condition], vec)
+	}
+
+	return r
+}
+
+// Matched returns true if the condition with the given index is met on the object
+func (r *ResultSet) Matched(object string, condition int) bool {
+	return len(r.objects[object][condition]) > 0
+}
+
+// AllOf returns true if every condition is met on the object
+func (r *ResultSet) AllOf(object string) bool {
+	if r.conditions == 0 {
+		return false
+	}
+
+	for i := 0; i < r.conditions; i++ {
+		if !r.Matched(object, i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AnyOf returns true if at least one condition is met on the object
+func (r *ResultSet) AnyOf(object string) bool {
+	for i := 0; i < r.conditions; i++ {
+		if r.Matched(object, i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Vectors returns the vectors of every condition met on the object
+func (r *ResultSet) Vectors(object string) []Vector {
+	vecs := make([]Vector, 0)
+	for i := 0; i < r.conditions; i++ {
+		vecs = append(vecs, r.objects[object][i]...)
+	}
+
+	return vecs
+}
+
+// Objects returns the identity of every object that met at least one condition
+func (r *ResultSet) Objects() []string {
+	objects := make([]string, 0, len(r.objects))
+	for id := range r.objects {
+		objects = append(objects, id)
+	}
+
+	return objects
+}
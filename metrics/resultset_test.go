@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"sort"
+	"testing"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func volumeVector(volume string, condition int) Vector {
+	return Vector{
+		Metric:    Metric{VolumeName: &volume},
+		Condition: condition,
+	}
+}
+
+func TestResultSet(t *testing.T) {
+	vecs := []Vector{
+		volumeVector("pv-1", 0),
+		volumeVector("pv-1", 1),
+		volumeVector("pv-2", 0),
+		volumeVector("pv-3", 1),
+		{Metric: Metric{Name: "no_volume"}},
+	}
+
+	r := NewResultSet(autopilot.PolicyObjectTypeVolume, 2, vecs)
+
+	// several objects matching used to fail the check for all of them
+	require.True(t, r.AllOf("pv-1"), "Expected all conditions to be met on pv-1")
+	require.False(t, r.AllOf("pv-2"), "Expected pv-2 to miss the second condition")
+	require.False(t, r.AllOf("pv-4"), "Expected unknown object not to match")
+
+	require.True(t, r.AnyOf("pv-2"))
+	require.True(t, r.AnyOf("pv-3"))
+	require.False(t, r.AnyOf("pv-4"))
+
+	require.Len(t, r.Vectors("pv-1"), 2)
+
+	objects := r.Objects()
+	sort.Strings(objects)
+	require.Equal(t, []string{"pv-1", "pv-2", "pv-3"}, objects)
+}
+
+func TestResultSetNoConditions(t *testing.T) {
+	r := NewResultSet(autopilot.PolicyObjectTypeVolume, 0, []Vector{volumeVector("pv-1", 0)})
+	require.False(t, r.AllOf("pv-1"), "Expected a policy without conditions never to match")
+}
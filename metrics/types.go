@@ -17,6 +17,9 @@ limitations under the License.
 package metrics
 
 import (
+	"context"
+	"time"
+
 	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
 	sparks "gitlab.com/ModelRocket/sparks/types"
 )
@@ -26,8 +29,25 @@ import (
 type (
 	// Provider defines a simple interface for metrics providers to collect and extract data
 	Provider interface {
-		// Resolve executes query based on the provided policy and returns a vector of metrics values
-		Query(*autopilot.StoragePolicy) ([]Vector, error)
+		// Resolve executes query based on the provided policy and returns a vector of metrics values.
+		// Each vector is tagged with the index of the condition it was returned for.
+		// The query is abandoned when the context is done.
+		Query(context.Context, *autopilot.StoragePolicy) ([]Vector, error)
+	}
+
+	// HealthReporter is implemented by providers that track their own health
+	HealthReporter interface {
+		// Healthy returns false while the provider is skipped
+		Healthy() bool
+		// LastSuccess returns the time of the last successful query, zero if none
+		LastSuccess() time.Time
+	}
+
+	// Trigger is implemented by providers that push metrics, such as alerts,
+	// and want the policies evaluated as soon as new metrics arrive
+	Trigger interface {
+		// Triggered fires when the policies should be evaluated
+		Triggered() <-chan struct{}
 	}
 
 	// Params is an alias for a map helper
@@ -65,6 +85,10 @@ type (
 		Value []interface{} `json:"value,omitempty"`
 		// Values is for range queries its an array of Value above
 		Values [][]interface{} `json:"values,omitempty"`
+		// Condition is the index of the policy condition the vector was returned for
+		Condition int `json:"-"`
+		// Forecast is the projected trend of the metric for forecast conditions
+		Forecast *Forecast `json:"-"`
 	}
 
 	// StoragePolicy maps the the k8s StoragePolicySpec
@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDedupWindow is the time the same notification is not sent again
+	DefaultDedupWindow = 10 * time.Minute
+
+	sendTimeout = 30 * time.Second
+	queueSize   = 100
+)
+
+// Route selects the notifications sent to a notifier
+type Route struct {
+	// Policies are the name patterns of the policies notified, such as prod-*. All policies if empty.
+	Policies []string
+	// Reasons are the event reasons notified. All the reasons of Reasons if empty.
+	Reasons []string
+	// MinSeverity is the lowest severity notified
+	MinSeverity Severity
+	// DedupWindow is the time the same notification is not sent again. Defaults to DefaultDedupWindow.
+	DedupWindow time.Duration
+}
+
+// Matches returns true if the notification is selected by the route
+func (r *Route) Matches(n *Notification) bool {
+	if n.Severity < r.MinSeverity {
+		return false
+	}
+
+	if len(r.Reasons) > 0 && !contains(r.Reasons, n.Reason) {
+		return false
+	}
+
+	if len(r.Policies) == 0 {
+		return true
+	}
+
+	for _, pattern := range r.Policies {
+		if ok, _ := path.Match(pattern, n.Policy); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type target struct {
+	name     string
+	notifier Notifier
+	route    Route
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// duplicate returns true if the same notification was sent within the dedup
+// window, and records it as sent otherwise
+func (t *target) duplicate(n *Notification) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	window := t.route.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	for key, sent := range t.sent {
+		if n.Time.Sub(sent) >= window {
+			delete(t.sent, key)
+		}
+	}
+
+	key := dedupKey(n)
+	if _, ok := t.sent[key]; ok {
+		return true
+	}
+
+	t.sent[key] = n.Time
+	return false
+}
+
+func (t *target) forget(n *Notification) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sent, dedupKey(n))
+}
+
+func dedupKey(n *Notification) string {
+	return n.Policy + "\x00" + n.Namespace + "\x00" + n.Reason + "\x00" + n.Message
+}
+
+// Dispatcher routes the notifications to the notifiers in the background
+type Dispatcher struct {
+	targets []*target
+	queue   chan *Notification
+	done    chan struct{}
+}
+
+// NewDispatcher creates a dispatcher without notifiers
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		queue: make(chan *Notification, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Add adds a notifier with its route. Notifiers must be added before Start.
+func (d *Dispatcher) Add(name string, notifier Notifier, route Route) {
+	d.targets = append(d.targets, &target{
+		name:     name,
+		notifier: notifier,
+		route:    route,
+		sent:     make(map[string]time.Time),
+	})
+}
+
+// Start sends the queued notifications until Close is called
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.done)
+		for n := range d.queue {
+			d.Dispatch(n)
+		}
+	}()
+}
+
+// Close stops the dispatcher once the queued notifications are sent
+func (d *Dispatcher) Close() {
+	close(d.queue)
+	<-d.done
+}
+
+// Notify queues the notification. It is dropped if the queue is full, so a
+// slow notifier doesn't hold up the policy evaluations.
+func (d *Dispatcher) Notify(n *Notification) {
+	if len(d.targets) == 0 {
+		return
+	}
+
+	select {
+	case d.queue <- n:
+	default:
+		logrus.Warnf("notify: queue full, dropping notification %s on policy %s", n.Reason, n.Policy)
+	}
+}
+
+// Dispatch sends the notification to the notifiers whose route selects it,
+// unless it is a duplicate
+func (d *Dispatcher) Dispatch(n *Notification) {
+	for _, t := range d.targets {
+		if !t.route.Matches(n) || t.duplicate(n) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := t.notifier.Send(ctx, n); err != nil {
+			// let the next occurrence through
+			t.forget(n)
+			logrus.Errorf("notify: failed to send notification %s on policy %s to %s: %v",
+				n.Reason, n.Policy, t.name, err)
+		}
+		cancel()
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
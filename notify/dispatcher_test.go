@@ -0,0 +1,133 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []*Notification
+	err  error
+}
+
+func (r *recordingNotifier) Send(ctx context.Context, n *Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recordingNotifier) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sent)
+}
+
+func testNotification(policy, reason, message string, at time.Time) *Notification {
+	return &Notification{
+		Policy:   policy,
+		Reason:   reason,
+		Severity: Reasons[reason],
+		Message:  message,
+		Time:     at,
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	s, err := ParseSeverity("Warning")
+	require.NoError(t, err)
+	require.Equal(t, SeverityWarning, s)
+	require.Equal(t, "warning", s.String())
+
+	_, err = ParseSeverity("critical")
+	require.Error(t, err)
+}
+
+func TestRouteMatches(t *testing.T) {
+	now := time.Now()
+	route := &Route{
+		Policies:    []string{"prod-*", "billing"},
+		MinSeverity: SeverityWarning,
+	}
+
+	require.True(t, route.Matches(testNotification("prod-db", "ActionTriggered", "m", now)))
+	require.True(t, route.Matches(testNotification("billing", "ActionFailed", "m", now)))
+	require.False(t, route.Matches(testNotification("dev-db", "ActionFailed", "m", now)), "policy not routed")
+	require.False(t, route.Matches(testNotification("prod-db", "ConditionMet", "m", now)), "severity below the minimum")
+
+	route = &Route{Reasons: []string{"ActionFailed"}}
+	require.True(t, route.Matches(testNotification("dev-db", "ActionFailed", "m", now)))
+	require.False(t, route.Matches(testNotification("dev-db", "ActionSuccessful", "m", now)), "reason not routed")
+}
+
+func TestDispatchDedup(t *testing.T) {
+	now := time.Now()
+	rec := &recordingNotifier{}
+
+	d := NewDispatcher()
+	d.Add("test", rec, Route{DedupWindow: time.Minute})
+
+	d.Dispatch(testNotification("p", "ConditionMet", "met on vol1", now))
+	d.Dispatch(testNotification("p", "ConditionMet", "met on vol1", now.Add(30*time.Second)))
+	require.Equal(t, 1, rec.count(), "duplicate within the window")
+
+	d.Dispatch(testNotification("p", "ConditionMet", "met on vol2", now.Add(30*time.Second)))
+	require.Equal(t, 2, rec.count(), "different object")
+
+	d.Dispatch(testNotification("p", "ConditionMet", "met on vol1", now.Add(2*time.Minute)))
+	require.Equal(t, 3, rec.count(), "window expired")
+}
+
+func TestDispatchRetriesFailedSend(t *testing.T) {
+	now := time.Now()
+	rec := &recordingNotifier{err: errors.New("unavailable")}
+
+	d := NewDispatcher()
+	d.Add("test", rec, Route{})
+
+	d.Dispatch(testNotification("p", "ActionFailed", "failed", now))
+	require.Equal(t, 0, rec.count())
+
+	rec.err = nil
+	d.Dispatch(testNotification("p", "ActionFailed", "failed", now.Add(time.Second)))
+	require.Equal(t, 1, rec.count(), "failed send is not deduplicated")
+}
+
+func TestDispatcherQueue(t *testing.T) {
+	rec := &recordingNotifier{}
+
+	d := NewDispatcher()
+	d.Add("test", rec, Route{})
+	d.Start()
+
+	d.Notify(testNotification("p", "ActionTriggered", "resized vol1", time.Now()))
+	d.Notify(testNotification("p", "ActionSuccessful", "resized vol1", time.Now()))
+	d.Close()
+
+	require.Equal(t, 2, rec.count())
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends the policy events to notification channels such as
+// chat webhooks and email
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+)
+
+// Severity is the importance of a notification
+type Severity int
+
+const (
+	// SeverityInfo is for the notifications that need no attention
+	SeverityInfo Severity = iota
+	// SeverityWarning is for the notifications of changes made to the cluster
+	SeverityWarning
+	// SeverityError is for the notifications of failures
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+// ParseSeverity parses a severity name
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+
+	return SeverityInfo, fmt.Errorf("notify: unknown severity %q", s)
+}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+
+	return severityNames[s]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Reasons are the severities of the policy event reasons that are notified
+var Reasons = map[string]Severity{
+	string(autopilot.StoragePolicyConditonMet):      SeverityInfo,
+	string(autopilot.StoragePolicyActionTriggered):  SeverityWarning,
+	string(autopilot.StoragePolicyActionSuccessful): SeverityInfo,
+	string(autopilot.StoragePolicyActionFailed):     SeverityError,
+}
+
+// Notification is a policy event sent to the notifiers
+type Notification struct {
+	Policy    string    `json:"policy"`
+	Namespace string    `json:"namespace,omitempty"`
+	Reason    string    `json:"reason"`
+	Severity  Severity  `json:"severity"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// Title returns a one line summary of the notification
+func (n *Notification) Title() string {
+	return fmt.Sprintf("autopilot: %s on policy %s", n.Reason, n.Policy)
+}
+
+type (
+	// Params is a type alias for the notifier params
+	Params = sparks.Params
+
+	// Notifier delivers notifications to a channel
+	Notifier interface {
+		// Send delivers the notification
+		Send(ctx context.Context, n *Notification) error
+	}
+
+	// NewFunc creates a notifier from its params
+	NewFunc func(params Params) (Notifier, error)
+)
+
+var (
+	notifierMu sync.RWMutex
+	notifiers  = make(map[string]NewFunc)
+)
+
+// Register makes a notifier available by the provided name. If Register is
+// called twice with the same name or if notifier is nil, it panics.
+func Register(name string, notifier NewFunc) {
+	name = strings.ToLower(name)
+
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	if notifier == nil {
+		panic("notify: Register notifier is nil")
+	}
+	if _, dup := notifiers[name]; dup {
+		panic("notify: Register called twice for notifier " + name)
+	}
+
+	notifiers[name] = notifier
+}
+
+// Registered returns true if a notifier is available by the provided name
+func Registered(name string) bool {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+
+	_, ok := notifiers[name]
+	return ok
+}
+
+// NewNotifier creates a new notifier
+func NewNotifier(name, params string) (Notifier, error) {
+	notifierMu.RLock()
+	newFn, ok := notifiers[name]
+	notifierMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("notify: unknown notifier %q", name)
+	}
+	return newFn(sparks.ParseStringParams(params))
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const (
+	// NotifierSMTP sends the notifications by email
+	NotifierSMTP = "smtp"
+
+	// ParamAddress is the host:port of the smtp server
+	ParamAddress = "address"
+	// ParamFrom is the sender address of the emails
+	ParamFrom = "from"
+	// ParamTo is the comma separated list of the recipient addresses
+	ParamTo = "to"
+	// ParamUsername is the username of the smtp plain auth. No auth if empty.
+	ParamUsername = "username"
+	// ParamPassword is the password of the smtp plain auth
+	ParamPassword = "password"
+)
+
+type mailer struct {
+	address string
+	from    string
+	to      []string
+	auth    smtp.Auth
+}
+
+func init() {
+	Register(NotifierSMTP, newMailer)
+}
+
+func newMailer(params Params) (Notifier, error) {
+	m := &mailer{
+		address: params.String(ParamAddress),
+		from:    params.String(ParamFrom),
+	}
+
+	for _, to := range strings.Split(params.String(ParamTo), ",") {
+		if to = strings.TrimSpace(to); len(to) > 0 {
+			m.to = append(m.to, to)
+		}
+	}
+
+	switch {
+	case len(m.address) == 0:
+		return nil, fmt.Errorf("notify: missing %s param", ParamAddress)
+	case len(m.from) == 0:
+		return nil, fmt.Errorf("notify: missing %s param", ParamFrom)
+	case len(m.to) == 0:
+		return nil, fmt.Errorf("notify: missing %s param", ParamTo)
+	}
+
+	host, _, err := net.SplitHostPort(m.address)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid %s %q: %v", ParamAddress, m.address, err)
+	}
+
+	if username := params.String(ParamUsername); len(username) > 0 {
+		m.auth = smtp.PlainAuth("", username, params.String(ParamPassword), host)
+	}
+
+	return m, nil
+}
+
+// Send implements the Notifier.Send interface method. The smtp client has no
+// context support, so the message is sent in the background and abandoned
+// when the context is done.
+func (m *mailer) Send(ctx context.Context, n *Notification) error {
+	msg := m.message(n)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(m.address, m.auth, m.from, m.to, msg)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *mailer) message(n *Notification) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&buf, "Subject: [%s] %s\r\n", n.Severity, n.Title())
+	fmt.Fprintf(&buf, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&buf, "\r\n")
+	fmt.Fprintf(&buf, "Policy: %s\r\n", n.Policy)
+	if len(n.Namespace) > 0 {
+		fmt.Fprintf(&buf, "Namespace: %s\r\n", n.Namespace)
+	}
+	fmt.Fprintf(&buf, "Event: %s\r\n", n.Reason)
+	fmt.Fprintf(&buf, "Severity: %s\r\n", n.Severity)
+	fmt.Fprintf(&buf, "\r\n%s\r\n", n.Message)
+
+	return buf.Bytes()
+}
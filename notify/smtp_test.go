@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mail is a message received by the smtp stand-in
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn is a minimal smtp server that accepts a single message per connection
+func smtpStandIn(t *testing.T) (string, <-chan *mail, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	received := make(chan *mail, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+
+	return listener.Addr().String(), received, func() { listener.Close() }
+}
+
+func serveSMTP(conn net.Conn, received chan<- *mail) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	m := &mail{}
+	reply("220 localhost stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			m.data = data.String()
+			received <- m
+			reply("250 ok")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received, stop := smtpStandIn(t)
+	defer stop()
+
+	n, err := NewNotifier(NotifierSMTP, "address="+addr+" from=autopilot@example.com to=oncall@example.com,storage@example.com")
+	require.NoError(t, err)
+
+	at := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, n.Send(context.Background(), testNotification("prod-db", "ActionTriggered", "resized vol1", at)))
+
+	m := <-received
+	require.Equal(t, "autopilot@example.com", m.from)
+	require.Equal(t, []string{"oncall@example.com", "storage@example.com"}, m.to)
+	require.Contains(t, m.data, "Subject: [warning] autopilot: ActionTriggered on policy prod-db\r\n")
+	require.Contains(t, m.data, "\r\nresized vol1\r\n")
+}
+
+func TestSMTPParams(t *testing.T) {
+	_, err := NewNotifier(NotifierSMTP, "from=a@example.com to=b@example.com")
+	require.Error(t, err, "missing address")
+
+	_, err = NewNotifier(NotifierSMTP, "address=localhost:25 to=b@example.com")
+	require.Error(t, err, "missing from")
+
+	_, err = NewNotifier(NotifierSMTP, "address=localhost:25 from=a@example.com")
+	require.Error(t, err, "missing to")
+
+	_, err = NewNotifier(NotifierSMTP, "address=localhost from=a@example.com to=b@example.com")
+	require.Error(t, err, "address without port")
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
+)
+
+const (
+	// ParamURL is the url the notifications are posted to
+	ParamURL = "url"
+
+	// NotifierWebhook posts the notifications as json documents
+	NotifierWebhook = "webhook"
+	// NotifierSlack posts the notifications to slack compatible incoming webhooks
+	NotifierSlack = "slack"
+	// NotifierTeams posts the notifications to microsoft teams incoming webhooks
+	NotifierTeams = "teams"
+)
+
+// severityColors are the colors of the teams message cards
+var severityColors = map[Severity]string{
+	SeverityInfo:    "2EB886",
+	SeverityWarning: "DAA038",
+	SeverityError:   "A30200",
+}
+
+type (
+	// slackMessage is the payload of a slack incoming webhook
+	slackMessage struct {
+		Text string `json:"text"`
+	}
+
+	// teamsMessageCard is the payload of a teams incoming webhook
+	teamsMessageCard struct {
+		Type       string `json:"@type"`
+		Context    string `json:"@context"`
+		Summary    string `json:"summary"`
+		Title      string `json:"title"`
+		Text       string `json:"text"`
+		ThemeColor string `json:"themeColor"`
+	}
+
+	webhook struct {
+		url    string
+		client *httpclient.Client
+		format func(n *Notification) interface{}
+	}
+)
+
+func init() {
+	Register(NotifierWebhook, newWebhook(func(n *Notification) interface{} {
+		return n
+	}))
+
+	Register(NotifierSlack, newWebhook(func(n *Notification) interface{} {
+		return &slackMessage{
+			Text: fmt.Sprintf("*[%s] %s*\n%s", n.Severity, n.Title(), n.Message),
+		}
+	}))
+
+	Register(NotifierTeams, newWebhook(func(n *Notification) interface{} {
+		return &teamsMessageCard{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			Summary:    n.Title(),
+			Title:      fmt.Sprintf("[%s] %s", n.Severity, n.Title()),
+			Text:       n.Message,
+			ThemeColor: severityColors[n.Severity],
+		}
+	}))
+}
+
+// newWebhook returns the constructor of a webhook notifier with the given
+// payload format. The webhooks take the auth, tls and header params of the
+// httpclient package.
+func newWebhook(format func(n *Notification) interface{}) NewFunc {
+	return func(params Params) (Notifier, error) {
+		url := params.String(ParamURL)
+		if len(url) == 0 {
+			return nil, fmt.Errorf("notify: missing %s param", ParamURL)
+		}
+
+		client, err := httpclient.New(params)
+		if err != nil {
+			return nil, fmt.Errorf("notify: %v", err)
+		}
+
+		return &webhook{
+			url:    url,
+			client: client,
+			format: format,
+		}, nil
+	}
+}
+
+// Send implements the Notifier.Send interface method
+func (w *webhook) Send(ctx context.Context, n *Notification) error {
+	data, err := json.Marshal(w.format(n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notify: webhook returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
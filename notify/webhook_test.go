@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func webhookStandIn(t *testing.T, status int) (*httptest.Server, <-chan map[string]interface{}) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+		w.WriteHeader(status)
+	}))
+
+	return server, received
+}
+
+func TestWebhook(t *testing.T) {
+	server, received := webhookStandIn(t, http.StatusOK)
+	defer server.Close()
+
+	n, err := NewNotifier(NotifierWebhook, "url="+server.URL)
+	require.NoError(t, err)
+
+	at := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, n.Send(context.Background(), testNotification("p", "ActionFailed", "resize failed", at)))
+
+	body := <-received
+	require.Equal(t, "p", body["policy"])
+	require.Equal(t, "ActionFailed", body["reason"])
+	require.Equal(t, "error", body["severity"])
+	require.Equal(t, "resize failed", body["message"])
+	require.Equal(t, "2019-05-01T10:00:00Z", body["time"])
+}
+
+func TestSlack(t *testing.T) {
+	server, received := webhookStandIn(t, http.StatusOK)
+	defer server.Close()
+
+	n, err := NewNotifier(NotifierSlack, "url="+server.URL)
+	require.NoError(t, err)
+	require.NoError(t, n.Send(context.Background(), testNotification("p", "ActionTriggered", "resized vol1", time.Now())))
+
+	body := <-received
+	require.Equal(t, "*[warning] autopilot: ActionTriggered on policy p*\nresized vol1", body["text"])
+}
+
+func TestTeams(t *testing.T) {
+	server, received := webhookStandIn(t, http.StatusOK)
+	defer server.Close()
+
+	n, err := NewNotifier(NotifierTeams, "url="+server.URL)
+	require.NoError(t, err)
+	require.NoError(t, n.Send(context.Background(), testNotification("p", "ActionFailed", "resize failed", time.Now())))
+
+	body := <-received
+	require.Equal(t, "MessageCard", body["@type"])
+	require.Equal(t, "[error] autopilot: ActionFailed on policy p", body["title"])
+	require.Equal(t, "resize failed", body["text"])
+	require.Equal(t, "A30200", body["themeColor"])
+}
+
+func TestWebhookError(t *testing.T) {
+	server, _ := webhookStandIn(t, http.StatusInternalServerError)
+	defer server.Close()
+
+	n, err := NewNotifier(NotifierWebhook, "url="+server.URL)
+	require.NoError(t, err)
+	require.Error(t, n.Send(context.Background(), testNotification("p", "ActionFailed", "m", time.Now())))
+
+	_, err = NewNotifier(NotifierWebhook, "")
+	require.Error(t, err, "missing url")
+}
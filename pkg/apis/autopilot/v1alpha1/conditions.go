@@ -0,0 +1,52 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// ConditionList returns every condition of the policy: the conditions list
+// followed by the conditions of the match group in depth-first order. Metrics
+// providers query the conditions in this order and tag their results with the
+// index of the condition in the list.
+func (s *StoragePolicySpec) ConditionList() []*LabelSelectorRequirement {
+	conditions := make([]*LabelSelectorRequirement, 0, len(s.Conditions))
+	conditions = append(conditions, s.Conditions...)
+
+	if s.Match != nil {
+		conditions = s.Match.appendConditions(conditions)
+	}
+
+	return conditions
+}
+
+func (g *ConditionGroup) appendConditions(conditions []*LabelSelectorRequirement) []*LabelSelectorRequirement {
+	if g.Condition != nil {
+		conditions = append(conditions, g.Condition)
+	}
+
+	for i := range g.AllOf {
+		conditions = g.AllOf[i].appendConditions(conditions)
+	}
+
+	for i := range g.AnyOf {
+		conditions = g.AnyOf[i].appendConditions(conditions)
+	}
+
+	if g.Not != nil {
+		conditions = g.Not.appendConditions(conditions)
+	}
+
+	return conditions
+}
@@ -48,6 +48,17 @@ const (
 	EnforcementPreferred EnforcementType = "preferred"
 )
 
+// PolicyMode defines how autopilot treats the actions of a given policy
+type PolicyMode string
+
+const (
+	// PolicyModeEnforce specifies that the policy action is run when the conditions are met
+	PolicyModeEnforce PolicyMode = "enforce"
+	// PolicyModeObserve specifies that the policy conditions are evaluated and reported but the
+	// action is never run
+	PolicyModeObserve PolicyMode = "observe"
+)
+
 const (
 	/***** Volume conditions *****/
 
@@ -70,6 +81,11 @@ const (
 
 	// PolicyActionVolumeResize is an action to resize volumes
 	PolicyActionVolumeResize = "resize"
+	// PolicyActionVolumeResizeParamMaxSize is the resize action parameter for the maximum size of a volume, such as 100Gi
+	PolicyActionVolumeResizeParamMaxSize = "maxsize"
+	// PolicyActionVolumeResizeParamHorizon is the resize action parameter for the time the volume must last
+	// after the resize, such as 168h. It applies to policies with forecast conditions.
+	PolicyActionVolumeResizeParamHorizon = "horizon"
 
 	/***** Node actions *****/
 
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ActionParams are the parameters of a policy action, such as maxsize: 100Gi
+type ActionParams map[string]string
+
+// UnmarshalJSON decodes the parameters from a map, or from the legacy list of
+// command line arguments such as [--scalefactor, 1.3]. A --name argument
+// followed by a value, or written as --name=value, becomes the param name with
+// that value, a --name argument without a value is set to true and the other
+// arguments become params without a value.
+func (p *ActionParams) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*p = nil
+		return nil
+	}
+
+	if len(data) == 0 || data[0] != '[' {
+		params := make(map[string]string)
+		if err := json.Unmarshal(data, &params); err != nil {
+			return err
+		}
+		*p = params
+		return nil
+	}
+
+	var args []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&args); err != nil {
+		return err
+	}
+
+	params := make(ActionParams)
+	name := ""
+	for _, arg := range args {
+		value := fmt.Sprint(arg)
+		if isFlag(value) {
+			if len(name) > 0 {
+				params[name] = "true"
+			}
+
+			name = strings.TrimLeft(value, "-")
+			if i := strings.Index(name, "="); i >= 0 {
+				params[name[:i]] = name[i+1:]
+				name = ""
+			}
+			continue
+		}
+
+		if len(name) > 0 {
+			params[name] = value
+			name = ""
+			continue
+		}
+
+		params[value] = ""
+	}
+
+	if len(name) > 0 {
+		params[name] = "true"
+	}
+
+	*p = params
+	return nil
+}
+
+// isFlag returns true if the argument is a --name argument and not a negative number
+func isFlag(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+
+	_, err := strconv.ParseFloat(arg, 64)
+	return err != nil
+}
@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionParams(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected ActionParams
+	}{
+		{data: `{"maxsize": "100Gi"}`, expected: ActionParams{"maxsize": "100Gi"}},
+		{data: `["--scalefactor", 1.3]`, expected: ActionParams{"scalefactor": "1.3"}},
+		{data: `["--maxsize=100Gi", "--force", "--delta", -2]`, expected: ActionParams{"maxsize": "100Gi", "force": "true", "delta": "-2"}},
+		{data: `["--dry-run"]`, expected: ActionParams{"dry-run": "true"}},
+		{data: `["fast"]`, expected: ActionParams{"fast": ""}},
+		{data: `null`, expected: nil},
+	}
+
+	for _, test := range tests {
+		var params ActionParams
+		require.NoError(t, json.Unmarshal([]byte(test.data), &params), "Failed to decode %s", test.data)
+		require.Equal(t, test.expected, params, "Unexpected params of %s", test.data)
+	}
+
+	var params ActionParams
+	require.Error(t, json.Unmarshal([]byte(`"maxsize"`), &params), "Expected a string to be rejected")
+}
+
+func TestDecodeLegacyPolicy(t *testing.T) {
+	// a policy with the action params of the previous releases
+	data := `{
+  "apiVersion": "autopilot.libopenstorage.org/v1alpha1",
+  "kind": "StoragePolicy",
+  "metadata": {"name": "volume-resize"},
+  "spec": {
+    "conditions": [{"key": "openstorage.io/condition.volume.usage_percentage", "operator": "gt", "values": ["80"]}],
+    "action": {
+      "name": "openstorage.io.action.volume/resize",
+      "params": ["--scalefactor", 1.3]
+    }
+  }
+}`
+
+	policy := &StoragePolicy{}
+	require.NoError(t, json.Unmarshal([]byte(data), policy), "Failed to decode the legacy policy")
+	require.Equal(t, "openstorage.io.action.volume/resize", policy.Spec.Action.Name)
+	require.Equal(t, ActionParams{"scalefactor": "1.3"}, policy.Spec.Action.Params)
+	require.Equal(t, policy.Spec.Action.Params, policy.DeepCopy().Spec.Action.Params)
+
+	encoded, err := json.Marshal(policy)
+	require.NoError(t, err)
+	decoded := &StoragePolicy{}
+	require.NoError(t, json.Unmarshal(encoded, decoded), "Failed to decode the policy again")
+	require.Equal(t, policy.Spec.Action.Params, decoded.Spec.Action.Params)
+}
@@ -33,6 +33,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&StoragePolicy{},
 		&StoragePolicyList{},
+		&AutopilotConfig{},
+		&AutopilotConfigList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
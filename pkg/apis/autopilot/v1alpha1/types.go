@@ -14,6 +14,16 @@ const (
 	// StoragePolicyResourcePlural is the name of the plural StoragePolicy objects
 	StoragePolicyResourcePlural = "storagepolicies"
 
+	// AutopilotConfigResourceName is the name of the singular AutopilotConfig objects
+	AutopilotConfigResourceName = "autopilotconfig"
+
+	// AutopilotConfigResourcePlural is the name of the plural AutopilotConfig objects
+	AutopilotConfigResourcePlural = "autopilotconfigs"
+
+	// AutopilotConfigName is the name of the AutopilotConfig object used by autopilot. The
+	// other AutopilotConfig objects are ignored.
+	AutopilotConfigName = "default"
+
 	// LabelSelectorOpIn is operator where the key must have one of the values
 	LabelSelectorOpIn LabelSelectorOperator = "In"
 	// LabelSelectorOpNotIn is operator where the key must not have any of the values
@@ -44,6 +54,82 @@ type LabelSelectorRequirement struct {
 	// merge patch.
 	// +optional
 	Values []string `json:"values"`
+	// aggregation reduces the series of the key over a lookback window to a single value
+	// before it is compared with the values. If empty, the current value of the key is used.
+	// +optional
+	Aggregation *ConditionAggregation `json:"aggregation,omitempty"`
+	// provider is the name of the metrics provider that evaluates the condition. Defaults to the
+	// provider of the policy.
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// forecast projects the series of the key forward in time. The values of the condition
+	// are then durations, such as 24h, compared with the time left until the key reaches the
+	// forecast limit.
+	// +optional
+	Forecast *ConditionForecast `json:"forecast,omitempty"`
+}
+
+// ForecastMethod is the method used to project a series forward in time
+type ForecastMethod string
+
+const (
+	// ForecastLinearRegression fits a line to the series of the key locally
+	ForecastLinearRegression ForecastMethod = "regression"
+	// ForecastPredictLinear uses the predict_linear function of the metrics provider
+	ForecastPredictLinear ForecastMethod = "predict_linear"
+)
+
+// ConditionForecast defines how the time left until a condition key reaches a limit is projected
+type ConditionForecast struct {
+	// Method is the forecast method. Can take values: regression or predict_linear.
+	// Defaults to regression.
+	// +optional
+	Method ForecastMethod `json:"method,omitempty"`
+	// Window is the history of the series the trend is fitted to, such as 6h
+	Window string `json:"window"`
+	// Step is the resolution of the series, such as 5m. Defaults to a sixtieth of the window.
+	// +optional
+	Step string `json:"step,omitempty"`
+	// Limit is the value at which the key is considered full. Defaults to 100.
+	// +optional
+	Limit float64 `json:"limit,omitempty"`
+}
+
+// AggregationFunction is the function used to reduce a series to a single value
+type AggregationFunction string
+
+const (
+	// AggregationAvg is the average of the series
+	AggregationAvg AggregationFunction = "avg"
+	// AggregationMin is the minimum of the series
+	AggregationMin AggregationFunction = "min"
+	// AggregationMax is the maximum of the series
+	AggregationMax AggregationFunction = "max"
+	// AggregationSum is the sum of the series
+	AggregationSum AggregationFunction = "sum"
+	// AggregationLast is the last value of the series
+	AggregationLast AggregationFunction = "last"
+	// AggregationPercentile is the percentile of the series given by the aggregation percentile
+	AggregationPercentile AggregationFunction = "percentile"
+	// AggregationDelta is the difference between the last and first value of the series
+	AggregationDelta AggregationFunction = "delta"
+	// AggregationRate is the per-second rate of change between the first and last value of the series
+	AggregationRate AggregationFunction = "rate"
+)
+
+// ConditionAggregation defines how a condition key is reduced over a lookback window
+type ConditionAggregation struct {
+	// Function is the function that reduces the series. Can take values: avg, min, max, sum, last,
+	// percentile, delta or rate.
+	Function AggregationFunction `json:"function"`
+	// Window is the lookback window of the series, such as 10m
+	Window string `json:"window"`
+	// Step is the resolution of the series, such as 30s. Defaults to a sixtieth of the window.
+	// +optional
+	Step string `json:"step,omitempty"`
+	// Percentile is the percentile between 0 and 100 for the percentile function
+	// +optional
+	Percentile float64 `json:"percentile,omitempty"`
 }
 
 // +genclient
@@ -54,9 +140,8 @@ type LabelSelectorRequirement struct {
 type StoragePolicy struct {
 	meta.TypeMeta   `json:",inline"`
 	meta.ObjectMeta `json:"metadata,omitempty"`
-	Spec            StoragePolicySpec `json:"spec"`
-	// TODO: add status
-	//Status          StoragePolicyStatus `json:"status,omitempty"`
+	Spec            StoragePolicySpec   `json:"spec"`
+	Status          StoragePolicyStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -76,14 +161,103 @@ type StoragePolicySpec struct {
 	// (optional)
 	Weight int64 `json:"weight,omitempty"`
 	// Enforcement specifies the enforcement type for policy. Can take values: required or preferred.
+	// A preferred policy is skipped when a conflicting required policy is active on the same object.
+	// Defaults to required.
 	// (optional)
 	Enforcement EnforcementType `json:"enforcement,omitempty"`
+	// Mode specifies if the policy action is run or only observed. Can take values: enforce or observe.
+	// Defaults to enforce. A policy with any other mode is skipped.
+	// (optional)
+	Mode PolicyMode `json:"mode,omitempty"`
+	// Provider is the name of the metrics provider that evaluates the conditions that don't name
+	// one. Defaults to the first provider of the configuration.
+	// (optional)
+	Provider string `json:"provider,omitempty"`
 	// Object is the entity on which to check the conditions
 	Object PolicyObject `json:"object"`
-	// Conditions are the conditions to check on the policy objects
+	// Conditions are the conditions to check on the policy objects. All of them must be met.
 	Conditions []*LabelSelectorRequirement `json:"conditions"`
+	// Match is a group of conditions combined with allOf, anyOf and not. It must be met along with
+	// the conditions above.
+	// (optional)
+	Match *ConditionGroup `json:"match,omitempty"`
 	// Action is the action to run for the policy when the conditions are met
 	Action PolicyAction `json:"action"`
+	// Schedule restricts the times at which the policy action is allowed to run. Conditions are
+	// still evaluated outside of the allowed times and the actions are deferred until the schedule allows them.
+	// (optional)
+	Schedule *PolicySchedule `json:"schedule,omitempty"`
+}
+
+// ConditionGroup is a boolean expression of conditions. Exactly one of its fields must be set.
+type ConditionGroup struct {
+	// Condition is a single condition
+	// (optional)
+	Condition *LabelSelectorRequirement `json:"condition,omitempty"`
+	// AllOf is met when all of the groups are met
+	// (optional)
+	AllOf []ConditionGroup `json:"allOf,omitempty"`
+	// AnyOf is met when at least one of the groups is met
+	// (optional)
+	AnyOf []ConditionGroup `json:"anyOf,omitempty"`
+	// Not is met when the group is not met
+	// (optional)
+	Not *ConditionGroup `json:"not,omitempty"`
+}
+
+// PolicySchedule defines the time windows in which the policy action can run
+type PolicySchedule struct {
+	// TimeZone is the IANA name of the time zone for the windows, such as America/Los_Angeles. Defaults to UTC.
+	// (optional)
+	TimeZone string `json:"timeZone,omitempty"`
+	// Allowed are the windows in which the action is allowed to run. If empty, the action can run at any time
+	// outside of the blocked windows.
+	// (optional)
+	Allowed []TimeWindow `json:"allowed,omitempty"`
+	// Blocked are the windows in which the action must not run. Blocked windows take precedence over allowed ones.
+	// (optional)
+	Blocked []TimeWindow `json:"blocked,omitempty"`
+}
+
+// TimeWindow is a recurring weekly window of time
+type TimeWindow struct {
+	// Days are the days of the week on which the window starts, such as Mon or Saturday. If empty, the window
+	// starts on every day.
+	// (optional)
+	Days []string `json:"days,omitempty"`
+	// Start is the time of the day at which the window opens in HH:MM format
+	Start string `json:"start"`
+	// End is the time of the day at which the window closes in HH:MM format. A window that ends before it starts
+	// spans midnight.
+	End string `json:"end"`
+}
+
+// StoragePolicyStatus is the status of a storage policy
+type StoragePolicyStatus struct {
+	// PendingActions are the actions waiting for the policy schedule to allow them to run
+	PendingActions []PendingAction `json:"pendingActions,omitempty"`
+	// MatchedObjects are the objects whose conditions were met on the last evaluation of the policy
+	MatchedObjects []ObjectEvaluation `json:"matchedObjects,omitempty"`
+}
+
+// ObjectEvaluation is the evaluation of the policy conditions on an object
+type ObjectEvaluation struct {
+	// Object is the object the conditions were evaluated on
+	Object string `json:"object"`
+	// Evaluation is the evaluation tree of the conditions
+	Evaluation string `json:"evaluation"`
+}
+
+// PendingAction is a policy action deferred until the policy schedule allows it to run
+type PendingAction struct {
+	// Object is the object the action runs on
+	Object string `json:"object"`
+	// Action is the name of the deferred action
+	Action string `json:"action"`
+	// QueuedAt is the time at which the action was deferred
+	QueuedAt meta.Time `json:"queuedAt"`
+	// NotBefore is the earliest time at which the schedule allows the action to run
+	NotBefore *meta.Time `json:"notBefore,omitempty"`
 }
 
 // PolicyObject defines an object for the policy
@@ -98,8 +272,30 @@ type PolicyObject struct {
 type PolicyAction struct {
 	// Name is the name of the policy
 	Name string `json:"name"`
+	// Params are the parameters for the action, such as maxsize: 100Gi. The legacy list of
+	// arguments, such as [--scalefactor, 1.3], is still accepted.
+	// (optional)
+	Params ActionParams `json:"params,omitempty"`
 	// ActionObject is the target object for the policy (optional)
 	ActionObject PolicyObject `json:"actionObject,omitempty"`
+	// Verification defines how autopilot checks that the action took effect (optional)
+	Verification *ActionVerification `json:"verification,omitempty"`
+}
+
+// ActionVerification defines how autopilot checks that an action took effect
+type ActionVerification struct {
+	// Timeout is how long to wait for the action to take effect, such as 10m. Defaults to 5m.
+	// (optional)
+	Timeout string `json:"timeout,omitempty"`
+	// ConditionsCleared requires the policy conditions to no longer be met on the object
+	// for the action to be successful
+	// (optional)
+	ConditionsCleared bool `json:"conditionsCleared,omitempty"`
+	// Rollback undoes the action if it did not take effect within the timeout. Rolling back
+	// a volume resize shrinks the PVC, which Kubernetes only accepts with the
+	// RecoverVolumeExpansionFailure feature gate enabled.
+	// (optional)
+	Rollback bool `json:"rollback,omitempty"`
 }
 
 // StoragePolicyStatusType is the type for policy statuses
@@ -114,4 +310,185 @@ const (
 	StoragePolicyActionTriggered StoragePolicyStatusType = "ActionTriggered"
 	// StoragePolicyActionSuccessful is when an action for a policy is successful
 	StoragePolicyActionSuccessful StoragePolicyStatusType = "ActionSuccessful"
+	// StoragePolicyActionDryRun is when an action for a policy would have triggered but was not run
+	// since the policy is in observe mode or autopilot is running in dry-run mode
+	StoragePolicyActionDryRun StoragePolicyStatusType = "ActionDryRun"
+	// StoragePolicyActionSkipped is when an action for a policy was not run since another policy
+	// took precedence on the same object
+	StoragePolicyActionSkipped StoragePolicyStatusType = "ActionSkipped"
+	// StoragePolicyConflictResolved is when a policy was selected over other conflicting policies
+	StoragePolicyConflictResolved StoragePolicyStatusType = "ConflictResolved"
+	// StoragePolicyActionDeferred is when an action for a policy is queued until the policy schedule allows it
+	StoragePolicyActionDeferred StoragePolicyStatusType = "ActionDeferred"
+	// StoragePolicyActionExpired is when a deferred action is dropped since the policy conditions are no longer met
+	StoragePolicyActionExpired StoragePolicyStatusType = "ActionExpired"
+	// StoragePolicyActionRolledBack is when an action that failed verification has been undone
+	StoragePolicyActionRolledBack StoragePolicyStatusType = "ActionRolledBack"
+	// StoragePolicyResizeNotAllowed is when a volume can't be resized since its storage class doesn't allow expansion
+	StoragePolicyResizeNotAllowed StoragePolicyStatusType = "ResizeNotAllowed"
+	// StoragePolicyResizeQuotaExceeded is when a volume resize would exceed the storage quota of the namespace
+	StoragePolicyResizeQuotaExceeded StoragePolicyStatusType = "ResizeQuotaExceeded"
+	// StoragePolicyResizeMaxSizeReached is when a volume has already reached the maximum size allowed by the policy
+	StoragePolicyResizeMaxSizeReached StoragePolicyStatusType = "ResizeMaxSizeReached"
+	// StoragePolicyResizeInsufficientCapacity is when the storage pools backing a volume don't have enough free
+	// capacity for the resize
+	StoragePolicyResizeInsufficientCapacity StoragePolicyStatusType = "ResizeInsufficientCapacity"
+	// StoragePolicyProviderUnhealthy is when a metrics provider is skipped after too many failed queries
+	StoragePolicyProviderUnhealthy StoragePolicyStatusType = "ProviderUnhealthy"
+	// StoragePolicyProviderHealthy is when an unhealthy metrics provider has recovered
+	StoragePolicyProviderHealthy StoragePolicyStatusType = "ProviderHealthy"
+	// StoragePolicyConfigReloaded is when a changed autopilot configuration has been swapped in
+	StoragePolicyConfigReloaded StoragePolicyStatusType = "ConfigReloaded"
+	// StoragePolicyConfigInvalid is when a changed autopilot configuration was rejected and the
+	// previous one is kept
+	StoragePolicyConfigInvalid StoragePolicyStatusType = "ConfigInvalid"
+	// StoragePolicyInvalid is when a policy is skipped since its spec can't be enforced, such as
+	// an unknown mode
+	StoragePolicyInvalid StoragePolicyStatusType = "PolicyInvalid"
 )
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AutopilotConfig holds the global autopilot settings. When the object named
+// default exists, it takes precedence over the configuration file.
+type AutopilotConfig struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+	Spec            AutopilotConfigSpec   `json:"spec"`
+	Status          AutopilotConfigStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AutopilotConfigList is a list of AutopilotConfig objects in Kubernetes
+type AutopilotConfigList struct {
+	meta.TypeMeta `json:",inline"`
+	meta.ListMeta `json:"metadata,omitempty"`
+
+	Items []AutopilotConfig `json:"items"`
+}
+
+// AutopilotConfigSpec is the spec of the autopilot settings
+type AutopilotConfigSpec struct {
+	// Providers are the metrics providers the policy conditions are evaluated on
+	Providers []ProviderSpec `json:"providers"`
+	// PollRate is how often the providers are polled, such as 30s. Defaults to 10s.
+	// (optional)
+	PollRate string `json:"pollRate,omitempty"`
+	// DefaultCooldown is the time an object is left alone after a policy action, such as 4m.
+	// Defaults to 4m.
+	// (optional)
+	DefaultCooldown string `json:"defaultCooldown,omitempty"`
+	// DryRun only reports the actions that would run on all the policies
+	// (optional)
+	DryRun bool `json:"dryRun,omitempty"`
+	// StorageEndpoint is the openstorage SDK endpoint used to check the storage pool capacity
+	// before resizing volumes
+	// (optional)
+	StorageEndpoint string `json:"storageEndpoint,omitempty"`
+	// StorageTLS are the TLS params of the storage endpoint in the format of the provider params,
+	// such as tls=true ca_file=/etc/autopilot/ca.pem. The endpoint is not secured if empty.
+	// (optional)
+	StorageTLS string `json:"storageTLS,omitempty"`
+	// Concurrency limits the number of policy actions in flight
+	// (optional)
+	Concurrency *ConcurrencyLimits `json:"concurrency,omitempty"`
+	// Notifiers send the policy events to notification channels
+	// (optional)
+	Notifiers []NotifierSpec `json:"notifiers,omitempty"`
+}
+
+// NotifierSpec is a notification channel of the policy events
+type NotifierSpec struct {
+	// Name is the name of the notifier
+	Name string `json:"name"`
+	// Type is the type of notifier, slack, teams, webhook or smtp
+	Type string `json:"type"`
+	// Params are the key=value params of the notifier
+	// (optional)
+	Params string `json:"params,omitempty"`
+	// Policies are the name patterns of the policies notified, such as prod-*. All policies if empty.
+	// (optional)
+	Policies []string `json:"policies,omitempty"`
+	// Events are the event reasons notified: ConditionMet, ActionTriggered, ActionSuccessful and
+	// ActionFailed. All of them if empty.
+	// (optional)
+	Events []string `json:"events,omitempty"`
+	// Severity is the lowest severity notified, info, warning or error. Defaults to info.
+	// (optional)
+	Severity string `json:"severity,omitempty"`
+	// DedupWindow is the time the same notification is not sent again. Defaults to 10m.
+	// (optional)
+	DedupWindow string `json:"dedupWindow,omitempty"`
+}
+
+// ProviderSpec is a metrics provider of the autopilot settings
+type ProviderSpec struct {
+	// Name is the name the policies refer to the provider with
+	Name string `json:"name"`
+	// Type is the type of provider, such as prometheus
+	Type string `json:"type"`
+	// Params are the key=value params of the provider
+	// (optional)
+	Params string `json:"params,omitempty"`
+	// SecretRef names a secret whose keys are added to the params
+	// (optional)
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+	// Timeout is the timeout of a query, such as 30s
+	// (optional)
+	Timeout string `json:"timeout,omitempty"`
+	// Retries is the number of times a failed query is retried
+	// (optional)
+	Retries *int `json:"retries,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubled on every retry
+	// (optional)
+	RetryBackoff string `json:"retryBackoff,omitempty"`
+	// FailureThreshold is the number of failed queries in a row after which the provider is
+	// skipped for ResetTimeout
+	// (optional)
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// ResetTimeout is how long an unhealthy provider is skipped
+	// (optional)
+	ResetTimeout string `json:"resetTimeout,omitempty"`
+}
+
+// SecretReference names a secret
+type SecretReference struct {
+	// Name is the name of the secret
+	Name string `json:"name"`
+	// Namespace is the namespace of the secret. Defaults to the namespace of autopilot.
+	// (optional)
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConcurrencyLimits limit the number of policy actions in flight. An action is
+// in flight until its verification completes. Zero means no limit.
+type ConcurrencyLimits struct {
+	// MaxActions is the maximum number of actions in flight across all the policies
+	// (optional)
+	MaxActions int `json:"maxActions,omitempty"`
+	// MaxActionsPerPolicy is the maximum number of actions in flight for a single policy
+	// (optional)
+	MaxActionsPerPolicy int `json:"maxActionsPerPolicy,omitempty"`
+}
+
+// AutopilotConfigStatus is the status of the autopilot settings
+type AutopilotConfigStatus struct {
+	// Error is the reason the spec was rejected. The previous settings are kept until the spec
+	// is fixed.
+	Error string `json:"error,omitempty"`
+	// Providers is the health of the metrics providers
+	Providers []ProviderStatus `json:"providers,omitempty"`
+}
+
+// ProviderStatus is the health of a metrics provider
+type ProviderStatus struct {
+	// Name is the name of the provider
+	Name string `json:"name"`
+	// Healthy is false while the provider is skipped after too many failed queries
+	Healthy bool `json:"healthy"`
+	// LastTransitionTime is the last time the health of the provider changed
+	LastTransitionTime meta.Time `json:"lastTransitionTime,omitempty"`
+}
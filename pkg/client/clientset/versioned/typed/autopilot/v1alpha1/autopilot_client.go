@@ -27,6 +27,7 @@ import (
 
 type AutopilotV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	AutopilotConfigsGetter
 	StoragePoliciesGetter
 }
 
@@ -35,6 +36,10 @@ type AutopilotV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *AutopilotV1alpha1Client) AutopilotConfigs() AutopilotConfigInterface {
+	return newAutopilotConfigs(c)
+}
+
 func (c *AutopilotV1alpha1Client) StoragePolicies() StoragePolicyInterface {
 	return newStoragePolicies(c)
 }
@@ -28,6 +28,10 @@ type FakeAutopilotV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeAutopilotV1alpha1) AutopilotConfigs() v1alpha1.AutopilotConfigInterface {
+	return &FakeAutopilotConfigs{c}
+}
+
 func (c *FakeAutopilotV1alpha1) StoragePolicies() v1alpha1.StoragePolicyInterface {
 	return &FakeStoragePolicies{c}
 }
@@ -112,7 +112,7 @@ func (c *FakeStoragePolicies) DeleteCollection(options *v1.DeleteOptions, listOp
 // Patch applies the patch and returns the patched storagePolicy.
 func (c *FakeStoragePolicies) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.StoragePolicy, err error) {
 	obj, err := c.Fake.
-		Invokes(testing.NewRootPatchSubresourceAction(storagepoliciesResource, name, pt, data, subresources...), &v1alpha1.StoragePolicy{})
+		Invokes(testing.NewRootPatchSubresourceAction(storagepoliciesResource, name, data, subresources...), &v1alpha1.StoragePolicy{})
 	if obj == nil {
 		return nil, err
 	}
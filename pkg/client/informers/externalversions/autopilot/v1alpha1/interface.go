@@ -24,6 +24,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// AutopilotConfigs returns a AutopilotConfigInformer.
+	AutopilotConfigs() AutopilotConfigInformer
 	// StoragePolicies returns a StoragePolicyInformer.
 	StoragePolicies() StoragePolicyInformer
 }
@@ -39,6 +41,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// AutopilotConfigs returns a AutopilotConfigInformer.
+func (v *version) AutopilotConfigs() AutopilotConfigInformer {
+	return &autopilotConfigInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // StoragePolicies returns a StoragePolicyInformer.
 func (v *version) StoragePolicies() StoragePolicyInformer {
 	return &storagePolicyInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -53,6 +53,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=autopilot.libopenstorage.org, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("autopilotconfigs"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Autopilot().V1alpha1().AutopilotConfigs().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("storagepolicies"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Autopilot().V1alpha1().StoragePolicies().Informer()}, nil
 
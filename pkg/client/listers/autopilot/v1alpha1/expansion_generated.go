@@ -18,6 +18,10 @@ limitations under the License.
 
 package v1alpha1
 
+// AutopilotConfigListerExpansion allows custom methods to be added to
+// AutopilotConfigLister.
+type AutopilotConfigListerExpansion interface{}
+
 // StoragePolicyListerExpansion allows custom methods to be added to
 // StoragePolicyLister.
 type StoragePolicyListerExpansion interface{}
@@ -1,20 +1,69 @@
 package log
 
 import (
+	"sync"
+
 	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
 	"github.com/sirupsen/logrus"
 )
 
+// TraceIDField is the log field of the trace ID of the storage policy
+const TraceIDField = "TraceID"
+
+var (
+	traceLock sync.Mutex
+	traceIDs  = make(map[string]string)
+)
+
 // StoragePolicyLog Format a log message with storage pilicy information
 func StoragePolicyLog(policy *autopilot.StoragePolicy) *logrus.Entry {
+	return StoragePolicyTraceLog(policy, StoragePolicyTraceID(policy))
+}
+
+// StoragePolicyTraceLog is like StoragePolicyLog, with the given trace ID
+// rather than the one of the current evaluation of the storage policy. It is
+// used by the work of an earlier evaluation, such as an action verification.
+func StoragePolicyTraceLog(policy *autopilot.StoragePolicy, traceID string) *logrus.Entry {
 	if policy != nil {
 		fields := logrus.Fields{
 			"Name":      policy.Name,
 			"Namespace": policy.Namespace,
 		}
+		if len(traceID) > 0 {
+			fields[TraceIDField] = traceID
+		}
 		return logrus.WithFields(fields)
 	}
 	return logrus.WithFields(logrus.Fields{
 		"StoragePolicy": policy,
 	})
 }
+
+// SetStoragePolicyTraceID sets the trace ID of the current evaluation of the
+// storage policy, an empty trace ID clears it
+func SetStoragePolicyTraceID(policy *autopilot.StoragePolicy, traceID string) {
+	traceLock.Lock()
+	defer traceLock.Unlock()
+
+	if len(traceID) == 0 {
+		delete(traceIDs, policyKey(policy))
+		return
+	}
+	traceIDs[policyKey(policy)] = traceID
+}
+
+// StoragePolicyTraceID returns the trace ID of the current evaluation of the
+// storage policy, empty if it is not traced
+func StoragePolicyTraceID(policy *autopilot.StoragePolicy) string {
+	if policy == nil {
+		return ""
+	}
+
+	traceLock.Lock()
+	defer traceLock.Unlock()
+	return traceIDs[policyKey(policy)]
+}
+
+func policyKey(policy *autopilot.StoragePolicy) string {
+	return policy.Namespace + "/" + policy.Name
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstorage
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/libopenstorage/autopilot/metrics/httpclient"
+	"github.com/libopenstorage/openstorage/api"
+	sparks "gitlab.com/ModelRocket/sparks/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ParamTLS connects to the SDK endpoint over TLS
+const ParamTLS = "tls"
+
+// TLSConfig returns the TLS configuration of the SDK endpoint from the tls
+// param and the TLS params of the http providers, such as ca_file. It returns
+// nil if none of them is set, the endpoint is then not secured.
+func TLSConfig(params sparks.Params) (*tls.Config, error) {
+	secured := params.Bool(ParamTLS)
+	for _, key := range []string{
+		httpclient.ParamCAFile,
+		httpclient.ParamCertFile,
+		httpclient.ParamKeyFile,
+		httpclient.ParamInsecureSkipVerify,
+	} {
+		if _, ok := params[key]; ok {
+			secured = true
+		}
+	}
+
+	if !secured {
+		return nil, nil
+	}
+
+	return httpclient.NewTLSConfig(params)
+}
+
+// Dial connects to the openstorage SDK endpoint over TLS with the given
+// configuration, or in plain text if it is nil
+func Dial(endpoint string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	if tlsConfig == nil {
+		return grpc.Dial(endpoint, grpc.WithInsecure())
+	}
+
+	return grpc.Dial(endpoint, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+}
+
+// FreePoolCapacity returns the free capacity in bytes available to grow the
+// given volume. A volume can only grow as much as the fullest of its replica
+// nodes allows, and on every replica node the pool with the most free space
+// is assumed to back the volume.
+func FreePoolCapacity(ctx context.Context, conn *grpc.ClientConn, volumeID string) (uint64, error) {
+	volumes := api.NewOpenStorageVolumeClient(conn)
+	nodes := api.NewOpenStorageNodeClient(conn)
+
+	resp, err := volumes.Inspect(ctx, &api.SdkVolumeInspectRequest{VolumeId: volumeID})
+	if err != nil {
+		return 0, err
+	}
+
+	replicaNodes := make(map[string]bool)
+	for _, rs := range resp.GetVolume().GetReplicaSets() {
+		for _, node := range rs.GetNodes() {
+			replicaNodes[node] = true
+		}
+	}
+
+	if len(replicaNodes) == 0 {
+		return 0, fmt.Errorf("volume %s has no replicas", volumeID)
+	}
+
+	var free uint64
+	first := true
+	for nodeID := range replicaNodes {
+		nodeResp, err := nodes.Inspect(ctx, &api.SdkNodeInspectRequest{NodeId: nodeID})
+		if err != nil {
+			return 0, err
+		}
+
+		var nodeFree uint64
+		for _, pool := range nodeResp.GetNode().GetPools() {
+			if pool.GetTotalSize() > pool.GetUsed() && pool.GetTotalSize()-pool.GetUsed() > nodeFree {
+				nodeFree = pool.GetTotalSize() - pool.GetUsed()
+			}
+		}
+
+		if first || nodeFree < free {
+			free = nodeFree
+			first = false
+		}
+	}
+
+	return free, nil
+}
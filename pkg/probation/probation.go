@@ -17,6 +17,9 @@ type Probation interface {
 	Add(clientID string, clientData interface{}, updateIfExists bool) error
 	// Remove removes a client from the probation list.
 	Remove(clientID string) error
+	// SetTimeout changes the probation timeout of the clients added from now on.
+	// Clients already in the probation list keep their timeout.
+	SetTimeout(probationTimeout time.Duration)
 	// Start starts monitoring the probationList with the configured
 	// probationTimeout
 	Start() error
@@ -86,6 +89,12 @@ func (p *probation) Add(clientID string, clientData interface{}, updateIfExists
 	return nil
 }
 
+func (p *probation) SetTimeout(probationTimeout time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.probationTimeout = probationTimeout
+}
+
 func (p *probation) Remove(clientID string) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
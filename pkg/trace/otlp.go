@@ -0,0 +1,265 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tracesPath is the path of the OTLP/HTTP traces api
+	tracesPath = "/v1/traces"
+	// exportTimeout is the timeout of an export request
+	exportTimeout = 10 * time.Second
+
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// otlpExporter exports the spans as OTLP/HTTP JSON requests
+type otlpExporter struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	resource []keyValue
+}
+
+// the OTLP JSON encoding of the ExportTraceServiceRequest, with hex encoded
+// trace and span IDs and the 64 bit integers as strings
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+
+	otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+
+	status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// newOTLPExporter creates an exporter to the OTLP/HTTP endpoint. The traces
+// path is added to the endpoint unless it is already there.
+func newOTLPExporter(endpoint string, headers map[string]string, serviceName, serviceVersion string) (*otlpExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("trace: invalid endpoint %q: %v", endpoint, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("trace: invalid endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	if !strings.HasSuffix(u.Path, tracesPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + tracesPath
+	}
+
+	e := &otlpExporter{
+		url:     u.String(),
+		headers: headers,
+		client:  &http.Client{Timeout: exportTimeout},
+		resource: []keyValue{
+			attributeValue(Attr("service.name", serviceName)),
+		},
+	}
+
+	if len(serviceVersion) > 0 {
+		e.resource = append(e.resource, attributeValue(Attr("service.version", serviceVersion)))
+	}
+
+	return e, nil
+}
+
+func (e *otlpExporter) export(spans []*Span) error {
+	req := exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{Attributes: e.resource},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/libopenstorage/autopilot"},
+				Spans: encodeSpans(spans),
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", e.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func encodeSpans(spans []*Span) []otlpSpan {
+	rval := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            status{Code: statusCodeOK},
+		}
+
+		if s.parentID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		for _, attr := range s.attrs {
+			span.Attributes = append(span.Attributes, attributeValue(attr))
+		}
+
+		if len(s.err) > 0 {
+			span.Status = status{Code: statusCodeError, Message: s.err}
+		}
+		s.mu.Unlock()
+
+		rval = append(rval, span)
+	}
+
+	return rval
+}
+
+func attributeValue(attr Attribute) keyValue {
+	kv := keyValue{Key: attr.Key}
+	switch v := attr.Value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int:
+		i := strconv.Itoa(v)
+		kv.Value.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &i
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+
+	return kv
+}
+
+// ParseHeaders parses the headers of the exports in the
+// OTEL_EXPORTER_OTLP_HEADERS format, such as api-key=secret,tenant=storage
+func ParseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, fmt.Errorf("trace: invalid header %q, expected key=value", pair)
+		}
+
+		key, err := url.PathUnescape(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, fmt.Errorf("trace: invalid header %q: %v", pair, err)
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("trace: invalid header %q: %v", pair, err)
+		}
+
+		headers[key] = value
+	}
+
+	return headers, nil
+}
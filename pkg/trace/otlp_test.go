@@ -0,0 +1,98 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPExport(t *testing.T) {
+	requests := make(chan *exportRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("api-key") != "secret" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		req := &exportRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		requests <- req
+	}))
+	defer server.Close()
+
+	require.NoError(t, Init(server.URL, map[string]string{"api-key": "secret"}, "autopilot", "1.0.0"))
+
+	root := Start("poll.cycle")
+	child := root.Start("action.execute", Attr("policy.name", "prod-db"), Attr("dry_run", false))
+	child.RecordError(errors.New("resize failed"))
+	child.End()
+	root.End()
+	Shutdown()
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+	require.Equal(t, "service.name", req.ResourceSpans[0].Resource.Attributes[0].Key)
+	require.Equal(t, "autopilot", *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "action.execute", spans[0].Name)
+	require.Equal(t, root.TraceID(), spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, statusCodeError, spans[0].Status.Code)
+	require.Equal(t, "resize failed", spans[0].Status.Message)
+	require.Equal(t, "prod-db", *spans[0].Attributes[0].Value.StringValue)
+	require.False(t, *spans[0].Attributes[1].Value.BoolValue)
+
+	require.Equal(t, "poll.cycle", spans[1].Name)
+	require.Empty(t, spans[1].ParentSpanID)
+	require.Equal(t, statusCodeOK, spans[1].Status.Code)
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	e, err := newOTLPExporter("http://collector:4318", nil, "autopilot", "")
+	require.NoError(t, err)
+	require.Equal(t, "http://collector:4318/v1/traces", e.url)
+
+	e, err = newOTLPExporter("https://collector/otlp/v1/traces", nil, "autopilot", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://collector/otlp/v1/traces", e.url)
+
+	_, err = newOTLPExporter("collector:4318", nil, "autopilot", "")
+	require.Error(t, err)
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("api-key=secret, Authorization=Bearer%20token,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"api-key": "secret", "Authorization": "Bearer token"}, headers)
+
+	_, err = ParseHeaders("api-key")
+	require.Error(t, err)
+}
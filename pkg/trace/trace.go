@@ -0,0 +1,296 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package trace records the spans of the poll cycles, policy evaluations and
+// policy actions of autopilot and exports them to an OpenTelemetry collector
+// over OTLP. Tracing is disabled until Init is called with an endpoint, the
+// spans are then nil and every method of a nil span does nothing.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSize is the number of spans exported at once
+	batchSize = 512
+	// batchTimeout is how long ended spans wait before they are exported
+	batchTimeout = 5 * time.Second
+	// queueSize is the number of ended spans waiting for the export, further
+	// spans are dropped
+	queueSize = 2048
+)
+
+// Attribute is a key value attribute of a span. The value is a string, a
+// bool, an integer or a float.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an attribute
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a timed operation of a trace
+type Span struct {
+	b *batcher
+
+	name     string
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []Attribute
+	err   string
+	ended bool
+}
+
+// exporter sends the ended spans to the tracing backend
+type exporter interface {
+	export(spans []*Span) error
+}
+
+var (
+	lock    sync.RWMutex
+	current *batcher
+)
+
+// Start starts the root span of a new trace. It returns nil if tracing is
+// disabled.
+func Start(name string, attrs ...Attribute) *Span {
+	lock.RLock()
+	b := current
+	lock.RUnlock()
+
+	if b == nil {
+		return nil
+	}
+
+	s := newSpan(b, name, attrs)
+	rand.Read(s.traceID[:])
+	return s
+}
+
+// Start starts a child span of the span
+func (s *Span) Start(name string, attrs ...Attribute) *Span {
+	if s == nil {
+		return nil
+	}
+
+	child := newSpan(s.b, name, attrs)
+	child.traceID = s.traceID
+	child.parentID = s.spanID
+	return child
+}
+
+func newSpan(b *batcher, name string, attrs []Attribute) *Span {
+	s := &Span{
+		b:     b,
+		name:  name,
+		start: time.Now(),
+		attrs: append([]Attribute(nil), attrs...),
+	}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// TraceID returns the hex trace ID of the span, empty for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// RecordError marks the span as failed with the error, a nil error is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span and queues it for the export. Only the first call has an
+// effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.b.enqueue(s)
+}
+
+// Init exports the spans to the OTLP/HTTP endpoint of an OpenTelemetry
+// collector, such as http://otel-collector:4318. The headers are sent with
+// every export. An empty endpoint disables tracing.
+func Init(endpoint string, headers map[string]string, serviceName, serviceVersion string) error {
+	if len(endpoint) == 0 {
+		setExporter(nil)
+		return nil
+	}
+
+	e, err := newOTLPExporter(endpoint, headers, serviceName, serviceVersion)
+	if err != nil {
+		return err
+	}
+
+	setExporter(e)
+	return nil
+}
+
+// Shutdown exports the ended spans and disables tracing
+func Shutdown() {
+	setExporter(nil)
+}
+
+// setExporter swaps in a batcher for the exporter, a nil exporter disables
+// tracing. The spans of the previous batcher are exported first.
+func setExporter(e exporter) {
+	var b *batcher
+	if e != nil {
+		b = newBatcher(e)
+	}
+
+	lock.Lock()
+	prev := current
+	current = b
+	lock.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+}
+
+// batcher exports the ended spans in batches in the background
+type batcher struct {
+	e     exporter
+	queue chan *Span
+	done  chan struct{}
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+func newBatcher(e exporter) *batcher {
+	b := &batcher{
+		e:       e,
+		queue:   make(chan *Span, queueSize),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) enqueue(s *Span) {
+	select {
+	case <-b.closing:
+		return
+	default:
+	}
+
+	select {
+	case b.queue <- s:
+	default:
+		logrus.Debugf("trace: queue full, dropping span %s", s.name)
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(batchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := b.e.export(batch); err != nil {
+			logrus.Warnf("trace: failed to export %d span(s): %v", len(batch), err)
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case s := <-b.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.closing:
+			for {
+				select {
+				case s := <-b.queue:
+					batch = append(batch, s)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// close exports the queued spans and stops the batcher
+func (b *batcher) close() {
+	b.closeOnce.Do(func() {
+		close(b.closing)
+	})
+	<-b.done
+}
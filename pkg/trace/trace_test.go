@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trace
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recordingExporter) export(spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestDisabled(t *testing.T) {
+	Shutdown()
+
+	span := Start("poll.cycle")
+	require.Nil(t, span)
+
+	child := span.Start("policy.evaluate", Attr("policy.name", "prod-db"))
+	require.Nil(t, child)
+	child.SetAttributes(Attr("objects", 2))
+	child.RecordError(errors.New("failed"))
+	child.End()
+	require.Empty(t, child.TraceID())
+}
+
+func TestSpans(t *testing.T) {
+	e := &recordingExporter{}
+	setExporter(e)
+
+	root := Start("poll.cycle")
+	require.NotNil(t, root)
+	require.Len(t, root.TraceID(), 32)
+
+	child := root.Start("policy.evaluate", Attr("policy.name", "prod-db"))
+	require.Equal(t, root.TraceID(), child.TraceID())
+	child.SetAttributes(Attr("objects", 2))
+	child.RecordError(errors.New("query failed"))
+	child.End()
+	child.End()
+	root.End()
+
+	other := Start("poll.cycle")
+	require.NotEqual(t, root.TraceID(), other.TraceID())
+
+	// the spans are exported when tracing is shut down
+	Shutdown()
+	require.Len(t, e.spans, 2)
+
+	exported := e.spans[0]
+	require.Equal(t, "policy.evaluate", exported.name)
+	require.Equal(t, root.spanID, exported.parentID)
+	require.Equal(t, "query failed", exported.err)
+	require.Equal(t, []Attribute{Attr("policy.name", "prod-db"), Attr("objects", 2)}, exported.attrs)
+	require.False(t, exported.end.Before(exported.start))
+
+	// spans of a disabled tracer are dropped
+	other.End()
+	require.Len(t, e.spans, 2)
+}
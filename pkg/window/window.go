@@ -0,0 +1,216 @@
+/*
+Copyright 2019 Openstorage.org
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package window
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+)
+
+// lookAhead is how far in the future NextOpen searches for an open window
+const lookAhead = 8 * 24 * time.Hour
+
+// weekdays are the short and full names of the days, matched case insensitively
+var weekdays = map[string]time.Weekday{
+	"sun":       time.Sunday,
+	"sunday":    time.Sunday,
+	"mon":       time.Monday,
+	"monday":    time.Monday,
+	"tue":       time.Tuesday,
+	"tuesday":   time.Tuesday,
+	"wed":       time.Wednesday,
+	"wednesday": time.Wednesday,
+	"thu":       time.Thursday,
+	"thursday":  time.Thursday,
+	"fri":       time.Friday,
+	"friday":    time.Friday,
+	"sat":       time.Saturday,
+	"saturday":  time.Saturday,
+}
+
+// window is a parsed autopilot.TimeWindow
+type window struct {
+	days  map[time.Weekday]bool
+	start int // minutes since midnight
+	end   int // minutes since midnight
+}
+
+// Schedule is a parsed policy schedule
+type Schedule struct {
+	location *time.Location
+	allowed  []window
+	blocked  []window
+}
+
+// Parse parses and validates the policy schedule. A nil schedule is always open.
+func Parse(spec *autopilot.PolicySchedule) (*Schedule, error) {
+	s := &Schedule{location: time.UTC}
+	if spec == nil {
+		return s, nil
+	}
+
+	if len(spec.TimeZone) > 0 {
+		loc, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule time zone %q: %v", spec.TimeZone, err)
+		}
+		s.location = loc
+	}
+
+	for _, w := range spec.Allowed {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed window: %v", err)
+		}
+		s.allowed = append(s.allowed, parsed)
+	}
+
+	for _, w := range spec.Blocked {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked window: %v", err)
+		}
+		s.blocked = append(s.blocked, parsed)
+	}
+
+	return s, nil
+}
+
+// IsOpen returns true if the schedule allows actions to run at time t
+func (s *Schedule) IsOpen(t time.Time) bool {
+	t = t.In(s.location)
+
+	for _, w := range s.blocked {
+		if w.contains(t) {
+			return false
+		}
+	}
+
+	if len(s.allowed) == 0 {
+		return true
+	}
+
+	for _, w := range s.allowed {
+		if w.contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextOpen returns the earliest time at or after t at which the schedule is
+// open. It returns false if the schedule does not open within the next week.
+func (s *Schedule) NextOpen(t time.Time) (time.Time, bool) {
+	if s.IsOpen(t) {
+		return t, true
+	}
+
+	t = t.In(s.location)
+
+	// the schedule can only open when an allowed window starts or a blocked one
+	// ends. The times of day are set on the wall clock, adding them to midnight
+	// would be off by the daylight saving shift on the days it changes.
+	candidates := make([]time.Time, 0)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+	for d := midnight.AddDate(0, 0, -1); d.Before(t.Add(lookAhead)); d = d.AddDate(0, 0, 1) {
+		for _, w := range s.allowed {
+			candidates = append(candidates, s.at(d, w.start))
+		}
+		for _, w := range s.blocked {
+			candidates = append(candidates, s.at(d, w.end))
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	for _, c := range candidates {
+		if c.After(t) && s.IsOpen(c) {
+			return c, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// at returns the time of the day d at the given minutes since midnight
+func (s *Schedule) at(d time.Time, minutes int) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), minutes/60, minutes%60, 0, 0, s.location)
+}
+
+func (w window) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+
+	switch {
+	case w.start == w.end:
+		return w.startsOn(t.Weekday())
+	case w.start < w.end:
+		return w.startsOn(t.Weekday()) && minutes >= w.start && minutes < w.end
+	default:
+		// the window spans midnight
+		if w.startsOn(t.Weekday()) && minutes >= w.start {
+			return true
+		}
+		return w.startsOn(t.AddDate(0, 0, -1).Weekday()) && minutes < w.end
+	}
+}
+
+func (w window) startsOn(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+func parseWindow(w autopilot.TimeWindow) (window, error) {
+	var err error
+	parsed := window{}
+
+	if parsed.start, err = parseTimeOfDay(w.Start); err != nil {
+		return parsed, err
+	}
+
+	if parsed.end, err = parseTimeOfDay(w.End); err != nil {
+		return parsed, err
+	}
+
+	if len(w.Days) > 0 {
+		parsed.days = make(map[time.Weekday]bool)
+	}
+
+	for _, day := range w.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return parsed, fmt.Errorf("unknown day %q", day)
+		}
+		parsed.days[weekday] = true
+	}
+
+	return parsed, nil
+}
+
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
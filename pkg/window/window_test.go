@@ -0,0 +1,156 @@
+package window
+
+import (
+	"testing"
+	"time"
+
+	autopilot "github.com/libopenstorage/autopilot/pkg/apis/autopilot/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// 2019-06-01 is a Saturday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2019, time.June, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNilScheduleIsAlwaysOpen(t *testing.T) {
+	s, err := Parse(nil)
+	require.NoError(t, err, "Failed to parse nil schedule")
+	require.True(t, s.IsOpen(at(1, 12, 0)), "Expected nil schedule to be open")
+}
+
+func TestAllowedWindow(t *testing.T) {
+	s, err := Parse(&autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{
+			{Days: []string{"Sat", "sunday"}, Start: "01:00", End: "05:00"},
+		},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	require.True(t, s.IsOpen(at(1, 1, 0)), "Expected window to be open at its start")
+	require.True(t, s.IsOpen(at(2, 4, 59)), "Expected window to be open on Sunday")
+	require.False(t, s.IsOpen(at(1, 5, 0)), "Expected window to be closed at its end")
+	require.False(t, s.IsOpen(at(3, 2, 0)), "Expected window to be closed on Monday")
+}
+
+func TestOvernightWindow(t *testing.T) {
+	s, err := Parse(&autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{
+			{Days: []string{"Fri"}, Start: "22:00", End: "06:00"},
+		},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	require.True(t, s.IsOpen(at(7, 23, 0)), "Expected window to be open on Friday night")
+	require.True(t, s.IsOpen(at(8, 5, 0)), "Expected window to be open on Saturday morning")
+	require.False(t, s.IsOpen(at(8, 23, 0)), "Expected window to be closed on Saturday night")
+	require.False(t, s.IsOpen(at(7, 5, 0)), "Expected window to be closed on Friday morning")
+}
+
+func TestBlockedWindowTakesPrecedence(t *testing.T) {
+	s, err := Parse(&autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{{Start: "00:00", End: "00:00"}},
+		Blocked: []autopilot.TimeWindow{{Start: "09:00", End: "17:00"}},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	require.True(t, s.IsOpen(at(3, 8, 0)), "Expected schedule to be open before the blocked window")
+	require.False(t, s.IsOpen(at(3, 12, 0)), "Expected schedule to be closed in the blocked window")
+}
+
+func TestTimeZone(t *testing.T) {
+	s, err := Parse(&autopilot.PolicySchedule{
+		TimeZone: "America/New_York",
+		Allowed:  []autopilot.TimeWindow{{Start: "01:00", End: "02:00"}},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	require.True(t, s.IsOpen(at(3, 5, 30)), "Expected window to be open at 01:30 EDT")
+	require.False(t, s.IsOpen(at(3, 1, 30)), "Expected window to be closed at 01:30 UTC")
+}
+
+func TestNextOpen(t *testing.T) {
+	s, err := Parse(&autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{{Days: []string{"Sat"}, Start: "22:00", End: "06:00"}},
+		Blocked: []autopilot.TimeWindow{{Days: []string{"Sun"}, Start: "00:00", End: "02:00"}},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	next, ok := s.NextOpen(at(3, 12, 0))
+	require.True(t, ok, "Expected schedule to open")
+	require.Equal(t, at(8, 22, 0), next, "Expected schedule to open on Saturday night")
+
+	next, ok = s.NextOpen(at(9, 1, 0))
+	require.True(t, ok, "Expected schedule to open")
+	require.Equal(t, at(9, 2, 0), next, "Expected schedule to open when the blocked window ends")
+
+	now := at(8, 23, 0)
+	next, ok = s.NextOpen(now)
+	require.True(t, ok, "Expected schedule to be open")
+	require.Equal(t, now, next, "Expected an open schedule to return the current time")
+}
+
+func TestNextOpenDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err, "Failed to load time zone")
+
+	s, err := Parse(&autopilot.PolicySchedule{
+		TimeZone: "America/Los_Angeles",
+		Allowed:  []autopilot.TimeWindow{{Days: []string{"Sun"}, Start: "03:00", End: "05:00"}},
+	})
+	require.NoError(t, err, "Failed to parse schedule")
+
+	// the clocks move forward at 02:00 on 2019-03-10
+	next, ok := s.NextOpen(time.Date(2019, time.March, 9, 12, 0, 0, 0, loc))
+	require.True(t, ok, "Expected schedule to open")
+	require.True(t, time.Date(2019, time.March, 10, 3, 0, 0, 0, loc).Equal(next),
+		"Expected schedule to open at 03:00 on the wall clock, got %v", next)
+
+	// the clocks move back at 02:00 on 2019-11-03
+	next, ok = s.NextOpen(time.Date(2019, time.November, 2, 12, 0, 0, 0, loc))
+	require.True(t, ok, "Expected schedule to open")
+	require.True(t, time.Date(2019, time.November, 3, 3, 0, 0, 0, loc).Equal(next),
+		"Expected schedule to open at 03:00 on the wall clock, got %v", next)
+}
+
+func TestDayNames(t *testing.T) {
+	tests := []struct {
+		day   string
+		valid bool
+	}{
+		{day: "Sat", valid: true},
+		{day: "saturday", valid: true},
+		{day: "SATURDAY", valid: true},
+		{day: "Saturn", valid: false},
+		{day: "Satur", valid: false},
+		{day: "Mond", valid: false},
+		{day: "Sa", valid: false},
+		{day: "", valid: false},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(&autopilot.PolicySchedule{
+			Allowed: []autopilot.TimeWindow{{Days: []string{test.day}, Start: "01:00", End: "02:00"}},
+		})
+		if test.valid {
+			require.NoError(t, err, "Expected day %q to be valid", test.day)
+		} else {
+			require.Error(t, err, "Expected day %q to be invalid", test.day)
+		}
+	}
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	_, err := Parse(&autopilot.PolicySchedule{TimeZone: "Mars/Olympus_Mons"})
+	require.Error(t, err, "Expected error for invalid time zone")
+
+	_, err = Parse(&autopilot.PolicySchedule{
+		Allowed: []autopilot.TimeWindow{{Days: []string{"Someday"}, Start: "01:00", End: "02:00"}},
+	})
+	require.Error(t, err, "Expected error for invalid day")
+
+	_, err = Parse(&autopilot.PolicySchedule{
+		Blocked: []autopilot.TimeWindow{{Start: "1am", End: "02:00"}},
+	})
+	require.Error(t, err, "Expected error for invalid time of day")
+}